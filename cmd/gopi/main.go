@@ -19,6 +19,7 @@ import (
 	"github.com/yangruihan/go-pi/internal/extensions"
 	"github.com/yangruihan/go-pi/internal/llm"
 	"github.com/yangruihan/go-pi/internal/perf"
+	"github.com/yangruihan/go-pi/internal/permission"
 	"github.com/yangruihan/go-pi/internal/prompt"
 	"github.com/yangruihan/go-pi/internal/session"
 	"github.com/yangruihan/go-pi/internal/skills"
@@ -64,6 +65,9 @@ func main() {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "警告: 加载配置失败: %v，使用默认配置\n", err)
 	}
+	for _, ig := range loadSources.Ignored {
+		fmt.Fprintf(os.Stderr, "警告: %s\n", ig)
+	}
 	profiles, modelSources, perr := config.LoadModelProfilesWithSources("", cwd)
 	if perr != nil {
 		fmt.Fprintf(os.Stderr, "警告: 读取 models.yaml 失败: %v\n", perr)
@@ -157,15 +161,19 @@ func main() {
 	// 工具注册
 	registry := tools.NewRegistry()
 	var bashTool *tools.BashTool
+	var mcpManager *tools.MCPManager
 	if !*noTools {
-		bashTool = tools.NewBashTool()
+		toolOpts := tools.OptionsFromConfig(cfg.Tools)
+		bashTool = tools.NewBashTool(toolOpts)
 		registry.Register(bashTool)
-		registry.Register(tools.NewReadTool())
+		registry.Register(tools.NewReadTool(toolOpts))
 		registry.Register(tools.NewWriteTool())
 		registry.Register(tools.NewEditTool())
-		registry.Register(tools.NewGrepTool())
-		registry.Register(tools.NewFindTool())
+		registry.Register(tools.NewApplyPatchTool())
+		registry.Register(tools.NewGrepTool(toolOpts))
+		registry.Register(tools.NewFindTool(toolOpts))
 		registry.Register(tools.NewLSTool())
+		registry.Register(tools.NewCodeSymbolsTool(toolOpts))
 
 		toolFiles := append([]string{}, cfg.Ext.ToolFiles...)
 		if len(toolFiles) == 0 {
@@ -178,7 +186,7 @@ func main() {
 		}
 		for _, tf := range toolFiles {
 			tf = expandUserPath(tf)
-			loadedTools, err := tools.LoadCustomToolsFromYAML(tf)
+			loadedTools, err := tools.LoadCustomToolsFromYAML(tf, toolOpts)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "警告: 加载扩展工具失败(%s): %v\n", tf, err)
 				continue
@@ -187,6 +195,17 @@ func main() {
 				registry.Register(tool)
 			}
 		}
+
+		if len(cfg.Ext.MCPServers) > 0 {
+			mcpManager = tools.NewMCPManager(cfg.Ext.MCPServers)
+			mcpTools, err := mcpManager.Start(ctx)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "警告: 启动 MCP 服务器失败: %v\n", err)
+			}
+			for _, tool := range mcpTools {
+				registry.Register(tool)
+			}
+		}
 	}
 
 	// 初始化会话管理
@@ -227,8 +246,9 @@ func main() {
 	if err != nil {
 		fatal("创建会话失败: %v", err)
 	}
+	sess.SetModelProfiles(modelProfiles)
 
-	defer cleanupResources(sess, bashTool)
+	defer cleanupResources(sess, bashTool, mcpManager)
 
 	if *printMode {
 		runPrintMode(ctx, sess)
@@ -243,7 +263,7 @@ func main() {
 	}
 
 	// 交互式模式
-	runInteractive(ctx, sess, cfg, manager, bashTool, loadSources, *noSpinner)
+	runInteractive(ctx, sess, cfg, manager, bashTool, mcpManager, loadSources, *noSpinner)
 }
 
 // buildSystemMessage 构建系统提示词
@@ -251,7 +271,15 @@ func buildSystemMessage(cfg config.Config, runMode string) string {
 	cwd, _ := os.Getwd()
 	base := prompt.BuildBase(cwd, getOS(), cfg.LLM.Provider, runMode)
 	agentMD := strings.TrimSpace(skills.LoadAgentMarkdown(cwd))
-	return prompt.BuildWithTemplate(cfg.Prompt.TemplateFile, base, agentMD)
+	repoMap := ""
+	if cfg.Prompt.RepoMap.Enabled {
+		cacheDir := ""
+		if dir, err := config.ConfigDir(); err == nil {
+			cacheDir = filepath.Join(dir, "cache", "repomap")
+		}
+		repoMap, _ = tools.LoadRepoMap(context.Background(), cwd, cacheDir, cfg.Prompt.RepoMap.MaxTokens)
+	}
+	return prompt.BuildWithTemplate(cfg.Prompt.TemplateFile, base, agentMD, repoMap)
 }
 
 func getOS() string {
@@ -266,17 +294,19 @@ func getOS() string {
 }
 
 // runInteractive 运行交互式 CLI
-func runInteractive(ctx context.Context, sess session.Session, cfg config.Config, manager *session.SessionManager, bashTool *tools.BashTool, sources config.LoadSources, noSpinner bool) {
+func runInteractive(ctx context.Context, sess session.Session, cfg config.Config, manager *session.SessionManager, bashTool *tools.BashTool, mcpManager *tools.MCPManager, sources config.LoadSources, noSpinner bool) {
 	// 设置信号处理
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	var exitOnce sync.Once
 	cleanupAndExit := func(code int) {
 		exitOnce.Do(func() {
-			cleanupResources(sess, bashTool)
+			cleanupResources(sess, bashTool, mcpManager)
 			os.Exit(code)
 		})
 	}
+	// 正常返回后由 main 中的 defer 清理资源，此后收到的信号不再重复清理
+	defer exitOnce.Do(func() {})
 
 	go func() {
 		for sig := range sigCh {
@@ -304,22 +334,37 @@ func runInteractive(ctx context.Context, sess session.Session, cfg config.Config
 		fmt.Println(strings.Repeat("─", 60))
 	}
 
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024) // 支持大输入
+	// stdin 由单独 goroutine 读取，输入提示与工具审批共享同一行来源
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024) // 支持大输入
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	sess.SetApprover(&cliApprover{lines: lines})
 
 	for {
 		fmt.Print("\n> ")
 
-		if !scanner.Scan() {
+		line, ok := <-lines
+		if !ok {
 			// EOF (Ctrl+D)
 			fmt.Println("\n再见！")
 			break
 		}
 
-		input := strings.TrimSpace(scanner.Text())
+		input := strings.TrimSpace(line)
 		if input == "" {
 			continue
 		}
+		// 返回而不是直接退出进程，保证 main 中 defer 的清理（保存会话、关闭 shell、后台任务与 MCP 服务器）得以执行
+		if cmd := strings.Fields(input)[0]; cmd == "/exit" || cmd == "/quit" {
+			fmt.Println("再见！")
+			break
+		}
 
 		// 处理内置命令
 		if handled := handleSlashCommand(input, sess, cfg, manager); handled {
@@ -331,13 +376,15 @@ func runInteractive(ctx context.Context, sess session.Session, cfg config.Config
 	}
 }
 
-func cleanupResources(sess session.Session, bashTool *tools.BashTool) {
+func cleanupResources(sess session.Session, bashTool *tools.BashTool, mcpManager *tools.MCPManager) {
 	if sess != nil {
 		_ = sess.Save()
+		sess.Close()
 	}
 	if bashTool != nil {
 		bashTool.Close()
 	}
+	mcpManager.Close()
 }
 
 func printPerfReport(r perf.Report) {
@@ -429,6 +476,43 @@ func runAgentTurn(_ context.Context, sess session.Session, userMsg string, timeo
 	fmt.Println()
 }
 
+// cliApprover 在终端中询问是否允许工具调用
+type cliApprover struct {
+	lines <-chan string
+}
+
+func (a *cliApprover) Approve(ctx context.Context, req permission.Request) (permission.Decision, error) {
+	fmt.Printf("\n[需要确认] 工具 %s（%s）\n", req.ToolName, req.Reason)
+	if args := strings.TrimSpace(req.Args); args != "" && args != "{}" {
+		fmt.Printf("  参数: %s\n", truncate(args, 400))
+	}
+	if req.Scope != "" {
+		fmt.Printf("  始终允许/拒绝的范围: %s\n", truncate(req.Scope, 200))
+	}
+	for {
+		fmt.Print("允许执行？[y] 本次允许 / [a] 本会话始终允许 / [n] 拒绝 / [d] 本会话始终拒绝: ")
+		select {
+		case <-ctx.Done():
+			fmt.Println()
+			return permission.DecisionDenyOnce, ctx.Err()
+		case line, ok := <-a.lines:
+			if !ok {
+				return permission.DecisionDenyOnce, nil
+			}
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "y", "yes":
+				return permission.DecisionAllowOnce, nil
+			case "a", "always":
+				return permission.DecisionAllowSession, nil
+			case "n", "no", "":
+				return permission.DecisionDenyOnce, nil
+			case "d":
+				return permission.DecisionDenySession, nil
+			}
+		}
+	}
+}
+
 type thinkingIndicator struct {
 	stopCh  chan struct{}
 	doneCh  chan struct{}
@@ -512,8 +596,15 @@ func handleSlashCommand(input string, sess session.Session, cfg config.Config, m
   /session       查看当前会话与历史
   /session entries 查看当前会话最近条目
   /model <name>  切换模型
-  /checkout <entry-id> 从历史条目创建分支会话
+  /checkout <entry-id> [--files] 从历史条目创建分支会话（--files 同时回滚之后的文件修改）
   /skill:<name>  加载技能文件（.gopi/skills/<name>.md）
+  /jobs          查看后台任务
+  /jobs kill <id|all> 终止后台任务
+  /usage         查看本会话的 token 用量、费用与预算
+  /set [参数 值] 查看或设置生成参数（如 /set temperature 0.2，值为 default 时恢复默认）
+  /changes       查看本会话的文件修改记录
+  /undo [n]      撤销最近 n 次文件修改
+  /redo [n]      重做最近撤销的 n 次文件修改
   /clear         清空对话历史
   /exit, /quit   退出`)
 		extra := extensions.ListSlashCommands()
@@ -585,10 +676,14 @@ func handleSlashCommand(input string, sess session.Session, cfg config.Config, m
 
 	case "/checkout":
 		if len(parts) < 2 {
-			fmt.Println("用法: /checkout <entry-id>")
+			fmt.Println("用法: /checkout <entry-id> [--files]")
 			return true
 		}
-		newID, err := sess.Checkout(parts[1])
+		var opts []session.CheckoutOpt
+		if len(parts) >= 3 && parts[2] == "--files" {
+			opts = append(opts, session.WithFileRollback())
+		}
+		newID, err := sess.Checkout(parts[1], opts...)
 		if err != nil {
 			fmt.Printf("checkout 失败: %v\n", err)
 		} else {
@@ -596,16 +691,27 @@ func handleSlashCommand(input string, sess session.Session, cfg config.Config, m
 		}
 		return true
 
+	case "/jobs":
+		fmt.Println(tools.JobsCommand(sess.Jobs(), parts[1:]))
+		return true
+
+	case "/changes", "/undo", "/redo":
+		fmt.Println(session.ChangeCommand(sess, cmd, parts[1:]))
+		return true
+
+	case "/usage":
+		fmt.Println(session.UsageCommand(sess))
+		return true
+
+	case "/set":
+		fmt.Println(session.SetCommand(sess, parts[1:]))
+		return true
+
 	case "/clear":
 		sess.ClearMessages()
 		fmt.Println("对话历史已清空")
 		return true
 
-	case "/exit", "/quit":
-		fmt.Println("再见！")
-		os.Exit(0)
-		return true
-
 	default:
 		name := strings.TrimPrefix(cmd, "/")
 		if out, ok, err := extensions.ExecuteSlashCommand(name, parts[1:]); ok {
@@ -627,6 +733,20 @@ type cliOutputRenderer struct {
 
 	lastToolResultSig string
 	lastToolResultCnt int
+
+	// 已实时输出过的工具调用，结果只打印末尾状态行
+	streamed map[string]bool
+
+	// 正在以暗色输出推理内容
+	thinking bool
+}
+
+// endThinking 结束暗色的推理内容段落
+func (r *cliOutputRenderer) endThinking() {
+	if r.thinking {
+		fmt.Print("\033[0m\n\n")
+		r.thinking = false
+	}
 }
 
 func (r *cliOutputRenderer) flushToolCallDup() {
@@ -646,12 +766,23 @@ func (r *cliOutputRenderer) flushToolResultDup() {
 }
 
 func (r *cliOutputRenderer) flush() {
+	r.endThinking()
 	r.flushToolCallDup()
 	r.flushToolResultDup()
 }
 
 func handleOutputEvent(event agent.AgentEvent, renderer *cliOutputRenderer) {
+	if event.Type != agent.AgentEventThinking && event.Type != agent.AgentEventTurnStart {
+		renderer.endThinking()
+	}
 	switch event.Type {
+	case agent.AgentEventThinking:
+		if !renderer.thinking {
+			renderer.flush()
+			fmt.Print("\033[2m[思考] ")
+			renderer.thinking = true
+		}
+		fmt.Print(event.Delta)
 	case agent.AgentEventDelta:
 		renderer.flushToolCallDup()
 		renderer.flushToolResultDup()
@@ -670,9 +801,22 @@ func handleOutputEvent(event agent.AgentEvent, renderer *cliOutputRenderer) {
 		if event.ToolArgs != "" && event.ToolArgs != "{}" {
 			fmt.Printf("  参数: %s\n", truncate(event.ToolArgs, 200))
 		}
+	case agent.AgentEventToolProgress:
+		renderer.flushToolCallDup()
+		if renderer.streamed == nil {
+			renderer.streamed = make(map[string]bool)
+		}
+		renderer.streamed[event.ToolCallID] = true
+		fmt.Print(event.Delta)
 	case agent.AgentEventToolResult:
 		renderer.flushToolCallDup()
 		result := strings.TrimSpace(event.ToolResult)
+		if renderer.streamed[event.ToolCallID] {
+			delete(renderer.streamed, event.ToolCallID)
+			lines := strings.Split(result, "\n")
+			fmt.Printf("\n%s\n\n", lines[len(lines)-1])
+			return
+		}
 		if result == renderer.lastToolResultSig {
 			renderer.lastToolResultCnt++
 			return
@@ -691,6 +835,9 @@ func handleOutputEvent(event agent.AgentEvent, renderer *cliOutputRenderer) {
 			}
 		}
 		fmt.Println()
+	case agent.AgentEventNotice, agent.AgentEventFallback:
+		renderer.flush()
+		fmt.Printf("\n[提示] %s\n", event.Delta)
 	case agent.AgentEventTurnEnd, agent.AgentEventEnd, agent.AgentEventError:
 		renderer.flush()
 	}
@@ -711,8 +858,11 @@ func runPrintMode(_ context.Context, sess session.Session) {
 	}
 
 	unsubscribe := sess.Subscribe(func(event agent.AgentEvent) {
-		if event.Type == agent.AgentEventDelta {
+		switch event.Type {
+		case agent.AgentEventDelta:
 			fmt.Print(event.Delta)
+		case agent.AgentEventNotice, agent.AgentEventFallback:
+			fmt.Fprintf(os.Stderr, "提示: %s\n", event.Delta)
 		}
 	})
 	defer unsubscribe()
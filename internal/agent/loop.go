@@ -36,11 +36,11 @@ func RunLoop(
 		msgs := make([]llm.Message, len(messages))
 		copy(msgs, messages)
 
-		// 添加系统消息（如果有）
-		if config.SystemMsg != "" {
-			sysMsg := llm.Message{Role: "system", Content: config.SystemMsg}
-			msgs = append([]llm.Message{sysMsg}, msgs...)
+		mode := ParseToolCallingMode(string(config.ToolCalling))
+		if mode == ToolCallingReAct {
+			msgs = toReActHistory(msgs)
 		}
+		systemMsg := buildSystemMsg(config, mode)
 
 		ch <- AgentEvent{Type: AgentEventStart}
 
@@ -69,34 +69,58 @@ func RunLoop(
 			// 调用 LLM
 			req := &llm.ChatRequest{
 				Model:    config.Model,
-				Messages: msgs,
-				Tools:    config.Tools,
+				Messages: withSystemMsg(systemMsg, requestHistory(msgs, config.KeepThinking)),
 				Stream:   true,
+				Options:  config.Options,
 			}
+			if mode != ToolCallingReAct {
+				req.Tools = config.Tools
+			}
+			// auto 模式下模型拒绝 tools 参数时，切换到 ReAct 并重试本轮
+			canFallback := mode == ToolCallingAuto && len(req.Tools) > 0
 
 			events, err := client.Chat(ctx, req)
 			if err != nil {
+				if canFallback && llm.IsToolsUnsupportedError(err) {
+					mode, msgs, systemMsg = switchToReAct(config, msgs)
+					turns--
+					ch <- AgentEvent{Type: AgentEventTurnEnd}
+					continue
+				}
 				ch <- AgentEvent{Type: AgentEventError, Err: fmt.Errorf("chat: %w", err)}
 				return
 			}
 
 			// 收集本轮 LLM 响应
 			var fullMsg *llm.Message
+			var usage *llm.Usage
 			var toolCalls []llm.ToolCall
+			gotOutput := false
+			fallback := false
 
 			for event := range events {
+				if fallback {
+					continue
+				}
 				switch event.Type {
 				case llm.EventMessageDelta:
+					gotOutput = true
 					ch <- AgentEvent{Type: AgentEventDelta, Delta: event.Delta}
 
+				case llm.EventThinkingDelta:
+					gotOutput = true
+					ch <- AgentEvent{Type: AgentEventThinking, Delta: event.Delta}
+
 				case llm.EventMessageEnd:
 					fullMsg = event.Message
+					usage = event.Usage
 					if fullMsg != nil {
 						toolCalls = fullMsg.ToolCalls
 					}
 
 				case llm.EventToolCallStart:
 					if event.Tool != nil {
+						gotOutput = true
 						ch <- AgentEvent{
 							Type:       AgentEventToolCall,
 							ToolCallID: event.Tool.ID,
@@ -105,29 +129,61 @@ func RunLoop(
 						}
 					}
 
+				case llm.EventRetry:
+					ch <- AgentEvent{Type: AgentEventNotice, Delta: event.Delta}
+
+				case llm.EventFallback:
+					ch <- AgentEvent{Type: AgentEventFallback, Model: event.Model, Delta: event.Delta}
+
 				case llm.EventError:
+					if canFallback && !gotOutput && llm.IsToolsUnsupportedError(event.Err) {
+						fallback = true
+						continue
+					}
 					ch <- AgentEvent{Type: AgentEventError, Err: event.Err}
 					return
 				}
 			}
 
-			// 将 assistant 消息加入历史
+			if fallback {
+				mode, msgs, systemMsg = switchToReAct(config, msgs)
+				turns--
+				ch <- AgentEvent{Type: AgentEventTurnEnd}
+				continue
+			}
+
+			// ReAct：模型未返回原生 tool call 时，解析 Action/Action Input（native 模式不解析）
+			fromReAct := false
+			if len(toolCalls) == 0 && fullMsg != nil && mode != ToolCallingNative {
+				if reactCall, ok := parseReActToolCall(fullMsg.Content); ok {
+					toolCalls = []llm.ToolCall{reactCall}
+					fromReAct = true
+				}
+			}
+
+			// 将 assistant 消息加入历史（ReAct 调用在循环内仍以文本协议往返）
 			if fullMsg != nil {
 				msgs = append(msgs, *fullMsg)
 			}
 
-			ch <- AgentEvent{Type: AgentEventTurnEnd}
+			// TurnEnd 携带本轮完整 assistant 消息（含 tool_calls），供会话层持久化；
+			// ReAct 解析出的调用也附在其中，使保存的 tool 结果始终有对应的调用
+			var turnMsg *llm.Message
+			if fullMsg != nil {
+				m := *fullMsg
+				if fromReAct {
+					m.ToolCalls = toolCalls
+				}
+				turnMsg = &m
+			}
+			ch <- AgentEvent{Type: AgentEventTurnEnd, Message: turnMsg, Usage: usage}
 
-			// 最小 ReAct fallback：当模型未返回原生 tool call 时，尝试解析 Action/Action Input
-			if len(toolCalls) == 0 && fullMsg != nil {
-				if reactCall, ok := parseReActToolCall(fullMsg.Content, turns); ok {
-					toolCalls = []llm.ToolCall{reactCall}
-					ch <- AgentEvent{
-						Type:       AgentEventToolCall,
-						ToolCallID: reactCall.ID,
-						ToolName:   reactCall.Function.Name,
-						ToolArgs:   reactCall.Function.Arguments,
-					}
+			if fromReAct {
+				ch <- AgentEvent{
+					Type:       AgentEventToolCall,
+					ToolCallID: toolCalls[0].ID,
+					ToolName:   toolCalls[0].Function.Name,
+					ToolArgs:   toolCalls[0].Function.Arguments,
 				}
 			}
 
@@ -138,7 +194,14 @@ func RunLoop(
 
 			// 并发执行所有工具调用
 			if executor != nil {
-				results := execToolsConcurrent(ctx, toolCalls, executor)
+				results := execToolsConcurrent(ctx, toolCalls, executor, func(call llm.ToolCall, chunk string) {
+					ch <- AgentEvent{
+						Type:       AgentEventToolProgress,
+						ToolCallID: call.ID,
+						ToolName:   call.Function.Name,
+						Delta:      chunk,
+					}
+				})
 				for _, res := range results {
 					ch <- AgentEvent{
 						Type:       AgentEventToolResult,
@@ -146,7 +209,11 @@ func RunLoop(
 						ToolName:   res.name,
 						ToolResult: res.result,
 					}
-					// 将工具结果加入消息历史
+					// 将工具结果加入消息历史；ReAct 调用以 Observation 文本回传
+					if fromReAct {
+						msgs = append(msgs, reactObservation(res.result))
+						continue
+					}
 					msgs = append(msgs, llm.Message{
 						Role:       "tool",
 						Content:    res.result,
@@ -165,6 +232,67 @@ func RunLoop(
 	return ch
 }
 
+// buildSystemMsg 组合系统提示；ReAct 模式追加由工具 schema 生成的工具手册
+func buildSystemMsg(config AgentLoopConfig, mode ToolCallingMode) string {
+	sys := config.SystemMsg
+	if mode != ToolCallingReAct {
+		return sys
+	}
+	manual := BuildReActManual(config.Tools)
+	if manual == "" {
+		return sys
+	}
+	if strings.TrimSpace(sys) == "" {
+		return manual
+	}
+	return sys + "\n\n" + manual
+}
+
+// withSystemMsg 在消息列表前添加系统消息（如果有）
+func withSystemMsg(systemMsg string, msgs []llm.Message) []llm.Message {
+	if systemMsg == "" {
+		return msgs
+	}
+	out := make([]llm.Message, 0, len(msgs)+1)
+	out = append(out, llm.Message{Role: "system", Content: systemMsg})
+	return append(out, msgs...)
+}
+
+// requestHistory 返回发送给模型的历史：keepThinking 为 false 时去掉 assistant 的推理内容
+func requestHistory(msgs []llm.Message, keepThinking bool) []llm.Message {
+	if keepThinking {
+		return msgs
+	}
+	var out []llm.Message
+	for i, m := range msgs {
+		if m.Thinking == "" {
+			continue
+		}
+		if out == nil {
+			out = make([]llm.Message, len(msgs))
+			copy(out, msgs)
+		}
+		out[i].Thinking = ""
+	}
+	if out == nil {
+		return msgs
+	}
+	return out
+}
+
+// switchToReAct 将当前循环切换到 ReAct 模式
+func switchToReAct(config AgentLoopConfig, msgs []llm.Message) (ToolCallingMode, []llm.Message, string) {
+	return ToolCallingReAct, toReActHistory(msgs), buildSystemMsg(config, ToolCallingReAct)
+}
+
+type toolCallIDKey struct{}
+
+// ToolCallIDFromContext 返回当前正在执行的工具调用 ID（仅在工具执行期间的 context 中存在）
+func ToolCallIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(toolCallIDKey{}).(string)
+	return id
+}
+
 // toolExecResult 工具执行结果
 type toolExecResult struct {
 	toolCallID string
@@ -174,7 +302,10 @@ type toolExecResult struct {
 }
 
 // execToolsConcurrent 并发执行所有工具调用
-func execToolsConcurrent(ctx context.Context, calls []llm.ToolCall, executor ToolExecutor) []toolExecResult {
+// executor 支持流式输出时，实时片段通过 onProgress 回传
+func execToolsConcurrent(ctx context.Context, calls []llm.ToolCall, executor ToolExecutor, onProgress func(call llm.ToolCall, chunk string)) []toolExecResult {
+	streaming, _ := executor.(StreamingToolExecutor)
+
 	results := make([]toolExecResult, len(calls))
 	var wg sync.WaitGroup
 
@@ -193,7 +324,18 @@ func execToolsConcurrent(ctx context.Context, calls []llm.ToolCall, executor Too
 				argsRaw = json.RawMessage("{}")
 			}
 
-			result, err := executor.Execute(ctx, call.Function.Name, argsRaw)
+			ctx := context.WithValue(ctx, toolCallIDKey{}, call.ID)
+			var result string
+			var err error
+			if streaming != nil && onProgress != nil {
+				result, err = streaming.ExecuteStream(ctx, call.Function.Name, argsRaw, func(chunk string) {
+					if chunk != "" {
+						onProgress(call, chunk)
+					}
+				})
+			} else {
+				result, err = executor.Execute(ctx, call.Function.Name, argsRaw)
+			}
 			if err != nil {
 				results[i].result = fmt.Sprintf("错误: %s", err.Error())
 				results[i].err = err
@@ -207,7 +349,7 @@ func execToolsConcurrent(ctx context.Context, calls []llm.ToolCall, executor Too
 	return results
 }
 
-func parseReActToolCall(content string, turn int) (llm.ToolCall, bool) {
+func parseReActToolCall(content string) (llm.ToolCall, bool) {
 	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
 	var action string
 	var actionInput string
@@ -263,7 +405,7 @@ func parseReActToolCall(content string, turn int) (llm.ToolCall, bool) {
 	}
 
 	return llm.ToolCall{
-		ID:   fmt.Sprintf("react-%d", turn),
+		ID:   llm.NewToolCallID(),
 		Type: "function",
 		Function: llm.ToolCallFunction{
 			Name:      action,
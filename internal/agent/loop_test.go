@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/yangruihan/go-pi/internal/llm"
@@ -17,6 +18,7 @@ import (
 type mockLLMClient struct {
 	responses []mockResponse
 	callCount int
+	requests  []*llm.ChatRequest
 }
 
 type mockResponse struct {
@@ -24,7 +26,8 @@ type mockResponse struct {
 	err    error
 }
 
-func (m *mockLLMClient) Chat(_ context.Context, _ *llm.ChatRequest) (<-chan llm.Event, error) {
+func (m *mockLLMClient) Chat(_ context.Context, req *llm.ChatRequest) (<-chan llm.Event, error) {
+	m.requests = append(m.requests, req)
 	if m.callCount >= len(m.responses) {
 		// 返回空响应
 		ch := make(chan llm.Event, 1)
@@ -117,6 +120,24 @@ func (m *mockExecutor) Execute(_ context.Context, name string, args json.RawMess
 	return "ok", nil
 }
 
+// streamingExecutor 在返回结果前逐段回传输出
+type streamingExecutor struct {
+	chunks []string
+}
+
+func (e *streamingExecutor) Execute(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	return e.ExecuteStream(ctx, name, args, nil)
+}
+
+func (e *streamingExecutor) ExecuteStream(_ context.Context, _ string, _ json.RawMessage, onProgress func(chunk string)) (string, error) {
+	for _, c := range e.chunks {
+		if onProgress != nil {
+			onProgress(c)
+		}
+	}
+	return "done", nil
+}
+
 // --- Tests ---
 
 // TestLoopSingleTurn 测试单轮对话（无工具调用）
@@ -325,6 +346,173 @@ func TestLoopReActFallbackFencedJSON(t *testing.T) {
 	assert.JSONEq(t, `{"path":"test.go"}`, executor.calls[0].args)
 }
 
+func testReadFileTool(t *testing.T) llm.Tool {
+	t.Helper()
+	tool, err := llm.BuildTool(llm.ToolSchema{
+		Name:        "read_file",
+		Description: "读取文件内容",
+		Parameters: llm.ToolParameters{
+			Type: "object",
+			Properties: map[string]llm.ToolProperty{
+				"path": {Type: "string", Description: "文件路径"},
+			},
+			Required: []string{"path"},
+		},
+	})
+	require.NoError(t, err)
+	return tool
+}
+
+// TestLoopReActMode react 模式不发送 tools，注入工具手册，并以 Observation 回传结果
+func TestLoopReActMode(t *testing.T) {
+	client := &mockLLMClient{
+		responses: []mockResponse{
+			buildTextResponse("Action: read_file\nAction Input: {\"path\":\"test.go\"}"),
+			buildTextResponse("读取完成"),
+		},
+	}
+	executor := newMockExecutor()
+	executor.results["read_file"] = "package main"
+
+	config := DefaultLoopConfig("test-model")
+	config.Tools = []llm.Tool{testReadFileTool(t)}
+	config.SystemMsg = "你是助手"
+	config.ToolCalling = ToolCallingReAct
+
+	for range RunLoop(context.Background(), []llm.Message{{Role: "user", Content: "读取 test.go"}}, config, client, executor) {
+	}
+
+	require.Len(t, client.requests, 2)
+	first := client.requests[0]
+	assert.Empty(t, first.Tools)
+	require.Equal(t, "system", first.Messages[0].Role)
+	assert.Contains(t, first.Messages[0].Content, "你是助手")
+	assert.Contains(t, first.Messages[0].Content, "- read_file: 读取文件内容")
+	assert.Contains(t, first.Messages[0].Content, "path (string, 必填): 文件路径")
+
+	require.Len(t, executor.calls, 1)
+	second := client.requests[1].Messages
+	last := second[len(second)-1]
+	assert.Equal(t, "user", last.Role)
+	assert.Equal(t, "Observation: package main", last.Content)
+}
+
+// TestLoopReActCallIDs ReAct 调用的 ID 在多次 Prompt 间唯一，且附在 TurnEnd 的 assistant 消息上
+func TestLoopReActCallIDs(t *testing.T) {
+	var ids []string
+	for i := 0; i < 2; i++ {
+		client := &mockLLMClient{
+			responses: []mockResponse{
+				buildTextResponse("Action: read_file\nAction Input: {\"path\":\"test.go\"}"),
+				buildTextResponse("读取完成"),
+			},
+		}
+		executor := newMockExecutor()
+		executor.results["read_file"] = "package main"
+		config := DefaultLoopConfig("test-model")
+		config.ToolCalling = ToolCallingReAct
+
+		var saved *llm.Message
+		var resultID string
+		for e := range RunLoop(context.Background(), []llm.Message{{Role: "user", Content: "读取 test.go"}}, config, client, executor) {
+			if e.Type == AgentEventTurnEnd && saved == nil && e.Message != nil {
+				saved = e.Message
+			}
+			if e.Type == AgentEventToolResult {
+				resultID = e.ToolCallID
+			}
+		}
+		require.NotNil(t, saved)
+		require.Len(t, saved.ToolCalls, 1)
+		assert.Equal(t, resultID, saved.ToolCalls[0].ID)
+		ids = append(ids, resultID)
+
+		// 转回 ReAct 历史时不重复 Action 文本
+		history := toReActHistory([]llm.Message{*saved})
+		assert.Equal(t, 1, strings.Count(history[0].Content, "Action: read_file"))
+		assert.Empty(t, history[0].ToolCalls)
+	}
+	assert.NotEqual(t, ids[0], ids[1])
+}
+
+// TestLoopNativeModeNoFallback native 模式不解析 ReAct 文本
+func TestLoopNativeModeNoFallback(t *testing.T) {
+	client := &mockLLMClient{
+		responses: []mockResponse{
+			buildTextResponse("Action: read_file\nAction Input: {\"path\":\"test.go\"}"),
+		},
+	}
+	executor := newMockExecutor()
+
+	config := DefaultLoopConfig("test-model")
+	config.Tools = []llm.Tool{testReadFileTool(t)}
+	config.ToolCalling = ToolCallingNative
+
+	for range RunLoop(context.Background(), []llm.Message{{Role: "user", Content: "读取 test.go"}}, config, client, executor) {
+	}
+
+	assert.Empty(t, executor.calls)
+	require.Len(t, client.requests, 1)
+	assert.Len(t, client.requests[0].Tools, 1)
+}
+
+// TestLoopAutoFallsBackToReAct auto 模式下模型不支持 tools 时切换到 ReAct 重试
+func TestLoopAutoFallsBackToReAct(t *testing.T) {
+	client := &mockLLMClient{
+		responses: []mockResponse{
+			{events: []llm.Event{{Type: llm.EventError, Err: errors.New(`registry.ollama.ai/library/gemma:2b does not support tools`)}}},
+			buildTextResponse("你好"),
+		},
+	}
+
+	config := DefaultLoopConfig("test-model")
+	config.Tools = []llm.Tool{testReadFileTool(t)}
+
+	var errs []error
+	for e := range RunLoop(context.Background(), []llm.Message{{Role: "user", Content: "hi"}}, config, client, newMockExecutor()) {
+		if e.Type == AgentEventError {
+			errs = append(errs, e.Err)
+		}
+	}
+
+	assert.Empty(t, errs)
+	require.Len(t, client.requests, 2)
+	assert.Len(t, client.requests[0].Tools, 1)
+	assert.Empty(t, client.requests[1].Tools)
+	assert.Contains(t, client.requests[1].Messages[0].Content, "工具调用协议（ReAct）")
+}
+
+// TestLoopToolProgress 流式执行器的输出以 tool_progress 事件实时转发
+func TestLoopToolProgress(t *testing.T) {
+	client := &mockLLMClient{
+		responses: []mockResponse{
+			buildToolCallResponse("", "bash", map[string]string{"command": "go test ./..."}),
+			buildTextResponse("完成"),
+		},
+	}
+	executor := &streamingExecutor{chunks: []string{"ok  pkg/a\n", "ok  pkg/b\n"}}
+
+	var progress []string
+	var resultIdx, lastProgressIdx int
+	i := 0
+	for e := range RunLoop(context.Background(), []llm.Message{{Role: "user", Content: "跑测试"}}, DefaultLoopConfig("test-model"), client, executor) {
+		switch e.Type {
+		case AgentEventToolProgress:
+			assert.Equal(t, "test-tc-1", e.ToolCallID)
+			assert.Equal(t, "bash", e.ToolName)
+			progress = append(progress, e.Delta)
+			lastProgressIdx = i
+		case AgentEventToolResult:
+			assert.Equal(t, "done", e.ToolResult)
+			resultIdx = i
+		}
+		i++
+	}
+
+	assert.Equal(t, []string{"ok  pkg/a\n", "ok  pkg/b\n"}, progress)
+	assert.Less(t, lastProgressIdx, resultIdx)
+}
+
 // TestLoopContextCancellation 测试上下文取消
 func TestLoopContextCancellation(t *testing.T) {
 	// 创建一个 mock，Chat 会阻塞
@@ -429,3 +617,46 @@ func (b *blockingLLMClient) Chat(ctx context.Context, _ *llm.ChatRequest) (<-cha
 	}()
 	return ch, nil
 }
+
+// TestLoopThinking 测试推理内容单独输出，且默认不随历史发回模型
+func TestLoopThinking(t *testing.T) {
+	newClient := func() *mockLLMClient {
+		return &mockLLMClient{responses: []mockResponse{{events: []llm.Event{
+			{Type: llm.EventThinkingDelta, Delta: "先想一想"},
+			{Type: llm.EventMessageDelta, Delta: "答案"},
+			{Type: llm.EventMessageEnd, Message: &llm.Message{Role: "assistant", Content: "答案", Thinking: "先想一想"}},
+		}}}}
+	}
+	history := []llm.Message{
+		{Role: "user", Content: "上一个问题"},
+		{Role: "assistant", Content: "上一个答案", Thinking: "上一次的思考"},
+		{Role: "user", Content: "新问题"},
+	}
+
+	client := newClient()
+	var thinking, text string
+	var turnMsg *llm.Message
+	for e := range RunLoop(context.Background(), history, DefaultLoopConfig("test-model"), client, nil) {
+		switch e.Type {
+		case AgentEventThinking:
+			thinking += e.Delta
+		case AgentEventDelta:
+			text += e.Delta
+		case AgentEventTurnEnd:
+			turnMsg = e.Message
+		}
+	}
+	assert.Equal(t, "先想一想", thinking)
+	assert.Equal(t, "答案", text)
+	require.NotNil(t, turnMsg)
+	assert.Equal(t, "先想一想", turnMsg.Thinking)
+	assert.Empty(t, client.requests[0].Messages[1].Thinking)
+	assert.Equal(t, "上一次的思考", history[1].Thinking, "不修改调用方的历史")
+
+	client = newClient()
+	config := DefaultLoopConfig("test-model")
+	config.KeepThinking = true
+	for range RunLoop(context.Background(), history, config, client, nil) {
+	}
+	assert.Equal(t, "上一次的思考", client.requests[0].Messages[1].Thinking)
+}
@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yangruihan/go-pi/internal/llm"
+)
+
+// BuildReActManual 根据工具 schema 生成 ReAct 工具手册，注入系统提示
+// 用于不支持原生工具调用的模型
+func BuildReActManual(tools []llm.Tool) string {
+	if len(tools) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(`工具调用协议（ReAct）:
+当前模型不使用原生工具调用。需要调用工具时，严格按以下格式输出，每次只调用一个工具，输出 Action Input 后立即停止，等待工具结果：
+
+Thought: 简要说明为什么需要调用工具
+Action: 工具名
+Action Input: {"参数名": "参数值"}
+
+工具结果会以 "Observation: ..." 的形式返回。Action Input 必须是合法的 JSON 对象。
+不需要工具时直接回答，不要输出 Action 行。
+
+可用工具:`)
+
+	for _, t := range tools {
+		fmt.Fprintf(&b, "\n- %s: %s", t.Function.Name, strings.TrimSpace(t.Function.Description))
+		for _, line := range describeParams(t.Function.Parameters) {
+			b.WriteString("\n    ")
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
+
+// describeParams 将参数 JSON Schema 转为逐行说明，必填参数在前
+func describeParams(raw json.RawMessage) []string {
+	var schema llm.ToolParameters
+	if len(raw) == 0 || json.Unmarshal(raw, &schema) != nil || len(schema.Properties) == 0 {
+		return nil
+	}
+
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if required[names[i]] != required[names[j]] {
+			return required[names[i]]
+		}
+		return names[i] < names[j]
+	})
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		p := schema.Properties[name]
+		flag := "可选"
+		if required[name] {
+			flag = "必填"
+		}
+		typ := p.Type
+		if len(p.Types) > 0 {
+			typ = strings.Join(p.Types, " | ")
+		}
+		line := fmt.Sprintf("%s (%s, %s)", name, typ, flag)
+		if desc := strings.TrimSpace(p.Description); desc != "" {
+			line += ": " + desc
+		}
+		if len(p.Enum) > 0 {
+			line += fmt.Sprintf(" [可选值: %s]", llm.EnumString(p.Enum))
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// toReActHistory 将原生工具调用历史改写为 ReAct 文本，
+// 避免不支持 tool 角色的模型模板丢弃工具结果
+func toReActHistory(msgs []llm.Message) []llm.Message {
+	out := make([]llm.Message, 0, len(msgs))
+	for _, m := range msgs {
+		switch {
+		case m.Role == "assistant" && len(m.ToolCalls) > 0:
+			var b strings.Builder
+			b.WriteString(strings.TrimSpace(m.Content))
+			for _, tc := range m.ToolCalls {
+				// ReAct 解析出的调用在正文中已有 Action 文本，不再重复
+				if strings.Contains(m.Content, "Action: "+tc.Function.Name) {
+					continue
+				}
+				if b.Len() > 0 {
+					b.WriteString("\n")
+				}
+				args := strings.TrimSpace(tc.Function.Arguments)
+				if args == "" {
+					args = "{}"
+				}
+				fmt.Fprintf(&b, "Action: %s\nAction Input: %s", tc.Function.Name, args)
+			}
+			m.Content = b.String()
+			m.ToolCalls = nil
+		case m.Role == "tool":
+			m = reactObservation(m.Content)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// reactObservation 构造 ReAct 模式下回传给模型的工具结果消息
+func reactObservation(result string) llm.Message {
+	return llm.Message{Role: "user", Content: "Observation: " + result}
+}
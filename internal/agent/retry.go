@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/yangruihan/go-pi/internal/llm"
+)
+
+// Fallback 回退目标：主模型重试耗尽后依次尝试
+type Fallback struct {
+	Model   string
+	Client  LLMClient
+	Options *llm.GenerationOptions // 回退模型自身的生成参数，nil 时沿用原请求的参数
+}
+
+// RetryOptions 重试与回退配置
+type RetryOptions struct {
+	MaxRetries int           // 每个模型在临时故障后的最大重试次数，0 表示不重试
+	BaseDelay  time.Duration // 首次重试等待时间，之后指数增长并加入随机抖动，默认 500ms
+	MaxDelay   time.Duration // 单次等待上限，默认 30s；Retry-After 超过该值时不再等待，直接回退
+	// Fallbacks 返回主模型的回退链，可为 nil；仅在主模型重试耗尽后调用
+	Fallbacks func(model string) []Fallback
+}
+
+// RetryClient 包装 LLMClient：尚未输出任何内容时遇到临时故障（429 / 5xx / 连接中断）
+// 按指数退避重试，遵循 Retry-After；重试耗尽后把同一请求发给回退模型
+type RetryClient struct {
+	next LLMClient
+	opts RetryOptions
+}
+
+func NewRetryClient(next LLMClient, opts RetryOptions) *RetryClient {
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = 500 * time.Millisecond
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = 30 * time.Second
+	}
+	return &RetryClient{next: next, opts: opts}
+}
+
+func (c *RetryClient) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.Event, error) {
+	out := make(chan llm.Event, 32)
+	go func() {
+		defer close(out)
+		target := Fallback{Model: req.Model, Client: c.next}
+		var chain []Fallback
+		attempts := 0
+		for i := 0; ; i++ {
+			r := *req
+			r.Model = target.Model
+			if target.Options != nil {
+				r.Options = target.Options
+			}
+			var announce *llm.Event
+			if i > 0 {
+				announce = &llm.Event{Type: llm.EventFallback, Model: target.Model, Delta: fmt.Sprintf("模型 %s 暂不可用，已改用 %s", req.Model, target.Model)}
+			}
+			n, err := c.try(ctx, target.Client, &r, out, announce)
+			attempts += n
+			if err == nil || ctx.Err() != nil {
+				return
+			}
+			if !llm.IsTransientError(err) {
+				out <- llm.Event{Type: llm.EventError, Err: err}
+				return
+			}
+			if i == 0 && c.opts.Fallbacks != nil {
+				chain = c.opts.Fallbacks(req.Model)
+			}
+			if i >= len(chain) {
+				if attempts > 1 {
+					err = fmt.Errorf("%w（共尝试 %d 次）", err, attempts)
+				}
+				out <- llm.Event{Type: llm.EventError, Err: err}
+				return
+			}
+			target = chain[i]
+		}
+	}()
+	return out, nil
+}
+
+// try 对单个模型请求并按需重试，返回请求次数；
+// 返回 nil 表示已开始输出（之后的错误原样转发，不再重试）
+func (c *RetryClient) try(ctx context.Context, client LLMClient, req *llm.ChatRequest, out chan<- llm.Event, announce *llm.Event) (int, error) {
+	for attempt := 0; ; attempt++ {
+		err := forwardUntilOutput(ctx, client, req, out, announce)
+		if err == nil || !llm.IsTransientError(err) {
+			return attempt + 1, err
+		}
+		if attempt >= c.opts.MaxRetries {
+			return attempt + 1, err
+		}
+		wait := llm.RetryAfterHint(err)
+		if wait > c.opts.MaxDelay {
+			return attempt + 1, err
+		}
+		if wait <= 0 {
+			wait = c.backoff(attempt)
+		}
+		out <- llm.Event{Type: llm.EventRetry, Err: err, Delta: fmt.Sprintf("模型 %s 请求失败（%v），%.1f 秒后第 %d 次重试", req.Model, err, wait.Seconds(), attempt+1)}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt + 1, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff 第 attempt 次重试的等待时间：指数增长、以 MaxDelay 为上限，并在 [d/2, d] 内随机抖动
+func (c *RetryClient) backoff(attempt int) time.Duration {
+	d := c.opts.BaseDelay << attempt
+	if d <= 0 || d > c.opts.MaxDelay {
+		d = c.opts.MaxDelay
+	}
+	return d/2 + time.Duration(rand.Int64N(int64(d/2)+1))
+}
+
+// forwardUntilOutput 转发一次请求的事件；输出开始前出现的错误不转发而是返回，供调用方重试。
+// announce 非空时在首个事件前发送
+func forwardUntilOutput(ctx context.Context, client LLMClient, req *llm.ChatRequest, out chan<- llm.Event, announce *llm.Event) error {
+	events, err := client.Chat(ctx, req)
+	if err != nil {
+		return err
+	}
+	started := false
+	var preErr error
+	for ev := range events {
+		if preErr != nil {
+			continue // 排空剩余事件，避免阻塞生产者
+		}
+		if !started && ev.Type == llm.EventError {
+			preErr = ev.Err
+			if preErr == nil {
+				preErr = fmt.Errorf("chat failed")
+			}
+			continue
+		}
+		if !started && announce != nil {
+			out <- *announce
+		}
+		started = true
+		out <- ev
+	}
+	return preErr
+}
@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yangruihan/go-pi/internal/llm"
+)
+
+func errorResponse(code int, retryAfter time.Duration) mockResponse {
+	return mockResponse{events: []llm.Event{{Type: llm.EventError, Err: &llm.StatusError{StatusCode: code, Status: "busy", RetryAfter: retryAfter}}}}
+}
+
+func collectLLMEvents(t *testing.T, client LLMClient, model string) []llm.Event {
+	t.Helper()
+	ch, err := client.Chat(context.Background(), &llm.ChatRequest{Model: model, Stream: true})
+	require.NoError(t, err)
+	var events []llm.Event
+	for ev := range ch {
+		events = append(events, ev)
+	}
+	return events
+}
+
+func eventTypes(events []llm.Event) []llm.EventType {
+	out := make([]llm.EventType, 0, len(events))
+	for _, ev := range events {
+		out = append(out, ev.Type)
+	}
+	return out
+}
+
+func TestRetryClientRetriesTransientErrors(t *testing.T) {
+	primary := &mockLLMClient{responses: []mockResponse{
+		errorResponse(503, 0),
+		{err: &llm.StatusError{StatusCode: 429, Status: "429 Too Many Requests", RetryAfter: 10 * time.Millisecond}},
+		buildTextResponse("ok"),
+	}}
+	client := NewRetryClient(primary, RetryOptions{MaxRetries: 3, BaseDelay: time.Millisecond})
+
+	events := collectLLMEvents(t, client, "m1")
+	assert.Equal(t, []llm.EventType{llm.EventRetry, llm.EventRetry, llm.EventMessageDelta, llm.EventMessageEnd}, eventTypes(events))
+	assert.Contains(t, events[1].Delta, "0.0 秒后第 2 次重试")
+	assert.Equal(t, 3, primary.callCount)
+}
+
+func TestRetryClientDoesNotRetryAfterOutputOrPermanentErrors(t *testing.T) {
+	primary := &mockLLMClient{responses: []mockResponse{
+		{events: []llm.Event{{Type: llm.EventMessageDelta, Delta: "半"}, {Type: llm.EventError, Err: &llm.StatusError{StatusCode: 503}}}},
+	}}
+	events := collectLLMEvents(t, NewRetryClient(primary, RetryOptions{MaxRetries: 3, BaseDelay: time.Millisecond}), "m1")
+	assert.Equal(t, []llm.EventType{llm.EventMessageDelta, llm.EventError}, eventTypes(events))
+	assert.Equal(t, 1, primary.callCount)
+
+	primary = &mockLLMClient{responses: []mockResponse{errorResponse(400, 0)}}
+	events = collectLLMEvents(t, NewRetryClient(primary, RetryOptions{MaxRetries: 3, BaseDelay: time.Millisecond}), "m1")
+	assert.Equal(t, []llm.EventType{llm.EventError}, eventTypes(events))
+	assert.Equal(t, 1, primary.callCount)
+}
+
+func TestRetryClientFallsBackAfterRetries(t *testing.T) {
+	primary := &mockLLMClient{responses: []mockResponse{errorResponse(500, 0), errorResponse(500, 0)}}
+	// Retry-After 超过 MaxDelay：不等待，直接换下一个
+	second := &mockLLMClient{responses: []mockResponse{errorResponse(429, time.Hour)}}
+	third := &mockLLMClient{responses: []mockResponse{buildTextResponse("来自回退模型")}}
+	var asked string
+	client := NewRetryClient(primary, RetryOptions{
+		MaxRetries: 1,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   time.Second,
+		Fallbacks: func(model string) []Fallback {
+			asked = model
+			return []Fallback{{Model: "m2", Client: second}, {Model: "m3", Client: third}}
+		},
+	})
+
+	events := collectLLMEvents(t, client, "m1")
+	assert.Equal(t, "m1", asked)
+	assert.Equal(t, []llm.EventType{llm.EventRetry, llm.EventFallback, llm.EventMessageDelta, llm.EventMessageEnd}, eventTypes(events))
+	assert.Equal(t, "m3", events[1].Model)
+	assert.Equal(t, 2, primary.callCount)
+	assert.Equal(t, 1, second.callCount)
+	require.Len(t, third.requests, 1)
+	assert.Equal(t, "m3", third.requests[0].Model)
+
+	// 回退链也耗尽时返回最后的错误
+	primary = &mockLLMClient{responses: []mockResponse{errorResponse(502, 0)}}
+	second = &mockLLMClient{responses: []mockResponse{errorResponse(503, 0)}}
+	client = NewRetryClient(primary, RetryOptions{Fallbacks: func(string) []Fallback { return []Fallback{{Model: "m2", Client: second}} }})
+	events = collectLLMEvents(t, client, "m1")
+	require.Equal(t, []llm.EventType{llm.EventError}, eventTypes(events))
+	assert.ErrorContains(t, events[0].Err, "共尝试 2 次")
+}
@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"strings"
 
 	"github.com/yangruihan/go-pi/internal/llm"
 )
@@ -11,25 +12,31 @@ import (
 type AgentEventType string
 
 const (
-	AgentEventStart      AgentEventType = "agent_start"
-	AgentEventEnd        AgentEventType = "agent_end"
-	AgentEventTurnStart  AgentEventType = "turn_start"
-	AgentEventTurnEnd    AgentEventType = "turn_end"
-	AgentEventDelta      AgentEventType = "delta"       // 文本增量
-	AgentEventToolCall   AgentEventType = "tool_call"   // 工具调用开始
-	AgentEventToolResult AgentEventType = "tool_result" // 工具调用结果
-	AgentEventError      AgentEventType = "error"
+	AgentEventStart        AgentEventType = "agent_start"
+	AgentEventEnd          AgentEventType = "agent_end"
+	AgentEventTurnStart    AgentEventType = "turn_start"
+	AgentEventTurnEnd      AgentEventType = "turn_end"
+	AgentEventDelta        AgentEventType = "delta"         // 文本增量
+	AgentEventThinking     AgentEventType = "thinking"      // 推理内容增量，与正文分开展示
+	AgentEventToolCall     AgentEventType = "tool_call"     // 工具调用开始
+	AgentEventToolResult   AgentEventType = "tool_result"   // 工具调用结果
+	AgentEventToolProgress AgentEventType = "tool_progress" // 工具执行中的实时输出片段
+	AgentEventError        AgentEventType = "error"
+	AgentEventNotice       AgentEventType = "notice"   // 不中断执行的提示（如预算预警、重试），内容在 Delta
+	AgentEventFallback     AgentEventType = "fallback" // 本轮改由回退模型应答，Model 为该模型，Delta 为提示
 )
 
 // AgentEvent Agent 输出的事件
 type AgentEvent struct {
 	Type       AgentEventType
-	Delta      string       // 文本增量
+	Delta      string       // 文本增量；thinking 时为推理内容；tool_progress 时为工具实时输出片段；notice 时为提示内容
 	ToolCallID string       // 工具调用ID
 	ToolName   string       // 工具名称
 	ToolArgs   string       // 工具参数（JSON 字符串）
 	ToolResult string       // 工具执行结果
 	Message    *llm.Message // 完整消息
+	Usage      *llm.Usage   // 本轮请求的 token 用量（turn_end 时携带，后端未返回时为 nil）
+	Model      string       // 实际应答的模型（fallback 时携带）
 	Err        error
 }
 
@@ -47,12 +54,43 @@ type ToolExecutor interface {
 	Execute(ctx context.Context, name string, args json.RawMessage) (string, error)
 }
 
+// ToolCallingMode 工具调用模式
+type ToolCallingMode string
+
+const (
+	ToolCallingAuto   ToolCallingMode = "auto"   // 原生 tools，未返回原生调用时尝试解析 ReAct 文本
+	ToolCallingNative ToolCallingMode = "native" // 仅原生 tools，不做 ReAct 兜底
+	ToolCallingReAct  ToolCallingMode = "react"  // 不发送 tools，在系统提示中注入 ReAct 工具手册
+)
+
+// ParseToolCallingMode 解析配置中的工具调用模式，未知值视为 auto
+func ParseToolCallingMode(s string) ToolCallingMode {
+	switch ToolCallingMode(strings.ToLower(strings.TrimSpace(s))) {
+	case ToolCallingNative:
+		return ToolCallingNative
+	case ToolCallingReAct:
+		return ToolCallingReAct
+	default:
+		return ToolCallingAuto
+	}
+}
+
+// StreamingToolExecutor 支持实时回传工具输出的执行器（可选实现）
+type StreamingToolExecutor interface {
+	ToolExecutor
+	ExecuteStream(ctx context.Context, name string, args json.RawMessage, onProgress func(chunk string)) (string, error)
+}
+
 // AgentLoopConfig Agent Loop 配置
 type AgentLoopConfig struct {
-	Model     string
-	Tools     []llm.Tool
-	MaxTurns  int // 最大轮次，0 表示不限制
-	SystemMsg string
+	Model       string
+	Tools       []llm.Tool
+	MaxTurns    int // 最大轮次，0 表示不限制
+	SystemMsg   string
+	ToolCalling ToolCallingMode        // 空值等同 auto
+	Options     *llm.GenerationOptions // 生成参数，nil 表示使用后端默认值
+	// KeepThinking 为 true 时历史中 assistant 的推理内容随请求发回模型，默认不发送
+	KeepThinking bool
 }
 
 // DefaultLoopConfig 返回默认配置
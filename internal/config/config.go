@@ -12,25 +12,44 @@ import (
 
 // Config 全局配置
 type Config struct {
-	Ollama  OllamaConfig     `yaml:"ollama"`
-	LLM     LLMConfig        `yaml:"llm"`
-	Context ContextConfig    `yaml:"context"`
-	Tools   ToolsConfig      `yaml:"tools"`
-	TUI     TUIConfig        `yaml:"tui"`
-	Prompt  PromptConfig     `yaml:"prompt"`
-	Ext     ExtensionsConfig `yaml:"extensions"`
+	Ollama  OllamaConfig      `yaml:"ollama"`
+	LLM     LLMConfig         `yaml:"llm"`
+	Context ContextConfig     `yaml:"context"`
+	Tools   ToolsConfig       `yaml:"tools"`
+	TUI     TUIConfig         `yaml:"tui"`
+	Prompt  PromptConfig      `yaml:"prompt"`
+	Ext     ExtensionsConfig  `yaml:"extensions"`
+	Perm    PermissionsConfig `yaml:"permissions"`
+	Budget  BudgetConfig      `yaml:"budget"`
+}
+
+// BudgetConfig 单个会话的用量预算，0 表示不限制；
+// 费用按 models.yaml 中的价格计算，未配置价格的模型不计入费用
+type BudgetConfig struct {
+	WarnTokens int     `yaml:"warn_tokens"` // 累计 token 达到后提示一次
+	MaxTokens  int     `yaml:"max_tokens"`  // 累计 token 达到后拒绝发起新的模型请求
+	WarnCost   float64 `yaml:"warn_cost"`   // 累计费用达到后提示一次
+	MaxCost    float64 `yaml:"max_cost"`    // 累计费用达到后拒绝发起新的模型请求
 }
 
 // PromptConfig 系统提示词模板配置
 type PromptConfig struct {
-	TemplateFile string `yaml:"template_file"`
+	TemplateFile string        `yaml:"template_file"`
+	RepoMap      RepoMapConfig `yaml:"repo_map"`
+}
+
+// RepoMapConfig 仓库概览（目录结构 + 主要符号）注入配置
+type RepoMapConfig struct {
+	Enabled   bool `yaml:"enabled"`
+	MaxTokens int  `yaml:"max_tokens"`
 }
 
 // LLMConfig 通用 LLM 配置（支持 OpenAI 兼容后端）
 type LLMConfig struct {
-	Provider string `yaml:"provider"` // ollama | openai
-	BaseURL  string `yaml:"base_url"`
-	APIKey   string `yaml:"api_key"`
+	Provider   string `yaml:"provider"` // ollama | openai
+	BaseURL    string `yaml:"base_url"`
+	APIKey     string `yaml:"api_key"`
+	MaxRetries int    `yaml:"max_retries"` // 429 / 5xx 等临时故障的重试次数，0 表示不重试
 }
 
 // OllamaConfig Ollama 连接配置
@@ -46,6 +65,7 @@ type ContextConfig struct {
 	MaxTokens           int     `yaml:"max_tokens"`
 	CompactionThreshold float64 `yaml:"compaction_threshold"`
 	KeepRecent          int     `yaml:"keep_recent"`
+	KeepThinking        bool    `yaml:"keep_thinking"` // 是否把历史中的推理内容发回模型，默认不发送
 }
 
 // ToolsConfig 工具配置
@@ -54,6 +74,17 @@ type ToolsConfig struct {
 	BashMaxOutput  int           `yaml:"bash_max_output"`
 	ReadMaxLines   int           `yaml:"read_max_lines"`
 	GrepMaxMatches int           `yaml:"grep_max_matches"`
+	FindMaxResults int           `yaml:"find_max_results"`
+	Sandbox        SandboxConfig `yaml:"sandbox"`
+}
+
+// SandboxConfig 文件工具的工作区限制与 bash 受限环境
+type SandboxConfig struct {
+	Enabled      bool     `yaml:"enabled"`        // 是否限制文件工具只能访问工作区
+	ExtraRoots   []string `yaml:"extra_roots"`    // 除会话工作目录外允许访问的目录
+	DenyPaths    []string `yaml:"deny_paths"`     // 始终拒绝的路径（目录前缀或 glob，支持 ~）
+	MaxFileBytes int64    `yaml:"max_file_bytes"` // 文件工具读写的单文件大小上限
+	RestrictBash bool     `yaml:"restrict_bash"`  // bash / 后台任务使用精简环境变量，并在可用时断开网络
 }
 
 // TUIConfig TUI 配置
@@ -65,15 +96,42 @@ type TUIConfig struct {
 
 // ExtensionsConfig 扩展配置
 type ExtensionsConfig struct {
-	ToolFiles     []string `yaml:"tool_files"`
-	BeforePrompt  string   `yaml:"before_prompt"`
-	AfterResponse string   `yaml:"after_response"`
+	ToolFiles     []string                   `yaml:"tool_files"`
+	BeforePrompt  string                     `yaml:"before_prompt"`
+	AfterResponse string                     `yaml:"after_response"`
+	MCPServers    map[string]MCPServerConfig `yaml:"mcp_servers"`
+}
+
+// MCPServerConfig 通过 stdio 启动的 MCP 服务器
+type MCPServerConfig struct {
+	Command    string            `yaml:"command"`
+	Args       []string          `yaml:"args"`
+	Env        map[string]string `yaml:"env"`
+	TimeoutSec int               `yaml:"timeout_sec"` // 单次工具调用超时，默认 60 秒
+	Disabled   bool              `yaml:"disabled"`
+}
+
+// PermissionsConfig 工具调用权限配置
+type PermissionsConfig struct {
+	Default        string            `yaml:"default"`         // 未单独配置的工具：allow | ask | deny
+	NonInteractive string            `yaml:"non_interactive"` // 无法交互确认时（--print / SDK）ask 的处理：allow | deny
+	Tools          map[string]string `yaml:"tools"`           // 工具名（可用 * 结尾匹配前缀，如 mcp__*）-> allow | ask | deny
+	Rules          []PermissionRule  `yaml:"rules"`
+}
+
+// PermissionRule 按参数匹配的权限规则，deny 规则优先，其余按声明顺序首个命中生效
+type PermissionRule struct {
+	Tool   string `yaml:"tool"`
+	Arg    string `yaml:"arg"`    // 匹配的参数名，留空时依次尝试 command / path / pattern
+	Match  string `yaml:"match"`  // 正则表达式
+	Action string `yaml:"action"` // allow | ask | deny
 }
 
 // LoadSources 记录配置加载来源
 type LoadSources struct {
 	ConfigPaths []string
 	ModelPaths  []string
+	Ignored     []string // 项目配置中因放宽权限或沙箱而被忽略的设置
 }
 
 var projectAIDirs = []string{".gopi", ".claude", ".pi"}
@@ -88,9 +146,10 @@ func Default() Config {
 			ToolCalling: "auto",
 		},
 		LLM: LLMConfig{
-			Provider: "ollama",
-			BaseURL:  "",
-			APIKey:   "",
+			Provider:   "ollama",
+			BaseURL:    "",
+			APIKey:     "",
+			MaxRetries: 3,
 		},
 		Context: ContextConfig{
 			MaxTokens:           32768,
@@ -102,6 +161,12 @@ func Default() Config {
 			BashMaxOutput:  8192,
 			ReadMaxLines:   500,
 			GrepMaxMatches: 50,
+			FindMaxResults: 200,
+			Sandbox: SandboxConfig{
+				Enabled:      true,
+				DenyPaths:    []string{"~/.ssh", "~/.gnupg", "~/.aws"},
+				MaxFileBytes: 10 * 1024 * 1024,
+			},
 		},
 		TUI: TUIConfig{
 			Theme:          "dark",
@@ -110,12 +175,29 @@ func Default() Config {
 		},
 		Prompt: PromptConfig{
 			TemplateFile: "",
+			RepoMap: RepoMapConfig{
+				Enabled:   false,
+				MaxTokens: 1024,
+			},
 		},
 		Ext: ExtensionsConfig{
 			ToolFiles:     nil,
 			BeforePrompt:  "",
 			AfterResponse: "",
 		},
+		Perm: PermissionsConfig{
+			Default:        "allow",
+			NonInteractive: "deny",
+			Tools: map[string]string{
+				"bash":        "ask",
+				"write_file":  "ask",
+				"edit_file":   "ask",
+				"apply_patch": "ask",
+				"job_start":   "ask",
+				"job_input":   "ask",
+				"mcp__*":      "ask", // MCP 工具由外部服务器提供，默认逐次确认
+			},
+		},
 	}
 }
 
@@ -172,32 +254,44 @@ func LoadWithSources(cwd string) (Config, LoadSources, error) {
 	}
 
 	for _, projectCfg := range ProjectConfigPaths(cwd) {
-		if loaded, err := mergeConfigFile(&cfg, projectCfg); err != nil {
+		loaded, ignored, err := mergeProjectConfigFile(&cfg, projectCfg)
+		if err != nil {
 			return cfg, sources, err
-		} else if loaded {
+		}
+		if loaded {
 			sources.ConfigPaths = append(sources.ConfigPaths, projectCfg)
 		}
+		sources.Ignored = append(sources.Ignored, ignored...)
 	}
 
 	return cfg, sources, nil
 }
 
 func mergeConfigFile(cfg *Config, path string) (bool, error) {
+	data, loaded, err := readConfigFile(path)
+	if err != nil || !loaded {
+		return loaded, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return false, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// readConfigFile 读取并规范化配置文件，文件不存在时返回 false
+func readConfigFile(path string) ([]byte, bool, error) {
 	data, err := os.ReadFile(path)
 	if os.IsNotExist(err) {
-		return false, nil
+		return nil, false, nil
 	}
 	if err != nil {
-		return false, fmt.Errorf("read config %s: %w", path, err)
+		return nil, false, fmt.Errorf("read config %s: %w", path, err)
 	}
 	data, err = normalizeYAMLBytes(data)
 	if err != nil {
-		return false, fmt.Errorf("decode config %s: %w", path, err)
-	}
-	if err := yaml.Unmarshal(data, cfg); err != nil {
-		return false, fmt.Errorf("parse config %s: %w", path, err)
+		return nil, false, fmt.Errorf("decode config %s: %w", path, err)
 	}
-	return true, nil
+	return data, true, nil
 }
 
 // Save 保存配置到默认路径
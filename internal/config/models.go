@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/yangruihan/go-pi/internal/llm"
 	"gopkg.in/yaml.v3"
 )
 
@@ -21,12 +22,20 @@ import (
 //     model: deepseek-chat
 //     base_url: https://api.deepseek.com
 //     api_key_env: DEEPSEEK_API_KEY
+//     input_price: 2    # 每百万输入 token 价格
+//     output_price: 8   # 每百万输出 token 价格
+//     fallback: [qwen3] # 临时故障重试耗尽后依次改用的模型别名
+//     options: {temperature: 0.2, max_tokens: 4096} # 生成参数，可被 /set 覆盖
 type ModelProfile struct {
-	Name      string `yaml:"name"`
-	Provider  string `yaml:"provider"`
-	Model     string `yaml:"model"`
-	BaseURL   string `yaml:"base_url"`
-	APIKeyEnv string `yaml:"api_key_env"`
+	Name        string                `yaml:"name"`
+	Provider    string                `yaml:"provider"`
+	Model       string                `yaml:"model"`
+	BaseURL     string                `yaml:"base_url"`
+	APIKeyEnv   string                `yaml:"api_key_env"`
+	InputPrice  float64               `yaml:"input_price"`  // 每百万输入 token 价格，0 表示未配置
+	OutputPrice float64               `yaml:"output_price"` // 每百万输出 token 价格，0 表示未配置
+	Fallback    []string              `yaml:"fallback"`     // 回退链：模型别名，未定义别名时视为同一后端的模型名
+	Options     llm.GenerationOptions `yaml:"options"`
 }
 
 type modelsFile struct {
@@ -131,6 +140,13 @@ func loadProfilesFile(path string) ([]ModelProfile, bool, error) {
 		m.Model = strings.TrimSpace(m.Model)
 		m.BaseURL = strings.TrimSpace(m.BaseURL)
 		m.APIKeyEnv = strings.TrimSpace(m.APIKeyEnv)
+		fallback := m.Fallback[:0]
+		for _, f := range m.Fallback {
+			if f = strings.TrimSpace(f); f != "" {
+				fallback = append(fallback, f)
+			}
+		}
+		m.Fallback = fallback
 		if m.Name == "" || m.Model == "" {
 			continue
 		}
@@ -179,6 +195,44 @@ func ResolveModelProfile(input string, profiles []ModelProfile) (ModelProfile, b
 	return ModelProfile{}, false
 }
 
+// HasPricing 是否配置了价格
+func (m ModelProfile) HasPricing() bool {
+	return m.InputPrice > 0 || m.OutputPrice > 0
+}
+
+// Cost 按每百万 token 价格计算一次请求的费用
+func (m ModelProfile) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*m.InputPrice + float64(completionTokens)*m.OutputPrice) / 1e6
+}
+
+// FindModelProfile 按别名或实际模型名查找模型配置，别名优先
+func FindModelProfile(model string, profiles []ModelProfile) (ModelProfile, bool) {
+	if p, ok := ResolveModelProfile(model, profiles); ok {
+		return p, true
+	}
+	needle := strings.TrimSpace(model)
+	for _, p := range profiles {
+		if needle != "" && p.Model == needle {
+			return p, true
+		}
+	}
+	return ModelProfile{}, false
+}
+
+// ResolveModelPricing 按别名或实际模型名查找配置了价格的模型
+func ResolveModelPricing(model string, profiles []ModelProfile) (ModelProfile, bool) {
+	needle := strings.TrimSpace(model)
+	if needle == "" {
+		return ModelProfile{}, false
+	}
+	for _, p := range profiles {
+		if p.HasPricing() && (p.Model == needle || p.Name == needle) {
+			return p, true
+		}
+	}
+	return ModelProfile{}, false
+}
+
 func (m ModelProfile) ResolveAPIKey() (string, error) {
 	if m.APIKeyEnv == "" {
 		return "", nil
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// projectSafety 项目级配置中的安全相关字段；指针用于区分未设置与显式取值
+type projectSafety struct {
+	Perm struct {
+		Default        *string           `yaml:"default"`
+		NonInteractive *string           `yaml:"non_interactive"`
+		Tools          map[string]string `yaml:"tools"`
+		Rules          []PermissionRule  `yaml:"rules"`
+	} `yaml:"permissions"`
+	Tools struct {
+		Sandbox struct {
+			Enabled      *bool    `yaml:"enabled"`
+			ExtraRoots   []string `yaml:"extra_roots"`
+			DenyPaths    []string `yaml:"deny_paths"`
+			MaxFileBytes *int64   `yaml:"max_file_bytes"`
+			RestrictBash *bool    `yaml:"restrict_bash"`
+		} `yaml:"sandbox"`
+	} `yaml:"tools"`
+	Ext struct {
+		MCPServers    map[string]any `yaml:"mcp_servers"`
+		BeforePrompt  *string        `yaml:"before_prompt"`
+		AfterResponse *string        `yaml:"after_response"`
+	} `yaml:"extensions"`
+}
+
+// mergeProjectConfigFile 合并项目级配置。项目目录可能来自不受信任的仓库，
+// 因此 permissions 与 tools.sandbox 只接受收紧的设置，放宽的设置被忽略并返回说明；
+// 会自动执行命令的 extensions.mcp_servers 与 before_prompt / after_response 钩子也被忽略。
+// 这些设置需写在用户目录配置（~/.gopi/config.yaml）中
+func mergeProjectConfigFile(cfg *Config, path string) (bool, []string, error) {
+	data, loaded, err := readConfigFile(path)
+	if err != nil || !loaded {
+		return loaded, nil, err
+	}
+	perm := clonePermissions(cfg.Perm)
+	sandbox := cloneSandbox(cfg.Tools.Sandbox)
+	ext := cloneExtensions(cfg.Ext)
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return false, nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	cfg.Perm, cfg.Tools.Sandbox = perm, sandbox
+	cfg.Ext.MCPServers, cfg.Ext.BeforePrompt, cfg.Ext.AfterResponse = ext.MCPServers, ext.BeforePrompt, ext.AfterResponse
+
+	var safety projectSafety
+	if err := yaml.Unmarshal(data, &safety); err != nil {
+		return false, nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	ignored := applyProjectSafety(cfg, safety)
+	for i := range ignored {
+		ignored[i] = fmt.Sprintf("%s: %s（项目配置只能收紧权限与沙箱，已忽略）", path, ignored[i])
+	}
+	for _, name := range sortedKeys(safety.Ext.MCPServers) {
+		ignored = append(ignored, fmt.Sprintf("%s: extensions.mcp_servers.%s（MCP 服务器只能在用户目录配置中声明，已忽略）", path, name))
+	}
+	if safety.Ext.BeforePrompt != nil && strings.TrimSpace(*safety.Ext.BeforePrompt) != "" {
+		ignored = append(ignored, fmt.Sprintf("%s: extensions.before_prompt（钩子只能在用户目录配置中声明，已忽略）", path))
+	}
+	if safety.Ext.AfterResponse != nil && strings.TrimSpace(*safety.Ext.AfterResponse) != "" {
+		ignored = append(ignored, fmt.Sprintf("%s: extensions.after_response（钩子只能在用户目录配置中声明，已忽略）", path))
+	}
+	return true, ignored, nil
+}
+
+func applyProjectSafety(cfg *Config, s projectSafety) []string {
+	var ignored []string
+	p := &cfg.Perm
+
+	if v := s.Perm.Default; v != nil {
+		if modeStricter(*v, p.Default) {
+			p.Default = *v
+		} else if !strings.EqualFold(strings.TrimSpace(*v), strings.TrimSpace(p.Default)) {
+			ignored = append(ignored, "permissions.default: "+*v)
+		}
+	}
+	if v := s.Perm.NonInteractive; v != nil {
+		if modeStricter(*v, p.NonInteractive) {
+			p.NonInteractive = *v
+		} else if !strings.EqualFold(strings.TrimSpace(*v), strings.TrimSpace(p.NonInteractive)) {
+			ignored = append(ignored, "permissions.non_interactive: "+*v)
+		}
+	}
+	for name, v := range s.Perm.Tools {
+		current, ok := p.Tools[name]
+		if !ok {
+			current = p.Default
+		}
+		if modeStricter(v, current) {
+			if p.Tools == nil {
+				p.Tools = map[string]string{}
+			}
+			p.Tools[name] = v
+		} else if !strings.EqualFold(strings.TrimSpace(v), strings.TrimSpace(current)) {
+			ignored = append(ignored, fmt.Sprintf("permissions.tools.%s: %s", name, v))
+		}
+	}
+	// 项目规则排在用户规则之前，使其 ask 规则先于用户的 allow 规则命中；allow 规则不接受
+	var rules []PermissionRule
+	for _, r := range s.Perm.Rules {
+		if strings.EqualFold(strings.TrimSpace(r.Action), "allow") {
+			ignored = append(ignored, fmt.Sprintf("permissions.rules: allow %q", r.Match))
+			continue
+		}
+		rules = append(rules, r)
+	}
+	if len(rules) > 0 {
+		p.Rules = append(rules, p.Rules...)
+	}
+
+	sb := &cfg.Tools.Sandbox
+	if v := s.Tools.Sandbox.Enabled; v != nil {
+		if *v {
+			sb.Enabled = true
+		} else if sb.Enabled {
+			ignored = append(ignored, "tools.sandbox.enabled: false")
+		}
+	}
+	if len(s.Tools.Sandbox.ExtraRoots) > 0 {
+		ignored = append(ignored, "tools.sandbox.extra_roots: "+strings.Join(s.Tools.Sandbox.ExtraRoots, ", "))
+	}
+	sb.DenyPaths = append(sb.DenyPaths, s.Tools.Sandbox.DenyPaths...)
+	if v := s.Tools.Sandbox.MaxFileBytes; v != nil {
+		if *v > 0 && (sb.MaxFileBytes <= 0 || *v < sb.MaxFileBytes) {
+			sb.MaxFileBytes = *v
+		} else if *v != sb.MaxFileBytes {
+			ignored = append(ignored, fmt.Sprintf("tools.sandbox.max_file_bytes: %d", *v))
+		}
+	}
+	if v := s.Tools.Sandbox.RestrictBash; v != nil {
+		if *v {
+			sb.RestrictBash = true
+		} else if sb.RestrictBash {
+			ignored = append(ignored, "tools.sandbox.restrict_bash: false")
+		}
+	}
+	return ignored
+}
+
+// modeStricter 判断权限模式 a 是否比 b 更严格（allow < ask < deny）；无法识别的 a 视为不更严格
+func modeStricter(a, b string) bool {
+	rank := func(m string) int {
+		switch strings.ToLower(strings.TrimSpace(m)) {
+		case "deny":
+			return 2
+		case "ask":
+			return 1
+		case "allow", "":
+			return 0
+		}
+		return -1
+	}
+	ra := rank(a)
+	return ra >= 0 && ra > rank(b)
+}
+
+func clonePermissions(p PermissionsConfig) PermissionsConfig {
+	out := p
+	if p.Tools != nil {
+		out.Tools = make(map[string]string, len(p.Tools))
+		for k, v := range p.Tools {
+			out.Tools[k] = v
+		}
+	}
+	out.Rules = append([]PermissionRule(nil), p.Rules...)
+	return out
+}
+
+func cloneExtensions(e ExtensionsConfig) ExtensionsConfig {
+	out := e
+	if e.MCPServers != nil {
+		out.MCPServers = make(map[string]MCPServerConfig, len(e.MCPServers))
+		for k, v := range e.MCPServers {
+			out.MCPServers[k] = v
+		}
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func cloneSandbox(s SandboxConfig) SandboxConfig {
+	out := s
+	out.ExtraRoots = append([]string(nil), s.ExtraRoots...)
+	out.DenyPaths = append([]string(nil), s.DenyPaths...)
+	return out
+}
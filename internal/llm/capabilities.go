@@ -0,0 +1,60 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	ollamaapi "github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+// ToolSupportProber 可探测模型是否支持原生工具调用的客户端
+type ToolSupportProber interface {
+	SupportsTools(ctx context.Context, model string) (bool, error)
+}
+
+// SupportsTools 通过 /api/show 查询模型能力，结果按模型缓存
+// 旧版 Ollama 不返回 capabilities 时视为支持（保留 ReAct 兜底解析）
+func (c *Client) SupportsTools(ctx context.Context, modelName string) (bool, error) {
+	modelName = strings.TrimSpace(modelName)
+	c.capMu.Lock()
+	if v, ok := c.toolSupport[modelName]; ok {
+		c.capMu.Unlock()
+		return v, nil
+	}
+	c.capMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	resp, err := c.api.Show(ctx, &ollamaapi.ShowRequest{Model: modelName})
+	if err != nil {
+		return false, fmt.Errorf("show model %s: %w", modelName, err)
+	}
+
+	supported := len(resp.Capabilities) == 0
+	for _, capability := range resp.Capabilities {
+		if capability == model.CapabilityTools {
+			supported = true
+			break
+		}
+	}
+
+	c.capMu.Lock()
+	if c.toolSupport == nil {
+		c.toolSupport = make(map[string]bool)
+	}
+	c.toolSupport[modelName] = supported
+	c.capMu.Unlock()
+	return supported, nil
+}
+
+// IsToolsUnsupportedError 判断错误是否为“模型不支持工具调用”
+func IsToolsUnsupportedError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "does not support tools")
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	ollamaapi "github.com/ollama/ollama/api"
@@ -15,6 +16,9 @@ import (
 type Client struct {
 	api  *ollamaapi.Client
 	host string
+
+	capMu       sync.Mutex
+	toolSupport map[string]bool // 模型 -> 是否支持原生工具调用
 }
 
 // NewClient 创建新的 Ollama 客户端
@@ -0,0 +1,97 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	ollamaapi "github.com/ollama/ollama/api"
+)
+
+// StatusError OpenAI 兼容后端返回的非 2xx 响应
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+	RetryAfter time.Duration // 来自 Retry-After 响应头，未提供时为 0
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("openai request failed: %s (%s)", e.Status, e.Body)
+}
+
+// newStatusError 读取响应体（最多 8KB）构造 StatusError
+func newStatusError(resp *http.Response) *StatusError {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 8192))
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       strings.TrimSpace(string(data)),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter 解析 Retry-After：秒数或 HTTP 日期
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// IsTransientError 判断错误是否为可重试的临时故障：
+// 限流（429）、超时（408）、服务端 5xx 过载与网关错误，以及连接被拒绝或中断
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return isTransientStatus(se.StatusCode)
+	}
+	var oe ollamaapi.StatusError
+	if errors.As(err, &oe) {
+		return isTransientStatus(oe.StatusCode)
+	}
+	var ne *net.OpError
+	if errors.As(err, &ne) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+func isTransientStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+		529: // 部分网关的 overloaded
+		return true
+	}
+	return false
+}
+
+// RetryAfterHint 返回后端要求的最短重试等待时间，未提供时为 0
+func RetryAfterHint(err error) time.Duration {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.RetryAfter
+	}
+	return 0
+}
@@ -4,10 +4,14 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -77,56 +81,27 @@ func (c *OpenAIClient) PingWithRetry(ctx context.Context, maxRetries int) error
 }
 
 func (c *OpenAIClient) Chat(ctx context.Context, req *ChatRequest) (<-chan Event, error) {
-	type oaTool struct {
-		Type     string `json:"type"`
-		Function struct {
-			Name        string         `json:"name"`
-			Description string         `json:"description,omitempty"`
-			Parameters  map[string]any `json:"parameters,omitempty"`
-		} `json:"function"`
-	}
-	type oaReqMessage struct {
-		Role       string `json:"role"`
-		Content    string `json:"content,omitempty"`
-		ToolCallID string `json:"tool_call_id,omitempty"`
-	}
-	type oaRequest struct {
-		Model    string         `json:"model"`
-		Messages []oaReqMessage `json:"messages"`
-		Tools    []oaTool       `json:"tools,omitempty"`
-		Stream   bool           `json:"stream"`
-	}
-	type oaResp struct {
-		Choices []struct {
-			Message struct {
-				Role      string `json:"role"`
-				Content   string `json:"content"`
-				ToolCalls []struct {
-					ID       string `json:"id"`
-					Type     string `json:"type"`
-					Function struct {
-						Name      string `json:"name"`
-						Arguments string `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_calls"`
-			} `json:"message"`
-		} `json:"choices"`
-	}
 	ch := make(chan Event, 32)
 
-	body := oaRequest{Model: req.Model, Stream: false}
-	body.Messages = make([]oaReqMessage, 0, len(req.Messages))
-	for _, m := range req.Messages {
-		body.Messages = append(body.Messages, oaReqMessage{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID})
+	body := oaRequest{Model: req.Model, Stream: req.Stream}
+	if req.Stream {
+		// 请求在流末尾返回 token 用量
+		body.StreamOptions = &oaStreamOptions{IncludeUsage: true}
+	}
+	if o := req.Options; o != nil {
+		// num_ctx / keep_alive / think 为 Ollama 专有参数，OpenAI 兼容接口忽略
+		body.Temperature, body.TopP, body.MaxTokens, body.Stop, body.Seed = o.Temperature, o.TopP, o.MaxTokens, o.Stop, o.Seed
 	}
+	body.Messages = convertOpenAIMessages(req.Messages)
 	if len(req.Tools) > 0 {
 		body.Tools = make([]oaTool, 0, len(req.Tools))
 		for _, t := range req.Tools {
 			ot := oaTool{Type: t.Type}
 			ot.Function.Name = t.Function.Name
 			ot.Function.Description = t.Function.Description
-			if len(t.Function.Parameters) > 0 {
-				_ = json.Unmarshal(t.Function.Parameters, &ot.Function.Parameters)
+			if json.Valid(t.Function.Parameters) {
+				// 原样传递 JSON Schema（含 items / oneOf / default 等）
+				ot.Function.Parameters = t.Function.Parameters
 			}
 			body.Tools = append(body.Tools, ot)
 		}
@@ -139,62 +114,301 @@ func (c *OpenAIClient) Chat(ctx context.Context, req *ChatRequest) (<-chan Event
 
 	go func() {
 		defer close(ch)
-		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/chat/completions", bytes.NewReader(payload))
-		if err != nil {
-			ch <- Event{Type: EventError, Err: err}
-			return
-		}
-		httpReq.Header.Set("Content-Type", "application/json")
-		if c.apiKey != "" {
-			httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+		resp, err := c.post(ctx, payload, req.Stream)
+		if err == nil && resp.StatusCode == http.StatusBadRequest && body.StreamOptions != nil {
+			// 不支持 stream_options 的兼容服务端：去掉后重试一次（此时无法获得用量）
+			statusErr := newStatusError(resp)
+			resp.Body.Close()
+			if !strings.Contains(statusErr.Body, "stream_options") {
+				ch <- Event{Type: EventError, Err: statusErr}
+				return
+			}
+			body.StreamOptions = nil
+			if payload, err = json.Marshal(body); err == nil {
+				resp, err = c.post(ctx, payload, req.Stream)
+			}
 		}
-		resp, err := c.http.Do(httpReq)
 		if err != nil {
 			ch <- Event{Type: EventError, Err: err}
 			return
 		}
 		defer resp.Body.Close()
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			data, _ := io.ReadAll(io.LimitReader(resp.Body, 8192))
-			ch <- Event{Type: EventError, Err: fmt.Errorf("openai request failed: %s (%s)", resp.Status, strings.TrimSpace(string(data)))}
+			ch <- Event{Type: EventError, Err: newStatusError(resp)}
 			return
 		}
 
-		data, err := io.ReadAll(bufio.NewReader(resp.Body))
-		if err != nil {
-			ch <- Event{Type: EventError, Err: err}
-			return
-		}
-		var parsed oaResp
-		if err := json.Unmarshal(data, &parsed); err != nil {
-			ch <- Event{Type: EventError, Err: fmt.Errorf("parse openai response: %w", err)}
-			return
-		}
-		if len(parsed.Choices) == 0 {
-			ch <- Event{Type: EventError, Err: fmt.Errorf("openai response has no choices")}
+		// 部分网关会忽略 stream 参数直接返回 JSON，按 Content-Type 选择解析方式
+		if req.Stream && !strings.Contains(resp.Header.Get("Content-Type"), "application/json") {
+			if err := readOpenAIStream(ctx, resp.Body, ch); err != nil && ctx.Err() == nil {
+				ch <- Event{Type: EventError, Err: err}
+			}
 			return
 		}
+		readOpenAIResponse(resp.Body, ch)
+	}()
+
+	return ch, nil
+}
+
+// post 发送 chat/completions 请求
+func (c *OpenAIClient) post(ctx context.Context, payload []byte, stream bool) (*http.Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	return c.http.Do(httpReq)
+}
+
+type oaTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+// oaReqMessage 请求消息；Content 为 string、[]oaContentPart 或 nil（仅调用工具时发送 null）
+type oaReqMessage struct {
+	Role       string          `json:"role"`
+	Content    any             `json:"content"`
+	Reasoning  string          `json:"reasoning_content,omitempty"`
+	Name       string          `json:"name,omitempty"`
+	ToolCalls  []oaReqToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+}
+
+type oaReqToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type oaContentPart struct {
+	Type     string      `json:"type"`
+	Text     string      `json:"text,omitempty"`
+	ImageURL *oaImageURL `json:"image_url,omitempty"`
+}
+
+type oaImageURL struct {
+	URL string `json:"url"`
+}
+
+type oaRequest struct {
+	Model         string           `json:"model"`
+	Messages      []oaReqMessage   `json:"messages"`
+	Tools         []oaTool         `json:"tools,omitempty"`
+	Stream        bool             `json:"stream"`
+	StreamOptions *oaStreamOptions `json:"stream_options,omitempty"`
+	Temperature   *float64         `json:"temperature,omitempty"`
+	TopP          *float64         `json:"top_p,omitempty"`
+	MaxTokens     int              `json:"max_tokens,omitempty"`
+	Stop          []string         `json:"stop,omitempty"`
+	Seed          *int             `json:"seed,omitempty"`
+}
+
+type oaStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type oaUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u *oaUsage) toUsage() *Usage {
+	if u == nil || (u.PromptTokens == 0 && u.CompletionTokens == 0) {
+		return nil
+	}
+	return &Usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens}
+}
+
+type oaToolCall struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type oaError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    any    `json:"code"`
+}
+
+type oaResp struct {
+	Choices []struct {
+		Message struct {
+			Role             string       `json:"role"`
+			Content          string       `json:"content"`
+			ReasoningContent string       `json:"reasoning_content"`
+			Reasoning        string       `json:"reasoning"`
+			ToolCalls        []oaToolCall `json:"tool_calls"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage *oaUsage `json:"usage,omitempty"`
+	Error *oaError `json:"error,omitempty"`
+}
+
+// readOpenAIResponse 解析非流式响应（stream=false 或网关不支持 SSE）
+func readOpenAIResponse(r io.Reader, ch chan<- Event) {
+	data, err := io.ReadAll(bufio.NewReader(r))
+	if err != nil {
+		ch <- Event{Type: EventError, Err: err}
+		return
+	}
+	var parsed oaResp
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		ch <- Event{Type: EventError, Err: fmt.Errorf("parse openai response: %w", err)}
+		return
+	}
+	if parsed.Error != nil {
+		ch <- Event{Type: EventError, Err: parsed.Error.toError()}
+		return
+	}
+	if len(parsed.Choices) == 0 {
+		ch <- Event{Type: EventError, Err: fmt.Errorf("openai response has no choices")}
+		return
+	}
+
+	msg := parsed.Choices[0].Message
+	toolCalls := make([]ToolCall, 0, len(msg.ToolCalls))
+	for _, tc := range msg.ToolCalls {
+		call := tc.toToolCall()
+		toolCalls = append(toolCalls, call)
+		ch <- Event{Type: EventToolCallStart, Tool: &call}
+	}
+
+	thinking, content := splitThinking(msg.Content)
+	if reasoning := strings.TrimSpace(msg.ReasoningContent + msg.Reasoning); reasoning != "" {
+		thinking = reasoning
+	}
+	if thinking != "" {
+		ch <- Event{Type: EventThinkingDelta, Delta: thinking}
+	}
+	if content != "" {
+		ch <- Event{Type: EventMessageDelta, Delta: content}
+	}
+	ch <- Event{Type: EventMessageEnd, Message: &Message{Role: "assistant", Content: content, Thinking: thinking, ToolCalls: toolCalls}, Usage: parsed.Usage.toUsage()}
+}
+
+func (tc oaToolCall) toToolCall() ToolCall {
+	callType := tc.Type
+	if callType == "" {
+		callType = "function"
+	}
+	id := tc.ID
+	if id == "" {
+		id = NewToolCallID()
+	}
+	return ToolCall{
+		ID:   id,
+		Type: callType,
+		Function: ToolCallFunction{
+			Name:      tc.Function.Name,
+			Arguments: tc.Function.Arguments,
+		},
+	}
+}
 
-		msg := parsed.Choices[0].Message
-		toolCalls := make([]ToolCall, 0, len(msg.ToolCalls))
-		for _, tc := range msg.ToolCalls {
-			call := ToolCall{
-				ID:   tc.ID,
-				Type: tc.Type,
-				Function: ToolCallFunction{
-					Name:      tc.Function.Name,
-					Arguments: tc.Function.Arguments,
-				},
+func (e *oaError) toError() error {
+	msg := strings.TrimSpace(e.Message)
+	if msg == "" {
+		msg = "unknown error"
+	}
+	if e.Type != "" {
+		return fmt.Errorf("openai error (%s): %s", e.Type, msg)
+	}
+	return fmt.Errorf("openai error: %s", msg)
+}
+
+// convertOpenAIMessages 将内部 Message 转换为 OpenAI chat/completions 请求格式：
+// assistant 保留 tool_calls，tool 结果带上对应调用的 tool_call_id 与 name，图片转为多模态 content。
+// 推理内容以 reasoning_content 发送；DeepSeek 等后端会拒绝该字段，调用方未开启 keep_thinking 时应先去掉 Thinking
+func convertOpenAIMessages(msgs []Message) []oaReqMessage {
+	out := make([]oaReqMessage, 0, len(msgs))
+	callNames := make(map[string]string)
+	for _, m := range msgs {
+		om := oaReqMessage{Role: m.Role}
+		switch m.Role {
+		case "assistant":
+			for _, tc := range m.ToolCalls {
+				rc := oaReqToolCall{ID: tc.ID, Type: tc.Type}
+				if rc.Type == "" {
+					rc.Type = "function"
+				}
+				rc.Function.Name = tc.Function.Name
+				rc.Function.Arguments = tc.Function.Arguments
+				if strings.TrimSpace(rc.Function.Arguments) == "" {
+					rc.Function.Arguments = "{}"
+				}
+				om.ToolCalls = append(om.ToolCalls, rc)
+				callNames[tc.ID] = tc.Function.Name
+			}
+			if m.Content != "" || len(om.ToolCalls) == 0 {
+				om.Content = m.Content
+			}
+			om.Reasoning = m.Thinking
+		case "tool":
+			name, ok := callNames[m.ToolCallID]
+			if m.ToolCallID == "" || !ok {
+				// 找不到对应调用的工具结果会被严格网关拒绝，降级为普通上下文
+				om.Role = "user"
+				om.Content = "[工具结果]\n" + m.Content
+				break
+			}
+			om.ToolCallID = m.ToolCallID
+			om.Name = name
+			om.Content = m.Content
+		default:
+			om.Content = m.Content
+			if parts := buildOpenAIContentParts(m.Content, m.Images); len(parts) > 0 {
+				om.Content = parts
 			}
-			toolCalls = append(toolCalls, call)
-			ch <- Event{Type: EventToolCallStart, Tool: &call}
 		}
+		out = append(out, om)
+	}
+	return out
+}
 
-		if msg.Content != "" {
-			ch <- Event{Type: EventMessageDelta, Delta: msg.Content}
+// buildOpenAIContentParts 将文本与图片组合成多模态 content；无可用图片时返回 nil
+func buildOpenAIContentParts(text string, images []string) []oaContentPart {
+	var imageParts []oaContentPart
+	for _, p := range images {
+		if p == "" {
+			continue
 		}
-		ch <- Event{Type: EventMessageEnd, Message: &Message{Role: "assistant", Content: msg.Content, ToolCalls: toolCalls}}
-	}()
-
-	return ch, nil
+		b, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(p)))
+		if !strings.HasPrefix(mimeType, "image/") {
+			mimeType = http.DetectContentType(b)
+		}
+		url := "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(b)
+		imageParts = append(imageParts, oaContentPart{Type: "image_url", ImageURL: &oaImageURL{URL: url}})
+	}
+	if len(imageParts) == 0 {
+		return nil
+	}
+	parts := make([]oaContentPart, 0, len(imageParts)+1)
+	if text != "" {
+		parts = append(parts, oaContentPart{Type: "text", Text: text})
+	}
+	return append(parts, imageParts...)
 }
@@ -0,0 +1,327 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSSEServer 返回一个按 chunk 逐段回放 SSE 响应的测试服务器
+func newSSEServer(t *testing.T, chunks []string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/chat/completions", r.URL.Path)
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher, ok := w.(http.Flusher)
+		require.True(t, ok)
+		for _, c := range chunks {
+			_, _ = w.Write([]byte(c))
+			flusher.Flush()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func collectEvents(t *testing.T, baseURL string) []Event {
+	t.Helper()
+	client, err := NewOpenAIClient(baseURL, "test-key")
+	require.NoError(t, err)
+	ch, err := client.Chat(context.Background(), &ChatRequest{
+		Model:    "test-model",
+		Messages: []Message{{Role: "user", Content: "hi"}},
+		Stream:   true,
+	})
+	require.NoError(t, err)
+	var events []Event
+	for ev := range ch {
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestOpenAIStreamTextDeltas(t *testing.T) {
+	srv := newSSEServer(t, []string{
+		": keep-alive\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"\"}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"你\"}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"好\"}}]}\r\n\r\n",
+		": ping\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n",
+		"data: [DONE]\n\n",
+	})
+
+	events := collectEvents(t, srv.URL)
+	var deltas []string
+	var end *Message
+	for _, ev := range events {
+		require.NotEqual(t, EventError, ev.Type, "unexpected error: %v", ev.Err)
+		switch ev.Type {
+		case EventMessageDelta:
+			deltas = append(deltas, ev.Delta)
+		case EventMessageEnd:
+			end = ev.Message
+		}
+	}
+	assert.Equal(t, []string{"你", "好"}, deltas)
+	require.NotNil(t, end)
+	assert.Equal(t, "你好", end.Content)
+	assert.Empty(t, end.ToolCalls)
+}
+
+func TestOpenAIStreamToolCallFragments(t *testing.T) {
+	srv := newSSEServer(t, []string{
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"tool_calls\":[{\"index\":0,\"id\":\"call_a\",\"type\":\"function\",\"function\":{\"name\":\"read_file\",\"arguments\":\"\"}}]}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":1,\"id\":\"call_b\",\"type\":\"function\",\"function\":{\"name\":\"bash\",\"arguments\":\"{\\\"comm\"}}]}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{\\\"path\\\":\"}}]}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"\\\"a.go\\\"}\"}}]}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":1,\"function\":{\"arguments\":\"and\\\":\\\"ls\\\"}\"}}]}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"tool_calls\"}]}\n\n",
+		"data: [DONE]\n\n",
+	})
+
+	events := collectEvents(t, srv.URL)
+	var starts []ToolCall
+	var end *Message
+	for _, ev := range events {
+		require.NotEqual(t, EventError, ev.Type, "unexpected error: %v", ev.Err)
+		switch ev.Type {
+		case EventToolCallStart:
+			starts = append(starts, *ev.Tool)
+		case EventMessageEnd:
+			end = ev.Message
+		}
+	}
+	require.Len(t, starts, 2)
+	assert.Equal(t, "call_a", starts[0].ID)
+	assert.Equal(t, "read_file", starts[0].Function.Name)
+	assert.JSONEq(t, `{"path":"a.go"}`, starts[0].Function.Arguments)
+	assert.Equal(t, "call_b", starts[1].ID)
+	assert.JSONEq(t, `{"command":"ls"}`, starts[1].Function.Arguments)
+	require.NotNil(t, end)
+	assert.Equal(t, starts, end.ToolCalls)
+}
+
+func TestOpenAIStreamMidStreamError(t *testing.T) {
+	srv := newSSEServer(t, []string{
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"部分\"}}]}\n\n",
+		"data: {\"error\":{\"message\":\"upstream overloaded\",\"type\":\"server_error\"}}\n\n",
+	})
+
+	events := collectEvents(t, srv.URL)
+	require.NotEmpty(t, events)
+	last := events[len(events)-1]
+	require.Equal(t, EventError, last.Type)
+	assert.Contains(t, last.Err.Error(), "upstream overloaded")
+	for _, ev := range events {
+		assert.NotEqual(t, EventMessageEnd, ev.Type)
+	}
+}
+
+func TestOpenAIStreamWithoutDone(t *testing.T) {
+	srv := newSSEServer(t, []string{
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ok\"}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}",
+	})
+
+	events := collectEvents(t, srv.URL)
+	require.NotEmpty(t, events)
+	last := events[len(events)-1]
+	require.Equal(t, EventMessageEnd, last.Type)
+	assert.Equal(t, "ok", last.Message.Content)
+}
+
+func TestOpenAIJSONFallback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"整段回复"}}]}`))
+	}))
+	defer srv.Close()
+
+	events := collectEvents(t, srv.URL)
+	var text strings.Builder
+	for _, ev := range events {
+		if ev.Type == EventMessageDelta {
+			text.WriteString(ev.Delta)
+		}
+	}
+	assert.Equal(t, "整段回复", text.String())
+	assert.Equal(t, EventMessageEnd, events[len(events)-1].Type)
+}
+
+func TestOpenAIRequestRoundTripsToolCalls(t *testing.T) {
+	var captured map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&captured))
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ok\"}}]}\n\ndata: [DONE]\n\n"))
+	}))
+	defer srv.Close()
+
+	imgPath := filepath.Join(t.TempDir(), "shot.png")
+	require.NoError(t, os.WriteFile(imgPath, []byte("\x89PNG\r\n\x1a\nfake"), 0o644))
+
+	client, err := NewOpenAIClient(srv.URL, "")
+	require.NoError(t, err)
+	call := ToolCall{ID: "call_1", Type: "function", Function: ToolCallFunction{Name: "read_file", Arguments: `{"path":"a.go"}`}}
+	ch, err := client.Chat(context.Background(), &ChatRequest{
+		Model: "test-model",
+		Messages: []Message{
+			{Role: "user", Content: "看图", Images: []string{imgPath}},
+			{Role: "assistant", ToolCalls: []ToolCall{call}},
+			{Role: "tool", Content: "package a", ToolCallID: "call_1"},
+			{Role: "tool", Content: "旧会话结果"},
+		},
+		Stream: true,
+	})
+	require.NoError(t, err)
+	for range ch {
+	}
+
+	msgs := captured["messages"].([]any)
+	require.Len(t, msgs, 4)
+
+	user := msgs[0].(map[string]any)
+	parts := user["content"].([]any)
+	require.Len(t, parts, 2)
+	assert.Equal(t, "text", parts[0].(map[string]any)["type"])
+	img := parts[1].(map[string]any)
+	assert.Equal(t, "image_url", img["type"])
+	assert.True(t, strings.HasPrefix(img["image_url"].(map[string]any)["url"].(string), "data:image/png;base64,"))
+
+	assistant := msgs[1].(map[string]any)
+	content, hasContent := assistant["content"]
+	assert.True(t, hasContent)
+	assert.Nil(t, content)
+	calls := assistant["tool_calls"].([]any)
+	require.Len(t, calls, 1)
+	fn := calls[0].(map[string]any)["function"].(map[string]any)
+	assert.Equal(t, "call_1", calls[0].(map[string]any)["id"])
+	assert.Equal(t, "read_file", fn["name"])
+	assert.Equal(t, `{"path":"a.go"}`, fn["arguments"])
+
+	tool := msgs[2].(map[string]any)
+	assert.Equal(t, "tool", tool["role"])
+	assert.Equal(t, "call_1", tool["tool_call_id"])
+	assert.Equal(t, "read_file", tool["name"])
+
+	orphan := msgs[3].(map[string]any)
+	assert.Equal(t, "user", orphan["role"])
+	assert.Contains(t, orphan["content"], "旧会话结果")
+}
+
+func TestOpenAIStreamUsage(t *testing.T) {
+	var attempts []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		attempts = append(attempts, body)
+		if len(attempts) == 1 {
+			// 不认识 stream_options 的兼容服务端
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"message":"unknown field: stream_options"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ok\"},\"finish_reason\":\"stop\"}]}\n\n" +
+			"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":42,\"completion_tokens\":7,\"total_tokens\":49}}\n\n" +
+			"data: [DONE]\n\n"))
+	}))
+	defer srv.Close()
+
+	events := collectEvents(t, srv.URL)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, map[string]any{"include_usage": true}, attempts[0]["stream_options"])
+	assert.NotContains(t, attempts[1], "stream_options")
+
+	end := events[len(events)-1]
+	require.Equal(t, EventMessageEnd, end.Type)
+	require.NotNil(t, end.Usage)
+	assert.Equal(t, Usage{PromptTokens: 42, CompletionTokens: 7}, *end.Usage)
+	assert.Equal(t, 49, end.Usage.Total())
+}
+
+func TestOpenAIStatusErrorIsTransient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":"rate limited"}`))
+	}))
+	defer srv.Close()
+
+	events := collectEvents(t, srv.URL)
+	require.Len(t, events, 1)
+	require.Equal(t, EventError, events[0].Type)
+	assert.True(t, IsTransientError(events[0].Err))
+	assert.Equal(t, 7*time.Second, RetryAfterHint(events[0].Err))
+	assert.Contains(t, events[0].Err.Error(), "rate limited")
+
+	assert.False(t, IsTransientError(&StatusError{StatusCode: http.StatusBadRequest}))
+	assert.False(t, IsTransientError(context.Canceled))
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 30*time.Second, parseRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now))
+}
+
+func TestOpenAIRequestGenerationOptions(t *testing.T) {
+	var captured map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&captured))
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer srv.Close()
+
+	client, err := NewOpenAIClient(srv.URL, "")
+	require.NoError(t, err)
+	temp, seed := 0.3, 7
+	ch, err := client.Chat(context.Background(), &ChatRequest{
+		Model:    "test-model",
+		Messages: []Message{{Role: "user", Content: "hi"}},
+		Stream:   true,
+		Options:  &GenerationOptions{Temperature: &temp, Seed: &seed, MaxTokens: 256, NumCtx: 8192, Stop: []string{"END"}},
+	})
+	require.NoError(t, err)
+	for range ch {
+	}
+
+	assert.Equal(t, 0.3, captured["temperature"])
+	assert.Equal(t, float64(7), captured["seed"])
+	assert.Equal(t, float64(256), captured["max_tokens"])
+	assert.Equal(t, []any{"END"}, captured["stop"])
+	assert.NotContains(t, captured, "top_p")
+	assert.NotContains(t, captured, "num_ctx")
+}
+
+func TestOpenAIStreamReasoningContent(t *testing.T) {
+	srv := newSSEServer(t, []string{
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"reasoning_content\":\"先看\"}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"reasoning_content\":\"代码\"}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"好的\"}}]}\n\n",
+		"data: [DONE]\n\n",
+	})
+
+	events := collectEvents(t, srv.URL)
+	var thinking []string
+	for _, ev := range events {
+		if ev.Type == EventThinkingDelta {
+			thinking = append(thinking, ev.Delta)
+		}
+	}
+	assert.Equal(t, []string{"先看", "代码"}, thinking)
+	end := events[len(events)-1]
+	require.Equal(t, EventMessageEnd, end.Type)
+	assert.Equal(t, "好的", end.Message.Content)
+	assert.Equal(t, "先看代码", end.Message.Thinking)
+
+	msgs := convertOpenAIMessages([]Message{{Role: "assistant", Content: "好的", Thinking: "先看代码"}})
+	assert.Equal(t, "先看代码", msgs[0].Reasoning)
+}
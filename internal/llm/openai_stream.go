@@ -0,0 +1,201 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// sseEvent 表示一条 text/event-stream 事件
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// sseReader 按 SSE 规范逐条读取事件（忽略注释行与 id/retry 字段）
+type sseReader struct {
+	r *bufio.Reader
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	return &sseReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Next 读取下一条事件；流结束时返回 io.EOF
+func (s *sseReader) Next() (sseEvent, error) {
+	var ev sseEvent
+	var data []string
+	hasField := false
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+			if errors.Is(err, io.EOF) && hasField {
+				ev.Data = strings.Join(data, "\n")
+				return ev, nil
+			}
+			return sseEvent{}, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if hasField {
+				ev.Data = strings.Join(data, "\n")
+				return ev, nil
+			}
+			continue
+		}
+		// 以冒号开头的是注释（常用作 keep-alive）
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			data = append(data, value)
+			hasField = true
+		case "event":
+			ev.Event = value
+			hasField = true
+		}
+	}
+}
+
+// oaStreamChunk 流式响应中的单个 chunk
+type oaStreamChunk struct {
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Role             string       `json:"role"`
+			Content          string       `json:"content"`
+			ReasoningContent string       `json:"reasoning_content"` // DeepSeek / Qwen 等
+			Reasoning        string       `json:"reasoning"`         // OpenRouter / vLLM 等
+			ToolCalls        []oaToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *oaUsage `json:"usage,omitempty"`
+	Error *oaError `json:"error,omitempty"`
+}
+
+// oaStreamState 累积流式 chunk，按 index 拼接 tool_calls 参数片段
+type oaStreamState struct {
+	text      thinkingStream
+	toolCalls map[int]*ToolCall
+	usage     *Usage
+}
+
+func (st *oaStreamState) apply(chunk *oaStreamChunk, ch chan<- Event) {
+	// include_usage 时最后一个 chunk 的 choices 为空，只携带 usage
+	if chunk.Usage != nil {
+		st.usage = chunk.Usage.toUsage()
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		st.text.reasoning(choice.Delta.ReasoningContent+choice.Delta.Reasoning, ch)
+		st.text.text(choice.Delta.Content, ch)
+		for _, tc := range choice.Delta.ToolCalls {
+			if st.toolCalls == nil {
+				st.toolCalls = make(map[int]*ToolCall)
+			}
+			call, ok := st.toolCalls[tc.Index]
+			if !ok {
+				call = &ToolCall{Type: "function"}
+				st.toolCalls[tc.Index] = call
+			}
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			if tc.Type != "" {
+				call.Type = tc.Type
+			}
+			if tc.Function.Name != "" {
+				call.Function.Name += tc.Function.Name
+			}
+			call.Function.Arguments += tc.Function.Arguments
+		}
+	}
+}
+
+// finish 输出完整的工具调用事件与最终消息
+func (st *oaStreamState) finish(ch chan<- Event) {
+	thinking, content := st.text.finish(ch)
+	indexes := make([]int, 0, len(st.toolCalls))
+	for idx := range st.toolCalls {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	toolCalls := make([]ToolCall, 0, len(indexes))
+	for _, idx := range indexes {
+		call := *st.toolCalls[idx]
+		if call.ID == "" {
+			call.ID = NewToolCallID()
+		}
+		if strings.TrimSpace(call.Function.Arguments) == "" {
+			call.Function.Arguments = "{}"
+		}
+		toolCalls = append(toolCalls, call)
+		ch <- Event{Type: EventToolCallStart, Tool: &call}
+	}
+
+	ch <- Event{Type: EventMessageEnd, Message: &Message{Role: "assistant", Content: content, Thinking: thinking, ToolCalls: toolCalls}, Usage: st.usage}
+}
+
+// readOpenAIStream 解析 OpenAI 兼容的 SSE 流，逐 token 输出 Event
+func readOpenAIStream(ctx context.Context, r io.Reader, ch chan<- Event) error {
+	reader := newSSEReader(r)
+	state := &oaStreamState{}
+	received := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		ev, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			// 部分网关不发送 [DONE]，收到过数据即视为正常结束
+			if !received {
+				return fmt.Errorf("openai stream ended without data")
+			}
+			state.finish(ch)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read openai stream: %w", err)
+		}
+
+		data := strings.TrimSpace(ev.Data)
+		if data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			state.finish(ch)
+			return nil
+		}
+
+		var chunk oaStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			if ev.Event == "error" {
+				return fmt.Errorf("openai error: %s", data)
+			}
+			return fmt.Errorf("parse openai stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return chunk.Error.toError()
+		}
+		received = true
+		state.apply(&chunk, ch)
+	}
+}
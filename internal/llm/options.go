@@ -0,0 +1,273 @@
+package llm
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ollamaapi "github.com/ollama/ollama/api"
+)
+
+// GenerationOptions 生成参数；零值（nil / 0 / 空）表示使用后端默认值
+type GenerationOptions struct {
+	Temperature *float64 `yaml:"temperature" json:"temperature,omitempty"`
+	TopP        *float64 `yaml:"top_p" json:"top_p,omitempty"`
+	NumCtx      int      `yaml:"num_ctx" json:"num_ctx,omitempty"`       // 上下文长度（仅 Ollama）
+	KeepAlive   string   `yaml:"keep_alive" json:"keep_alive,omitempty"` // 模型驻留时间，如 10m、-1（仅 Ollama）
+	MaxTokens   int      `yaml:"max_tokens" json:"max_tokens,omitempty"` // 单次回复的最大输出 token
+	Stop        []string `yaml:"stop" json:"stop,omitempty"`
+	Seed        *int     `yaml:"seed" json:"seed,omitempty"`
+	Think       *bool    `yaml:"think" json:"think,omitempty"` // 是否启用推理模型的思考（仅 Ollama；OpenAI 兼容接口由模型决定）
+}
+
+// GenerationOptionKeys /set 支持的参数名
+var GenerationOptionKeys = []string{"temperature", "top_p", "num_ctx", "keep_alive", "max_tokens", "stop", "seed", "think"}
+
+// Merge 返回以 over 中已设置的字段覆盖 o 的结果
+func (o GenerationOptions) Merge(over GenerationOptions) GenerationOptions {
+	if over.Temperature != nil {
+		o.Temperature = over.Temperature
+	}
+	if over.TopP != nil {
+		o.TopP = over.TopP
+	}
+	if over.NumCtx > 0 {
+		o.NumCtx = over.NumCtx
+	}
+	if over.KeepAlive != "" {
+		o.KeepAlive = over.KeepAlive
+	}
+	if over.MaxTokens > 0 {
+		o.MaxTokens = over.MaxTokens
+	}
+	if len(over.Stop) > 0 {
+		o.Stop = append([]string(nil), over.Stop...)
+	}
+	if over.Seed != nil {
+		o.Seed = over.Seed
+	}
+	if over.Think != nil {
+		o.Think = over.Think
+	}
+	return o
+}
+
+// IsZero 是否未设置任何参数
+func (o GenerationOptions) IsZero() bool {
+	return len(o.Fields()) == 0
+}
+
+// Set 按参数名设置取值；value 为空或 default 时恢复后端默认值。
+// stop 的多个停止序列以空格分隔，可用 Go 字符串字面量表示含空格或转义的序列，如 "\n\n"
+func (o *GenerationOptions) Set(key, value string) error {
+	value = strings.TrimSpace(value)
+	reset := value == "" || value == "default"
+	switch strings.ToLower(strings.TrimSpace(key)) {
+	case "temperature":
+		return setFloat(&o.Temperature, value, reset, 0, 2)
+	case "top_p":
+		return setFloat(&o.TopP, value, reset, 0, 1)
+	case "num_ctx":
+		return setPositiveInt(&o.NumCtx, value, reset)
+	case "max_tokens":
+		return setPositiveInt(&o.MaxTokens, value, reset)
+	case "keep_alive":
+		if reset {
+			o.KeepAlive = ""
+			return nil
+		}
+		if _, err := parseKeepAlive(value); err != nil {
+			return err
+		}
+		o.KeepAlive = value
+	case "seed":
+		if reset {
+			o.Seed = nil
+			return nil
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("seed 应为整数: %s", value)
+		}
+		o.Seed = &v
+	case "think":
+		if reset {
+			o.Think = nil
+			return nil
+		}
+		switch strings.ToLower(value) {
+		case "true", "on", "yes", "1":
+			v := true
+			o.Think = &v
+		case "false", "off", "no", "0":
+			v := false
+			o.Think = &v
+		default:
+			return fmt.Errorf("think 应为 on 或 off: %s", value)
+		}
+	case "stop":
+		if reset {
+			o.Stop = nil
+			return nil
+		}
+		stops, err := parseStopSequences(value)
+		if err != nil {
+			return err
+		}
+		o.Stop = stops
+	default:
+		return fmt.Errorf("未知参数 %s（可用: %s）", key, strings.Join(GenerationOptionKeys, ", "))
+	}
+	return nil
+}
+
+// Fields 返回已设置参数的展示文本（参数名 -> 取值）
+func (o GenerationOptions) Fields() map[string]string {
+	out := map[string]string{}
+	if o.Temperature != nil {
+		out["temperature"] = strconv.FormatFloat(*o.Temperature, 'g', -1, 64)
+	}
+	if o.TopP != nil {
+		out["top_p"] = strconv.FormatFloat(*o.TopP, 'g', -1, 64)
+	}
+	if o.NumCtx > 0 {
+		out["num_ctx"] = strconv.Itoa(o.NumCtx)
+	}
+	if o.KeepAlive != "" {
+		out["keep_alive"] = o.KeepAlive
+	}
+	if o.MaxTokens > 0 {
+		out["max_tokens"] = strconv.Itoa(o.MaxTokens)
+	}
+	if len(o.Stop) > 0 {
+		quoted := make([]string, 0, len(o.Stop))
+		for _, s := range o.Stop {
+			quoted = append(quoted, strconv.Quote(s))
+		}
+		out["stop"] = strings.Join(quoted, " ")
+	}
+	if o.Seed != nil {
+		out["seed"] = strconv.Itoa(*o.Seed)
+	}
+	if o.Think != nil {
+		out["think"] = strconv.FormatBool(*o.Think)
+	}
+	return out
+}
+
+func (o GenerationOptions) String() string {
+	fields := o.Fields()
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+fields[k])
+	}
+	return strings.Join(parts, " ")
+}
+
+// ollamaOptions 转换为 Ollama 请求的 options 与 keep_alive
+func (o GenerationOptions) ollamaOptions() (map[string]any, *ollamaapi.Duration) {
+	opts := map[string]any{}
+	if o.Temperature != nil {
+		opts["temperature"] = *o.Temperature
+	}
+	if o.TopP != nil {
+		opts["top_p"] = *o.TopP
+	}
+	if o.NumCtx > 0 {
+		opts["num_ctx"] = o.NumCtx
+	}
+	if o.MaxTokens > 0 {
+		opts["num_predict"] = o.MaxTokens
+	}
+	if len(o.Stop) > 0 {
+		opts["stop"] = o.Stop
+	}
+	if o.Seed != nil {
+		opts["seed"] = *o.Seed
+	}
+	if len(opts) == 0 {
+		opts = nil
+	}
+	var keepAlive *ollamaapi.Duration
+	if d, err := parseKeepAlive(o.KeepAlive); err == nil && o.KeepAlive != "" {
+		keepAlive = &ollamaapi.Duration{Duration: d}
+	}
+	return opts, keepAlive
+}
+
+// parseKeepAlive 解析 keep_alive：Go duration（10m）或秒数，负数表示常驻
+func parseKeepAlive(v string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("keep_alive 应为时长（如 10m）或秒数: %s", v)
+	}
+	return d, nil
+}
+
+func parseStopSequences(v string) ([]string, error) {
+	var out []string
+	for rest := strings.TrimSpace(v); rest != ""; rest = strings.TrimSpace(rest) {
+		if rest[0] == '"' {
+			end, escaped := 1, false
+			for ; end < len(rest); end++ {
+				if escaped {
+					escaped = false
+				} else if rest[end] == '\\' {
+					escaped = true
+				} else if rest[end] == '"' {
+					break
+				}
+			}
+			if end >= len(rest) {
+				return nil, fmt.Errorf("stop 中的引号未闭合: %s", rest)
+			}
+			s, err := strconv.Unquote(rest[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("stop 序列无法解析: %s", rest[:end+1])
+			}
+			out = append(out, s)
+			rest = rest[end+1:]
+			continue
+		}
+		field := strings.Fields(rest)[0]
+		out = append(out, field)
+		rest = rest[len(field):]
+	}
+	return out, nil
+}
+
+func setFloat(dst **float64, value string, reset bool, min, max float64) error {
+	if reset {
+		*dst = nil
+		return nil
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || v < min || v > max {
+		return fmt.Errorf("取值应为 %g 到 %g 之间的数字: %s", min, max, value)
+	}
+	*dst = &v
+	return nil
+}
+
+func setPositiveInt(dst *int, value string, reset bool) error {
+	if reset {
+		*dst = 0
+		return nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v <= 0 {
+		return fmt.Errorf("取值应为正整数: %s", value)
+	}
+	*dst = v
+	return nil
+}
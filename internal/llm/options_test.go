@@ -0,0 +1,40 @@
+package llm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerationOptionsSetAndMerge(t *testing.T) {
+	var o GenerationOptions
+	require.NoError(t, o.Set("temperature", "0.2"))
+	require.NoError(t, o.Set("max_tokens", "512"))
+	require.NoError(t, o.Set("keep_alive", "-1"))
+	require.NoError(t, o.Set("stop", `"a b" c`))
+	assert.Error(t, o.Set("temperature", "2.5"))
+	assert.Error(t, o.Set("num_ctx", "0"))
+	assert.Error(t, o.Set("stop", `"open`))
+	assert.Error(t, o.Set("unknown", "1"))
+	require.NoError(t, o.Set("think", "off"))
+	assert.Equal(t, "false", o.Fields()["think"])
+	assert.Equal(t, []string{"a b", "c"}, o.Stop)
+
+	base := GenerationOptions{NumCtx: 8192, MaxTokens: 100}
+	merged := base.Merge(o)
+	assert.Equal(t, 8192, merged.NumCtx)
+	assert.Equal(t, 512, merged.MaxTokens)
+
+	opts, keepAlive := merged.ollamaOptions()
+	assert.Equal(t, 0.2, opts["temperature"])
+	assert.Equal(t, 8192, opts["num_ctx"])
+	assert.Equal(t, 512, opts["num_predict"])
+	require.NotNil(t, keepAlive)
+	assert.Equal(t, -time.Second, keepAlive.Duration)
+
+	require.NoError(t, o.Set("temperature", "default"))
+	assert.Nil(t, o.Temperature)
+	assert.True(t, GenerationOptions{}.IsZero())
+}
@@ -3,7 +3,9 @@ package llm
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
+	"strings"
 
 	ollamaapi "github.com/ollama/ollama/api"
 )
@@ -19,12 +21,18 @@ func (c *Client) Chat(ctx context.Context, req *ChatRequest) (<-chan Event, erro
 		Tools:    convertTools(req.Tools),
 		Stream:   boolPtr(req.Stream),
 	}
+	if req.Options != nil {
+		ollamaReq.Options, ollamaReq.KeepAlive = req.Options.ollamaOptions()
+		if req.Options.Think != nil {
+			ollamaReq.Think = &ollamaapi.ThinkValue{Value: *req.Options.Think}
+		}
+	}
 
 	go func() {
 		defer close(ch)
 
-		// 收集完整的 assistant 消息
-		var fullContent string
+		// 收集完整的 assistant 消息，推理内容与正文分开
+		var text thinkingStream
 		var toolCalls []ToolCall
 
 		respFn := func(resp ollamaapi.ChatResponse) error {
@@ -34,21 +42,16 @@ func (c *Client) Chat(ctx context.Context, req *ChatRequest) (<-chan Event, erro
 			default:
 			}
 
-			if resp.Message.Content != "" {
-				delta := resp.Message.Content
-				fullContent += delta
-				ch <- Event{
-					Type:  EventMessageDelta,
-					Delta: delta,
-				}
-			}
+			text.reasoning(resp.Message.Thinking, ch)
+			text.text(resp.Message.Content, ch)
 
 			// 处理工具调用
 			for _, tc := range resp.Message.ToolCalls {
 				argBytes, _ := json.Marshal(tc.Function.Arguments)
 				callID := tc.ID
 				if callID == "" {
-					callID = tc.Function.Name
+					// Ollama 未返回 ID 时生成唯一 ID，同一轮多次调用同一工具时也能与结果一一对应
+					callID = NewToolCallID()
 				}
 				call := ToolCall{
 					ID:   callID,
@@ -66,14 +69,21 @@ func (c *Client) Chat(ctx context.Context, req *ChatRequest) (<-chan Event, erro
 			}
 
 			if resp.Done {
+				thinking, content := text.finish(ch)
 				msg := &Message{
 					Role:      "assistant",
-					Content:   fullContent,
+					Content:   content,
+					Thinking:  thinking,
 					ToolCalls: toolCalls,
 				}
+				var usage *Usage
+				if resp.Metrics.PromptEvalCount > 0 || resp.Metrics.EvalCount > 0 {
+					usage = &Usage{PromptTokens: resp.Metrics.PromptEvalCount, CompletionTokens: resp.Metrics.EvalCount}
+				}
 				ch <- Event{
 					Type:    EventMessageEnd,
 					Message: msg,
+					Usage:   usage,
 				}
 			}
 
@@ -93,10 +103,26 @@ func (c *Client) Chat(ctx context.Context, req *ChatRequest) (<-chan Event, erro
 // convertMessages 将内部 Message 格式转换为 ollama API 格式
 func convertMessages(msgs []Message) []ollamaapi.Message {
 	out := make([]ollamaapi.Message, 0, len(msgs))
+	callNames := make(map[string]string)
 	for _, m := range msgs {
 		om := ollamaapi.Message{
-			Role:    m.Role,
-			Content: m.Content,
+			Role:     m.Role,
+			Content:  m.Content,
+			Thinking: m.Thinking,
+		}
+		for _, tc := range m.ToolCalls {
+			call := ollamaapi.ToolCall{ID: tc.ID}
+			call.Function.Name = tc.Function.Name
+			call.Function.Arguments = ollamaapi.NewToolCallFunctionArguments()
+			if strings.TrimSpace(tc.Function.Arguments) != "" {
+				_ = json.Unmarshal([]byte(tc.Function.Arguments), &call.Function.Arguments)
+			}
+			om.ToolCalls = append(om.ToolCalls, call)
+			callNames[tc.ID] = tc.Function.Name
+		}
+		if m.Role == "tool" && m.ToolCallID != "" {
+			om.ToolCallID = m.ToolCallID
+			om.ToolName = callNames[m.ToolCallID]
 		}
 		if len(m.Images) > 0 {
 			for _, p := range m.Images {
@@ -110,7 +136,6 @@ func convertMessages(msgs []Message) []ollamaapi.Message {
 				om.Images = append(om.Images, ollamaapi.ImageData(b))
 			}
 		}
-		// 将工具调用结果（role=tool）作为内容传递
 		out = append(out, om)
 	}
 	return out
@@ -125,8 +150,8 @@ func convertTools(tools []Tool) ollamaapi.Tools {
 	for _, t := range tools {
 		var params ollamaapi.ToolFunctionParameters
 		if len(t.Function.Parameters) > 0 {
-			// 将 JSON Schema 直接反序列化到 Ollama 参数类型
-			_ = json.Unmarshal(t.Function.Parameters, &params)
+			// 将 JSON Schema 反序列化到 Ollama 参数类型（先转换其不支持的关键字）
+			_ = json.Unmarshal(ollamaCompatibleSchema(t.Function.Parameters), &params)
 		}
 		if params.Properties == nil {
 			params.Properties = ollamaapi.NewToolPropertiesMap()
@@ -148,4 +173,68 @@ func convertTools(tools []Tool) ollamaapi.Tools {
 	return out
 }
 
+// ollamaCompatibleSchema 转换 Ollama 参数类型无法表示的 JSON Schema 关键字：
+// oneOf 改写为 anyOf；嵌套对象的 required 与 default 合并到 description 中提示模型
+func ollamaCompatibleSchema(raw json.RawMessage) json.RawMessage {
+	var schema map[string]any
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return raw
+	}
+	if props, ok := schema["properties"].(map[string]any); ok {
+		for name, p := range props {
+			props[name] = adaptOllamaProperty(p)
+		}
+	}
+	if items, ok := schema["items"]; ok {
+		schema["items"] = adaptOllamaProperty(items)
+	}
+	out, err := json.Marshal(schema)
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+func adaptOllamaProperty(v any) any {
+	p, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	if oneOf, ok := p["oneOf"]; ok {
+		p["anyOf"] = oneOf
+		delete(p, "oneOf")
+	}
+	if list, ok := p["anyOf"].([]any); ok {
+		for i := range list {
+			list[i] = adaptOllamaProperty(list[i])
+		}
+	}
+	if items, ok := p["items"]; ok {
+		p["items"] = adaptOllamaProperty(items)
+	}
+	if props, ok := p["properties"].(map[string]any); ok {
+		for name, child := range props {
+			props[name] = adaptOllamaProperty(child)
+		}
+	}
+
+	var notes []string
+	if req, ok := p["required"].([]any); ok && len(req) > 0 {
+		names := make([]string, 0, len(req))
+		for _, r := range req {
+			names = append(names, fmt.Sprint(r))
+		}
+		notes = append(notes, "必填字段: "+strings.Join(names, ", "))
+	}
+	if def, ok := p["default"]; ok {
+		data, _ := json.Marshal(def)
+		notes = append(notes, "默认值: "+string(data))
+	}
+	if len(notes) > 0 {
+		desc, _ := p["description"].(string)
+		p["description"] = strings.TrimSpace(desc + "（" + strings.Join(notes, "；") + "）")
+	}
+	return p
+}
+
 func boolPtr(b bool) *bool { return &b }
@@ -0,0 +1,40 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOllamaStreamAssignsUniqueToolCallIDs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/chat", r.URL.Path)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = w.Write([]byte(`{"model":"m","message":{"role":"assistant","content":"","tool_calls":[` +
+			`{"function":{"name":"read_file","arguments":{"path":"a.go"}}},` +
+			`{"function":{"name":"read_file","arguments":{"path":"b.go"}}}]},"done":false}` + "\n"))
+		_, _ = w.Write([]byte(`{"model":"m","message":{"role":"assistant","content":""},"done":true}` + "\n"))
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := NewClient(srv.URL)
+	require.NoError(t, err)
+	ch, err := client.Chat(context.Background(), &ChatRequest{Model: "m", Stream: true, Messages: []Message{{Role: "user", Content: "hi"}}})
+	require.NoError(t, err)
+
+	var end *Message
+	for ev := range ch {
+		require.NoError(t, ev.Err)
+		if ev.Type == EventMessageEnd {
+			end = ev.Message
+		}
+	}
+	require.NotNil(t, end)
+	require.Len(t, end.ToolCalls, 2)
+	assert.NotEmpty(t, end.ToolCalls[0].ID)
+	assert.NotEqual(t, end.ToolCalls[0].ID, end.ToolCalls[1].ID, "同一轮对同一工具的多次调用 ID 不能相同")
+}
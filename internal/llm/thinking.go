@@ -0,0 +1,122 @@
+package llm
+
+import "strings"
+
+const (
+	thinkOpenTag  = "<think>"
+	thinkCloseTag = "</think>"
+)
+
+// thinkSplitter 把以 <think>…</think> 开头的回复拆分为推理内容与正文。
+// 只识别位于回复开头的标签，正文中出现的 <think> 原样保留；
+// 标签可能被拆在多个增量中，未能判定的片段暂存到下一次 feed
+type thinkSplitter struct {
+	state    int // 0 尚未判定，1 位于 <think> 内，2 正文
+	buf      string
+	trimLead bool // 刚结束推理，去掉正文开头的空白
+}
+
+// feed 输入一段增量，返回可以输出的推理内容与正文
+func (s *thinkSplitter) feed(delta string) (thinking, content string) {
+	s.buf += delta
+	switch s.state {
+	case 0:
+		trimmed := strings.TrimLeft(s.buf, " \t\r\n")
+		if len(trimmed) < len(thinkOpenTag) && strings.HasPrefix(thinkOpenTag, trimmed) {
+			return "", ""
+		}
+		if !strings.HasPrefix(trimmed, thinkOpenTag) {
+			s.state = 2
+			content, s.buf = s.buf, ""
+			return "", content
+		}
+		s.state = 1
+		s.buf = strings.TrimLeft(trimmed[len(thinkOpenTag):], "\r\n")
+		return s.feed("")
+	case 1:
+		if idx := strings.Index(s.buf, thinkCloseTag); idx >= 0 {
+			thinking = s.buf[:idx]
+			rest := s.buf[idx+len(thinkCloseTag):]
+			s.state, s.buf, s.trimLead = 2, "", true
+			_, content = s.feed(rest)
+			return thinking, content
+		}
+		// 保留可能是结束标签前缀的尾部
+		keep := 0
+		for n := min(len(s.buf), len(thinkCloseTag)-1); n > 0; n-- {
+			if strings.HasSuffix(s.buf, thinkCloseTag[:n]) {
+				keep = n
+				break
+			}
+		}
+		thinking, s.buf = s.buf[:len(s.buf)-keep], s.buf[len(s.buf)-keep:]
+		return thinking, ""
+	default:
+		content, s.buf = s.buf, ""
+		if s.trimLead {
+			content = strings.TrimLeft(content, " \t\r\n")
+			if content != "" {
+				s.trimLead = false
+			}
+		}
+		return "", content
+	}
+}
+
+// flush 流结束时输出暂存的片段
+func (s *thinkSplitter) flush() (thinking, content string) {
+	rest := s.buf
+	s.buf = ""
+	if s.state == 1 {
+		return rest, ""
+	}
+	return "", rest
+}
+
+// splitThinking 拆分完整回复开头的 <think> 标签（非流式响应使用）
+func splitThinking(text string) (thinking, content string) {
+	var s thinkSplitter
+	thinking, content = s.feed(text)
+	t, c := s.flush()
+	return strings.TrimSpace(thinking + t), content + c
+}
+
+// thinkingStream 在流式解析中累积推理内容与正文并输出对应事件
+type thinkingStream struct {
+	splitter thinkSplitter
+	thinking strings.Builder
+	content  strings.Builder
+}
+
+// reasoning 输出后端单独返回的推理内容（message.thinking / reasoning_content）
+func (t *thinkingStream) reasoning(delta string, ch chan<- Event) {
+	if delta == "" {
+		return
+	}
+	t.thinking.WriteString(delta)
+	ch <- Event{Type: EventThinkingDelta, Delta: delta}
+}
+
+// text 输出正文增量，其中开头的 <think> 标签内容作为推理内容输出
+func (t *thinkingStream) text(delta string, ch chan<- Event) {
+	if delta == "" {
+		return
+	}
+	thinking, content := t.splitter.feed(delta)
+	t.emit(thinking, content, ch)
+}
+
+// finish 输出暂存片段，返回完整的推理内容与正文
+func (t *thinkingStream) finish(ch chan<- Event) (thinking, content string) {
+	thinking, content = t.splitter.flush()
+	t.emit(thinking, content, ch)
+	return strings.TrimSpace(t.thinking.String()), t.content.String()
+}
+
+func (t *thinkingStream) emit(thinking, content string, ch chan<- Event) {
+	t.reasoning(thinking, ch)
+	if content != "" {
+		t.content.WriteString(content)
+		ch <- Event{Type: EventMessageDelta, Delta: content}
+	}
+}
@@ -0,0 +1,36 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThinkSplitter(t *testing.T) {
+	split := func(chunks ...string) (thinking, content string) {
+		var s thinkSplitter
+		for _, c := range chunks {
+			th, co := s.feed(c)
+			thinking += th
+			content += co
+		}
+		th, co := s.flush()
+		return thinking + th, content + co
+	}
+
+	thinking, content := split("\n<th", "ink>\n先分析", "需求</th", "ink>\n\n", "结论：改 a.go")
+	assert.Equal(t, "先分析需求", thinking)
+	assert.Equal(t, "结论：改 a.go", content)
+
+	thinking, content = split("用 <think> 标签", "包裹推理")
+	assert.Empty(t, thinking)
+	assert.Equal(t, "用 <think> 标签包裹推理", content)
+
+	thinking, content = split("<think>未结束的推理")
+	assert.Equal(t, "未结束的推理", thinking)
+	assert.Empty(t, content)
+
+	thinking, content = split("<", "b>粗体</b>")
+	assert.Empty(t, thinking)
+	assert.Equal(t, "<b>粗体</b>", content)
+}
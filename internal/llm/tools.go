@@ -1,8 +1,15 @@
 package llm
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
 )
 
 // ToolSchema 用于构建工具的 JSON Schema
@@ -12,18 +19,85 @@ type ToolSchema struct {
 	Parameters  ToolParameters
 }
 
-// ToolParameters 工具参数的 JSON Schema
+// ToolParameters 工具参数的 JSON Schema（顶层必须为 object）
 type ToolParameters struct {
-	Type       string                     `json:"type"`
-	Properties map[string]ToolProperty    `json:"properties"`
-	Required   []string                   `json:"required,omitempty"`
+	Type                 string                  `json:"type"`
+	Properties           map[string]ToolProperty `json:"properties"`
+	Required             []string                `json:"required,omitempty"`
+	AdditionalProperties *bool                   `json:"additionalProperties,omitempty"`
 }
 
-// ToolProperty 单个参数属性
+// ToolProperty 单个参数属性，支持 JSON Schema 的常用子集：
+// 数组（items）、嵌套对象（properties / required）、默认值、oneOf / anyOf 与取值范围约束。
+// type 为数组（如 ["string","null"]）时解析到 Types，Type 留空
 type ToolProperty struct {
-	Type        string   `json:"type"`
-	Description string   `json:"description"`
-	Enum        []string `json:"enum,omitempty"`
+	Type                 string                  `json:"type,omitempty"`
+	Types                []string                `json:"-"`
+	Description          string                  `json:"description,omitempty"`
+	Enum                 []any                   `json:"enum,omitempty"`
+	Default              any                     `json:"default,omitempty"`
+	Items                *ToolProperty           `json:"items,omitempty"`
+	Properties           map[string]ToolProperty `json:"properties,omitempty"`
+	Required             []string                `json:"required,omitempty"`
+	AdditionalProperties *bool                   `json:"additionalProperties,omitempty"`
+	OneOf                []ToolProperty          `json:"oneOf,omitempty"`
+	AnyOf                []ToolProperty          `json:"anyOf,omitempty"`
+	Minimum              *float64                `json:"minimum,omitempty"`
+	Maximum              *float64                `json:"maximum,omitempty"`
+	MinLength            *int                    `json:"minLength,omitempty"`
+	MaxLength            *int                    `json:"maxLength,omitempty"`
+	Pattern              string                  `json:"pattern,omitempty"`
+	MinItems             *int                    `json:"minItems,omitempty"`
+	MaxItems             *int                    `json:"maxItems,omitempty"`
+}
+
+// UnmarshalJSON 兼容 type 为字符串或字符串数组两种写法
+func (p *ToolProperty) UnmarshalJSON(data []byte) error {
+	type plain ToolProperty
+	var aux struct {
+		plain
+		Type json.RawMessage `json:"type,omitempty"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	*p = ToolProperty(aux.plain)
+	if len(aux.Type) == 0 || string(aux.Type) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(aux.Type, &p.Type); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(aux.Type, &p.Types); err != nil {
+		return fmt.Errorf("type 应为字符串或字符串数组: %w", err)
+	}
+	if len(p.Types) == 1 {
+		p.Type, p.Types = p.Types[0], nil
+	}
+	return nil
+}
+
+// MarshalJSON 在 Types 非空时以数组输出 type
+func (p ToolProperty) MarshalJSON() ([]byte, error) {
+	type plain ToolProperty
+	if len(p.Types) == 0 {
+		return json.Marshal(plain(p))
+	}
+	return json.Marshal(struct {
+		plain
+		Type []string `json:"type"`
+	}{plain(p), p.Types})
+}
+
+// typeNames 返回声明的全部类型，未声明时为空
+func (p ToolProperty) typeNames() []string {
+	if len(p.Types) > 0 {
+		return p.Types
+	}
+	if p.Type != "" {
+		return []string{p.Type}
+	}
+	return nil
 }
 
 // BuildTool 将 ToolSchema 转换为 LLM 可用的 Tool 定义
@@ -50,3 +124,262 @@ func ParseToolCallArgs(args string, v any) error {
 	}
 	return nil
 }
+
+// maxSchemaViolations 单次校验最多报告的问题数
+const maxSchemaViolations = 10
+
+// Validate 按 schema 校验工具参数；空参数视为 {}。返回的错误列出全部不符合项（最多 10 条），
+// 可直接作为工具结果交给模型修正
+func (p ToolParameters) Validate(args json.RawMessage) error {
+	if len(bytes.TrimSpace(args)) == 0 {
+		args = json.RawMessage("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(args))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("参数不是合法 JSON: %w", err)
+	}
+	root := ToolProperty{Type: "object", Properties: p.Properties, Required: p.Required, AdditionalProperties: p.AdditionalProperties}
+	var errs []string
+	root.validate("", v, &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	if len(errs) > maxSchemaViolations {
+		errs = append(errs[:maxSchemaViolations], fmt.Sprintf("... 另有 %d 处", len(errs)-maxSchemaViolations))
+	}
+	return fmt.Errorf("参数不符合 schema: %s", strings.Join(errs, "; "))
+}
+
+func (p ToolProperty) validate(path string, v any, errs *[]string) {
+	fail := func(format string, args ...any) {
+		name := path
+		if name == "" {
+			name = "参数"
+		}
+		*errs = append(*errs, name+" "+fmt.Sprintf(format, args...))
+	}
+
+	if len(p.OneOf) > 0 || len(p.AnyOf) > 0 {
+		matched := 0
+		for _, alt := range append(append([]ToolProperty{}, p.OneOf...), p.AnyOf...) {
+			var sub []string
+			alt.validate(path, v, &sub)
+			if len(sub) == 0 {
+				matched++
+			}
+		}
+		switch {
+		case matched == 0:
+			fail("不匹配任何可选 schema")
+			return
+		case len(p.OneOf) > 0 && len(p.AnyOf) == 0 && matched > 1:
+			fail("同时匹配多个 oneOf 分支")
+			return
+		}
+	}
+
+	if types := p.typeNames(); len(types) > 0 && !anyTypeMatches(types, v) {
+		fail("应为 %s，实际为 %s", strings.Join(types, " | "), jsonTypeName(v))
+		return
+	}
+	if len(p.Enum) > 0 && !enumContains(p.Enum, v) {
+		fail("取值 %q 不在可选值 [%s] 中", fmt.Sprint(v), EnumString(p.Enum))
+	}
+
+	switch val := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(val)
+		if p.MinLength != nil && n < *p.MinLength {
+			fail("长度不能小于 %d", *p.MinLength)
+		}
+		if p.MaxLength != nil && n > *p.MaxLength {
+			fail("长度不能大于 %d", *p.MaxLength)
+		}
+		if p.Pattern != "" {
+			if re, err := regexp.Compile(p.Pattern); err == nil && !re.MatchString(val) {
+				fail("不匹配模式 %s", p.Pattern)
+			}
+		}
+	case json.Number:
+		f, _ := val.Float64()
+		if p.Minimum != nil && f < *p.Minimum {
+			fail("不能小于 %v", *p.Minimum)
+		}
+		if p.Maximum != nil && f > *p.Maximum {
+			fail("不能大于 %v", *p.Maximum)
+		}
+	case []any:
+		if p.MinItems != nil && len(val) < *p.MinItems {
+			fail("至少需要 %d 个元素", *p.MinItems)
+		}
+		if p.MaxItems != nil && len(val) > *p.MaxItems {
+			fail("最多 %d 个元素", *p.MaxItems)
+		}
+		if p.Items != nil {
+			for i, item := range val {
+				p.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	case map[string]any:
+		for _, name := range p.Required {
+			if _, ok := val[name]; !ok {
+				fail("缺少必填字段 %s", name)
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			if val[k] == nil && !containsString(p.Required, k) {
+				continue // 可选字段传 null 视为未传
+			}
+			if prop, ok := p.Properties[k]; ok {
+				prop.validate(child, val[k], errs)
+			} else if p.AdditionalProperties != nil && !*p.AdditionalProperties {
+				*errs = append(*errs, child+" 不是可用字段")
+			}
+		}
+	}
+}
+
+func anyTypeMatches(types []string, v any) bool {
+	for _, t := range types {
+		if schemaTypeMatches(t, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func schemaTypeMatches(typ string, v any) bool {
+	switch typ {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return true
+}
+
+func jsonTypeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// enumContains 按 JSON 语义比较取值：数字按数值比较，字符串、布尔与 null 须类型一致
+func enumContains(enum []any, v any) bool {
+	for _, e := range enum {
+		if ef, ok := jsonNumber(e); ok {
+			if vf, ok := jsonNumber(v); ok && ef == vf {
+				return true
+			}
+			continue
+		}
+		if e == nil || v == nil {
+			if e == nil && v == nil {
+				return true
+			}
+			continue
+		}
+		switch e.(type) {
+		case string, bool:
+			if e == v {
+				return true
+			}
+		default:
+			if reflect.DeepEqual(normalizeJSON(e), normalizeJSON(v)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// normalizeJSON 经一次编解码统一数字等表示，便于比较对象与数组取值
+func normalizeJSON(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if json.Unmarshal(data, &out) != nil {
+		return v
+	}
+	return out
+}
+
+// EnumString 将枚举取值格式化为以逗号分隔的文本
+func EnumString(enum []any) string {
+	parts := make([]string, len(enum))
+	for i, e := range enum {
+		parts[i] = fmt.Sprint(e)
+	}
+	return strings.Join(parts, ", ")
+}
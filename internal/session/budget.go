@@ -0,0 +1,155 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yangruihan/go-pi/internal/agent"
+	"github.com/yangruihan/go-pi/internal/config"
+	"github.com/yangruihan/go-pi/internal/llm"
+)
+
+// ErrBudgetExceeded 会话用量达到预算上限，不再发起模型请求
+var ErrBudgetExceeded = errors.New("会话预算已用尽")
+
+// budgetClient 在每次模型请求前检查会话预算。
+// record 非空时累计响应中的用量（用于不经过 RunLoop 事件记录的请求，如上下文压缩）
+type budgetClient struct {
+	next   agent.LLMClient
+	check  func() error
+	record func(model string, usage llm.Usage)
+}
+
+func (c *budgetClient) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.Event, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	events, err := c.next.Chat(ctx, req)
+	if err != nil || c.record == nil {
+		return events, err
+	}
+	out := make(chan llm.Event, 32)
+	go func() {
+		defer close(out)
+		model := req.Model // 回退时改为实际应答的模型
+		for ev := range events {
+			switch {
+			case ev.Type == llm.EventFallback:
+				model = ev.Model
+			case ev.Type == llm.EventMessageEnd && ev.Usage != nil:
+				c.record(model, *ev.Usage)
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Budget 返回当前会话预算
+func (s *AgentSession) Budget() config.BudgetConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.budget
+}
+
+// SetBudget 替换会话预算，并重新允许预警提示
+func (s *AgentSession) SetBudget(b config.BudgetConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.budget = b
+	s.warnedTokens = false
+	s.warnedCost = false
+}
+
+// checkBudget 达到上限时返回 ErrBudgetExceeded；首次越过预警线时发布 notice 事件
+func (s *AgentSession) checkBudget() error {
+	s.mu.Lock()
+	b, u := s.budget, s.usage
+	var notices []string
+	if b.MaxTokens > 0 && u.TotalTokens() >= b.MaxTokens {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: 累计 %d token，上限 %d（/usage 查看用量，或新建会话继续）", ErrBudgetExceeded, u.TotalTokens(), b.MaxTokens)
+	}
+	if b.MaxCost > 0 && u.Cost >= b.MaxCost {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: 累计费用 %.4f，上限 %.4f（/usage 查看用量，或新建会话继续）", ErrBudgetExceeded, u.Cost, b.MaxCost)
+	}
+	if b.WarnTokens > 0 && u.TotalTokens() >= b.WarnTokens && !s.warnedTokens {
+		s.warnedTokens = true
+		notices = append(notices, fmt.Sprintf("会话已使用 %d token，超过预警值 %d", u.TotalTokens(), b.WarnTokens))
+	}
+	if b.WarnCost > 0 && u.Cost >= b.WarnCost && !s.warnedCost {
+		s.warnedCost = true
+		notices = append(notices, fmt.Sprintf("会话累计费用 %.4f，超过预警值 %.4f", u.Cost, b.WarnCost))
+	}
+	s.mu.Unlock()
+
+	for _, n := range notices {
+		s.bus.Publish(agent.AgentEvent{Type: agent.AgentEventNotice, Delta: n})
+	}
+	return nil
+}
+
+// UsageCommand 处理 /usage，返回展示给用户的文本
+func UsageCommand(s Session) string {
+	u := s.Usage()
+	var lines []string
+	if u.Requests == 0 {
+		lines = append(lines, "本会话暂无后端返回的 token 用量")
+	} else {
+		lines = append(lines,
+			fmt.Sprintf("会话用量: %d 次请求，输入 %d / 输出 %d，合计 %d token", u.Requests, u.PromptTokens, u.CompletionTokens, u.TotalTokens()),
+			fmt.Sprintf("当前上下文: %d token", u.LastPromptTokens),
+		)
+		if u.Cost > 0 {
+			lines = append(lines, fmt.Sprintf("累计费用: %.4f", u.Cost))
+		} else {
+			lines = append(lines, "累计费用: 未计费（可在 models.yaml 配置 input_price / output_price）")
+		}
+	}
+	if len(u.ByModel) > 1 {
+		models := make([]string, 0, len(u.ByModel))
+		for m := range u.ByModel {
+			models = append(models, m)
+		}
+		sort.Strings(models)
+		lines = append(lines, "按模型:")
+		for _, m := range models {
+			mu := u.ByModel[m]
+			lines = append(lines, fmt.Sprintf("  - %s: 输入 %d / 输出 %d", m, mu.PromptTokens, mu.CompletionTokens))
+		}
+	}
+
+	b := s.Budget()
+	var limits []string
+	if b.WarnTokens > 0 || b.MaxTokens > 0 {
+		limits = append(limits, "token "+formatBudgetLimit(float64(u.TotalTokens()), float64(b.WarnTokens), float64(b.MaxTokens), "%.0f"))
+	}
+	if b.WarnCost > 0 || b.MaxCost > 0 {
+		limits = append(limits, "费用 "+formatBudgetLimit(u.Cost, b.WarnCost, b.MaxCost, "%.4f"))
+	}
+	if len(limits) > 0 {
+		lines = append(lines, "预算: "+strings.Join(limits, "；"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatBudgetLimit(used, warn, max float64, format string) string {
+	out := fmt.Sprintf(format, used)
+	if warn > 0 {
+		out += fmt.Sprintf(" / 预警 "+format, warn)
+	}
+	if max > 0 {
+		out += fmt.Sprintf(" / 上限 "+format, max)
+		if used >= max {
+			out += "（已用尽）"
+		}
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yangruihan/go-pi/internal/agent"
+	"github.com/yangruihan/go-pi/internal/config"
+	"github.com/yangruihan/go-pi/internal/llm"
+	"github.com/yangruihan/go-pi/internal/tools"
+)
+
+func TestSessionBudgetAndCost(t *testing.T) {
+	mgr := NewSessionManager(t.TempDir())
+	client := &sequenceClient{handler: func(req *llm.ChatRequest) []llm.Event {
+		msg := &llm.Message{Role: "assistant", Content: "好的"}
+		return []llm.Event{
+			{Type: llm.EventMessageDelta, Delta: "好的"},
+			{Type: llm.EventMessageEnd, Message: msg, Usage: &llm.Usage{PromptTokens: 1_000_000, CompletionTokens: 500_000}},
+		}
+	}}
+
+	cfg := config.Default()
+	cfg.Ollama.Model = "paid-model"
+	cfg.Budget = config.BudgetConfig{WarnCost: 1, MaxCost: 5}
+	sess, err := NewAgentSession(cfg, client, tools.NewRegistry(), mgr, nil, "")
+	require.NoError(t, err)
+	sess.SetModelProfiles([]config.ModelProfile{{Name: "paid", Model: "paid-model", InputPrice: 2, OutputPrice: 4}})
+
+	var notices []string
+	sess.Subscribe(func(ev agent.AgentEvent) {
+		if ev.Type == agent.AgentEventNotice {
+			notices = append(notices, ev.Delta)
+		}
+	})
+
+	// 每次请求 2 + 2 = 4
+	require.NoError(t, sess.Prompt("第一条"))
+	assert.Empty(t, notices)
+	require.NoError(t, sess.Prompt("第二条"))
+	assert.Len(t, notices, 1)
+	assert.InDelta(t, 8.0, sess.Usage().Cost, 1e-9)
+
+	err = sess.Prompt("第三条")
+	require.ErrorIs(t, err, ErrBudgetExceeded)
+	assert.Len(t, client.Requests(), 2)
+	assert.Len(t, sess.Messages(), 4)
+	assert.Contains(t, UsageCommand(sess), "费用 8.0000 / 预警 1.0000 / 上限 5.0000（已用尽）")
+
+	require.NoError(t, sess.Save())
+	restored, err := mgr.Load(sess.SessionFile())
+	require.NoError(t, err)
+	assert.InDelta(t, 8.0, restored.Usage.Cost, 1e-9)
+
+	// 更换预算后可继续请求，直到达到 token 上限
+	sess.SetBudget(config.BudgetConfig{MaxTokens: 4_000_000})
+	require.NoError(t, sess.Prompt("第三条"))
+	assert.ErrorIs(t, sess.Prompt("第四条"), ErrBudgetExceeded)
+}
+
+func TestCompactionRecordsUsageAndRespectsBudget(t *testing.T) {
+	newSession := func(budget config.BudgetConfig) (*AgentSession, *sequenceClient) {
+		client := &sequenceClient{handler: func(req *llm.ChatRequest) []llm.Event {
+			msg := &llm.Message{Role: "assistant", Content: "摘要或回复"}
+			return []llm.Event{
+				{Type: llm.EventMessageDelta, Delta: msg.Content},
+				{Type: llm.EventMessageEnd, Message: msg, Usage: &llm.Usage{PromptTokens: 8, CompletionTokens: 2}},
+			}
+		}}
+		cfg := config.Default()
+		cfg.Context.MaxTokens = 1
+		cfg.Context.CompactionThreshold = 0.5
+		cfg.Context.KeepRecent = 1
+		cfg.Budget = budget
+		sess, err := NewAgentSession(cfg, client, tools.NewRegistry(), NewSessionManager(t.TempDir()), nil, "")
+		require.NoError(t, err)
+		return sess, client
+	}
+
+	// 第二轮之后触发压缩，压缩请求的用量计入会话
+	sess, client := newSession(config.BudgetConfig{})
+	require.NoError(t, sess.Prompt("第一条"))
+	require.NoError(t, sess.Prompt("第二条"))
+	assert.Len(t, client.Requests(), 3)
+	assert.Equal(t, 3, sess.Usage().Requests)
+	assert.Equal(t, 30, sess.Usage().TotalTokens())
+
+	// 预算用尽时不再发起压缩请求，改用本地摘要
+	sess, client = newSession(config.BudgetConfig{MaxTokens: 20})
+	require.NoError(t, sess.Prompt("第一条"))
+	require.NoError(t, sess.Prompt("第二条"))
+	assert.Len(t, client.Requests(), 2)
+	assert.Equal(t, "system", sess.Messages()[0].Role)
+}
+
+func TestBudgetSurvivesCheckout(t *testing.T) {
+	client := &sequenceClient{handler: func(req *llm.ChatRequest) []llm.Event {
+		msg := &llm.Message{Role: "assistant", Content: "好的"}
+		return []llm.Event{
+			{Type: llm.EventMessageDelta, Delta: msg.Content},
+			{Type: llm.EventMessageEnd, Message: msg, Usage: &llm.Usage{PromptTokens: 60, CompletionTokens: 40}},
+		}
+	}}
+	cfg := config.Default()
+	cfg.Budget = config.BudgetConfig{MaxTokens: 200}
+	sess, err := NewAgentSession(cfg, client, tools.NewRegistry(), NewSessionManager(t.TempDir()), nil, "")
+	require.NoError(t, err)
+
+	require.NoError(t, sess.Prompt("第一条"))
+	require.NoError(t, sess.Prompt("第二条"))
+	require.ErrorIs(t, sess.Prompt("第三条"), ErrBudgetExceeded)
+
+	// 检出到第一轮之后，用量随分支保留，预算仍然生效
+	_, err = sess.Checkout(sess.Messages()[1].EntryID)
+	require.NoError(t, err)
+	assert.Equal(t, 200, sess.Usage().TotalTokens())
+	assert.ErrorIs(t, sess.Prompt("分支中继续"), ErrBudgetExceeded)
+	assert.Len(t, client.Requests(), 2)
+}
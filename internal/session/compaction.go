@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/yangruihan/go-pi/internal/agent"
 	"github.com/yangruihan/go-pi/internal/llm"
@@ -18,14 +19,25 @@ type CompactionResult struct {
 	Messages    []llm.Message
 }
 
-// TokenEstimator token 估算器
+// TokenEstimator token 估算器：以 cl100k_base 计数，再按各模型实际返回的用量校准
 type TokenEstimator struct {
 	enc *tiktoken.Tiktoken
+
+	mu     sync.Mutex
+	model  string
+	fixed  int                // 系统提示词与工具定义的 token 数（未校准）
+	ratios map[string]float64 // 模型 -> 实际/估算 比例
 }
 
+const (
+	// 单次样本的比例超出该范围时视为异常（如 Ollama 复用 KV 缓存时 prompt_eval_count 只统计新 token）
+	minCalibrationRatio = 0.4
+	maxCalibrationRatio = 4.0
+)
+
 func NewTokenEstimator() *TokenEstimator {
 	enc, _ := tiktoken.GetEncoding("cl100k_base")
-	return &TokenEstimator{enc: enc}
+	return &TokenEstimator{enc: enc, ratios: map[string]float64{}}
 }
 
 func (e *TokenEstimator) EstimateText(text string) int {
@@ -35,16 +47,73 @@ func (e *TokenEstimator) EstimateText(text string) int {
 	return len(e.enc.Encode(text, nil, nil))
 }
 
-func (e *TokenEstimator) EstimateMessages(messages []llm.Message) int {
+// SetRequestContext 设置后续估算对应的模型，以及每次请求都会携带的系统提示词与工具定义
+func (e *TokenEstimator) SetRequestContext(model, systemMsg string, tools []llm.Tool) {
+	fixed := 0
+	if systemMsg != "" {
+		fixed += 4 + e.EstimateText(systemMsg)
+	}
+	for _, t := range tools {
+		fixed += 8 + e.EstimateText(t.Function.Name) + e.EstimateText(t.Function.Description) + e.EstimateText(string(t.Function.Parameters))
+	}
+	e.mu.Lock()
+	e.model = model
+	e.fixed = fixed
+	e.mu.Unlock()
+}
+
+// rawMessages 未校准的消息 token 数（含工具调用名称与参数）
+func (e *TokenEstimator) rawMessages(messages []llm.Message) int {
 	total := 0
 	for _, m := range messages {
 		total += 4
 		total += e.EstimateText(m.Role)
 		total += e.EstimateText(m.Content)
+		for _, tc := range m.ToolCalls {
+			total += 4 + e.EstimateText(tc.Function.Name) + e.EstimateText(tc.Function.Arguments)
+		}
+		if m.ToolCallID != "" {
+			total += 2
+		}
 	}
 	return total
 }
 
+// EstimateMessages 估算以 messages 为历史的一次请求的输入 token 数（含系统提示词与工具定义），
+// 当前模型已有实际用量样本时按比例校准
+func (e *TokenEstimator) EstimateMessages(messages []llm.Message) int {
+	raw := e.rawMessages(messages)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	raw += e.fixed
+	if r, ok := e.ratios[e.model]; ok {
+		return int(float64(raw)*r + 0.5)
+	}
+	return raw
+}
+
+// Calibrate 用后端返回的实际输入 token 数校准当前模型的估算比例（指数滑动平均）
+func (e *TokenEstimator) Calibrate(messages []llm.Message, promptTokens int) {
+	if promptTokens <= 0 {
+		return
+	}
+	raw := e.rawMessages(messages)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	raw += e.fixed
+	if raw <= 0 {
+		return
+	}
+	sample := float64(promptTokens) / float64(raw)
+	if sample < minCalibrationRatio || sample > maxCalibrationRatio {
+		return
+	}
+	if prev, ok := e.ratios[e.model]; ok {
+		sample = prev*0.7 + sample*0.3
+	}
+	e.ratios[e.model] = sample
+}
+
 func ShouldCompact(messages []llm.Message, estimator *TokenEstimator, maxTokens int, threshold float64) bool {
 	if maxTokens <= 0 || threshold <= 0 {
 		return false
@@ -56,6 +125,7 @@ func CompactMessages(
 	ctx context.Context,
 	client agent.LLMClient,
 	model string,
+	opts *llm.GenerationOptions,
 	messages []llm.Message,
 	keepRecent int,
 	estimator *TokenEstimator,
@@ -73,7 +143,7 @@ func CompactMessages(
 	hot := messages[split:]
 
 	historyText := buildHistoryText(cold)
-	summary, err := summarizeHistory(ctx, client, model, historyText)
+	summary, err := summarizeHistory(ctx, client, model, opts, historyText)
 	if err != nil {
 		summary = fallbackSummary(cold)
 	}
@@ -90,9 +160,9 @@ func CompactMessages(
 	}, nil
 }
 
-func summarizeHistory(ctx context.Context, client agent.LLMClient, model, history string) (string, error) {
+func summarizeHistory(ctx context.Context, client agent.LLMClient, model string, opts *llm.GenerationOptions, history string) (string, error) {
 	prompt := "你是一个会话历史压缩助手。请将以下对话历史提炼成简洁的摘要。\n\n要求：\n1. 当前任务：用一句话说明用户的核心需求\n2. 已完成操作：列出已执行的关键操作（修改了哪些文件、发现了什么）\n3. 当前状态：当前代码/任务处于什么状态\n4. 重要发现：记录关键的技术细节、错误信息、决策依据\n5. 待续事项：还未完成的工作\n\n对话历史：\n" + history
-	req := &llm.ChatRequest{Model: model, Messages: []llm.Message{{Role: "user", Content: prompt}}, Stream: true}
+	req := &llm.ChatRequest{Model: model, Messages: []llm.Message{{Role: "user", Content: prompt}}, Stream: true, Options: opts}
 	events, err := client.Chat(ctx, req)
 	if err != nil {
 		return "", err
@@ -2,6 +2,7 @@ package session
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/yangruihan/go-pi/internal/llm"
@@ -40,7 +41,7 @@ func TestCompactMessages(t *testing.T) {
 		{Role: "user", Content: "需求 C"},
 	}
 
-	res, err := CompactMessages(context.Background(), &fakeLLMClient{}, "test-model", messages, 2, est)
+	res, err := CompactMessages(context.Background(), &fakeLLMClient{}, "test-model", nil, messages, 2, est)
 	require.NoError(t, err)
 	require.NotNil(t, res)
 
@@ -49,3 +50,23 @@ func TestCompactMessages(t *testing.T) {
 	assert.Equal(t, "system", res.Messages[0].Role)
 	assert.Contains(t, res.Messages[0].Content, "历史摘要")
 }
+
+func TestTokenEstimatorCalibrate(t *testing.T) {
+	est := NewTokenEstimator()
+	msgs := []llm.Message{{Role: "user", Content: strings.Repeat("token ", 200)}}
+	before := est.EstimateMessages(msgs)
+
+	est.SetRequestContext("model-a", "", nil)
+	for i := 0; i < 20; i++ {
+		est.Calibrate(msgs, before*2)
+	}
+	assert.InDelta(t, before*2, est.EstimateMessages(msgs), float64(before)/10)
+
+	// 异常样本（如仅统计未命中缓存的 token）不参与校准
+	est.Calibrate(msgs, 1)
+	assert.InDelta(t, before*2, est.EstimateMessages(msgs), float64(before)/10)
+
+	// 校准系数按模型区分
+	est.SetRequestContext("model-b", "", nil)
+	assert.Equal(t, before, est.EstimateMessages(msgs))
+}
@@ -0,0 +1,125 @@
+package session
+
+import (
+	"context"
+	"strings"
+
+	"github.com/yangruihan/go-pi/internal/agent"
+	"github.com/yangruihan/go-pi/internal/config"
+	"github.com/yangruihan/go-pi/internal/llm"
+)
+
+// SetModelProfiles 设置 models.yaml 中的模型配置，用于费用计算与故障回退
+func (s *AgentSession) SetModelProfiles(profiles []config.ModelProfile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profiles = append([]config.ModelProfile(nil), profiles...)
+	s.fallbackClients = nil
+}
+
+// fallbacks 返回 model 的回退链；回退项为别名时按其 provider / base_url 创建 client，
+// 否则视为当前后端上的模型名。每个回退项使用该模型自身的生成参数，而非主模型的
+func (s *AgentSession) fallbacks(model string) []agent.Fallback {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := config.FindModelProfile(model, s.profiles)
+	if !ok {
+		return nil
+	}
+	out := make([]agent.Fallback, 0, len(p.Fallback))
+	for _, name := range p.Fallback {
+		fp, ok := config.ResolveModelProfile(name, s.profiles)
+		if !ok {
+			opts := s.generationOptions(name)
+			out = append(out, agent.Fallback{Model: name, Client: s.client, Options: &opts})
+			continue
+		}
+		client, err := s.profileClient(fp)
+		if err != nil {
+			continue
+		}
+		opts := s.profileOptions(fp)
+		out = append(out, agent.Fallback{Model: fp.Model, Client: client, Options: &opts})
+	}
+	return out
+}
+
+// profileClient 返回模型配置 p 对应的 client，按别名缓存；调用方需持有 s.mu
+func (s *AgentSession) profileClient(p config.ModelProfile) (agent.LLMClient, error) {
+	if client, ok := s.fallbackClients[p.Name]; ok {
+		return client, nil
+	}
+	client, err := s.newClient(p)
+	if err != nil {
+		return nil, err
+	}
+	if s.fallbackClients == nil {
+		s.fallbackClients = make(map[string]agent.LLMClient)
+	}
+	s.fallbackClients[p.Name] = client
+	return client, nil
+}
+
+// clientFor 返回实际处理 model 请求的 client：models.yaml 中该模型配置了与会话后端不同的
+// provider / base_url 时（如 /model 切换到其他后端的别名）使用对应 client，否则使用会话 client。
+// 调用方需持有 s.mu
+func (s *AgentSession) clientFor(model string) agent.LLMClient {
+	p, ok := config.FindModelProfile(model, s.profiles)
+	if !ok || !s.separateBackend(p) {
+		return s.client
+	}
+	client, err := s.profileClient(p)
+	if err != nil {
+		return s.client
+	}
+	return client
+}
+
+// separateBackend 判断模型配置 p 是否指向与会话 client 不同的后端
+func (s *AgentSession) separateBackend(p config.ModelProfile) bool {
+	provider := strings.ToLower(strings.TrimSpace(p.Provider))
+	current := strings.ToLower(strings.TrimSpace(s.cfg.LLM.Provider))
+	if current == "" {
+		current = "ollama"
+	}
+	if provider != "" && provider != current {
+		return true
+	}
+	base := strings.TrimRight(strings.TrimSpace(p.BaseURL), "/")
+	if base == "" {
+		return false
+	}
+	currentBase := strings.TrimSpace(s.cfg.Ollama.Host)
+	if current == "openai" && strings.TrimSpace(s.cfg.LLM.BaseURL) != "" {
+		currentBase = strings.TrimSpace(s.cfg.LLM.BaseURL)
+	}
+	return base != strings.TrimRight(currentBase, "/")
+}
+
+// modelRouter 按请求的模型名把请求交给实际的后端 client（见 clientFor）
+type modelRouter struct {
+	s *AgentSession
+}
+
+func (r modelRouter) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.Event, error) {
+	r.s.mu.Lock()
+	client := r.s.clientFor(req.Model)
+	r.s.mu.Unlock()
+	return client.Chat(ctx, req)
+}
+
+// newProfileClient 按模型配置创建 client；ollama 未配置 base_url 时使用 ollama.host
+func (s *AgentSession) newProfileClient(p config.ModelProfile) (agent.LLMClient, error) {
+	if p.Provider == "openai" {
+		key, err := p.ResolveAPIKey()
+		if err != nil {
+			return nil, err
+		}
+		return llm.NewOpenAIClient(p.BaseURL, key)
+	}
+	host := strings.TrimSpace(p.BaseURL)
+	if host == "" {
+		host = s.cfg.Ollama.Host
+	}
+	return llm.NewClient(host)
+}
@@ -0,0 +1,113 @@
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yangruihan/go-pi/internal/agent"
+	"github.com/yangruihan/go-pi/internal/config"
+	"github.com/yangruihan/go-pi/internal/llm"
+	"github.com/yangruihan/go-pi/internal/tools"
+)
+
+func TestSessionFallsBackToProfileModel(t *testing.T) {
+	primary := &sequenceClient{handler: func(req *llm.ChatRequest) []llm.Event {
+		return []llm.Event{{Type: llm.EventError, Err: &llm.StatusError{StatusCode: 503, Status: "503 Service Unavailable"}}}
+	}}
+	backup := &sequenceClient{handler: func(req *llm.ChatRequest) []llm.Event {
+		msg := &llm.Message{Role: "assistant", Content: "备用模型回复"}
+		return []llm.Event{
+			{Type: llm.EventMessageDelta, Delta: msg.Content},
+			{Type: llm.EventMessageEnd, Message: msg, Usage: &llm.Usage{PromptTokens: 1_000_000}},
+		}
+	}}
+
+	cfg := config.Default()
+	cfg.Ollama.Model = "main-model"
+	cfg.LLM.MaxRetries = 0
+	sess, err := NewAgentSession(cfg, primary, tools.NewRegistry(), NewSessionManager(t.TempDir()), nil, "")
+	require.NoError(t, err)
+	var created []string
+	sess.newClient = func(p config.ModelProfile) (agent.LLMClient, error) {
+		created = append(created, p.Name)
+		return backup, nil
+	}
+	sess.SetModelProfiles([]config.ModelProfile{
+		{Name: "main", Model: "main-model", Fallback: []string{"backup"}, Options: llm.GenerationOptions{MaxTokens: 100, Stop: []string{"END"}}},
+		{Name: "backup", Provider: "openai", Model: "backup-model", InputPrice: 1, Options: llm.GenerationOptions{MaxTokens: 20}},
+	})
+
+	var answered []string
+	sess.Subscribe(func(ev agent.AgentEvent) {
+		if ev.Type == agent.AgentEventFallback {
+			answered = append(answered, ev.Model)
+		}
+	})
+	require.NoError(t, sess.Prompt("你好"))
+	require.NoError(t, sess.Prompt("再来"))
+
+	assert.Equal(t, []string{"backup-model", "backup-model"}, answered)
+	assert.Equal(t, []string{"backup"}, created, "回退 client 按别名复用")
+	assert.Len(t, primary.Requests(), 2)
+	assert.Equal(t, "backup-model", backup.Requests()[0].Model)
+	assert.Equal(t, "备用模型回复", sess.Messages()[1].Content)
+
+	// 回退请求使用备用模型自身的生成参数，而不是主模型的
+	assert.Equal(t, 100, primary.Requests()[0].Options.MaxTokens)
+	backupOpts := backup.Requests()[0].Options
+	require.NotNil(t, backupOpts)
+	assert.Equal(t, 20, backupOpts.MaxTokens)
+	assert.Empty(t, backupOpts.Stop)
+
+	usage := sess.Usage()
+	assert.Equal(t, 2_000_000, usage.ByModel["backup-model"].PromptTokens)
+	assert.InDelta(t, 2.0, usage.Cost, 1e-9)
+}
+
+// probingClient 可探测工具支持的 client
+type probingClient struct {
+	*sequenceClient
+	tools  bool
+	probed []string
+}
+
+func (c *probingClient) SupportsTools(_ context.Context, model string) (bool, error) {
+	c.probed = append(c.probed, model)
+	return c.tools, nil
+}
+
+func TestSessionRoutesModelToProfileBackend(t *testing.T) {
+	reply := func(req *llm.ChatRequest) []llm.Event {
+		msg := &llm.Message{Role: "assistant", Content: "好的"}
+		return []llm.Event{{Type: llm.EventMessageDelta, Delta: msg.Content}, {Type: llm.EventMessageEnd, Message: msg}}
+	}
+	primary := &probingClient{sequenceClient: &sequenceClient{handler: reply}, tools: true}
+	remote := &probingClient{sequenceClient: &sequenceClient{handler: reply}, tools: false}
+
+	cfg := config.Default()
+	cfg.Ollama.Model = "main-model"
+	cfg.Ollama.ToolCalling = "auto"
+	registry := tools.NewRegistry()
+	registry.Register(&fakeIntegrationTool{})
+	sess, err := NewAgentSession(cfg, primary, registry, NewSessionManager(t.TempDir()), nil, "")
+	require.NoError(t, err)
+	sess.newClient = func(p config.ModelProfile) (agent.LLMClient, error) { return remote, nil }
+	sess.SetModelProfiles([]config.ModelProfile{{Name: "small", Provider: "openai", BaseURL: "http://remote/v1", Model: "small-model"}})
+
+	// 切换到其他后端的模型：请求与能力探测都经由该模型的 client
+	require.NoError(t, sess.SetModel("small-model"))
+	require.NoError(t, sess.Prompt("你好"))
+	assert.Empty(t, primary.Requests())
+	assert.Empty(t, primary.probed)
+	require.Len(t, remote.Requests(), 1)
+	assert.Equal(t, []string{"small-model"}, remote.probed)
+	assert.Empty(t, remote.Requests()[0].Tools, "不支持工具的模型使用 ReAct")
+
+	require.NoError(t, sess.SetModel("main-model"))
+	require.NoError(t, sess.Prompt("再来"))
+	require.Len(t, primary.Requests(), 1)
+	assert.Equal(t, []string{"main-model"}, primary.probed)
+	assert.NotEmpty(t, primary.Requests()[0].Tools)
+}
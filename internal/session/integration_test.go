@@ -8,6 +8,7 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/yangruihan/go-pi/internal/agent"
 	"github.com/yangruihan/go-pi/internal/config"
 	"github.com/yangruihan/go-pi/internal/llm"
 	"github.com/yangruihan/go-pi/internal/tools"
@@ -23,7 +24,7 @@ type sequenceClient struct {
 
 func (c *sequenceClient) Chat(_ context.Context, req *llm.ChatRequest) (<-chan llm.Event, error) {
 	c.mu.Lock()
-	copyReq := &llm.ChatRequest{Model: req.Model, Stream: req.Stream}
+	copyReq := &llm.ChatRequest{Model: req.Model, Stream: req.Stream, Options: req.Options}
 	copyReq.Tools = append(copyReq.Tools, req.Tools...)
 	copyReq.Messages = append(copyReq.Messages, req.Messages...)
 	c.requests = append(c.requests, copyReq)
@@ -232,3 +233,146 @@ func mustGetwd(t *testing.T) string {
 	require.NoError(t, err)
 	return cwd
 }
+
+func TestIntegrationToolCallsPersistAndReload(t *testing.T) {
+	root := t.TempDir()
+	mgr := NewSessionManager(root)
+
+	registry := tools.NewRegistry()
+	tool := &fakeIntegrationTool{}
+	registry.Register(tool)
+
+	var call int
+	client := &sequenceClient{handler: func(req *llm.ChatRequest) []llm.Event {
+		call++
+		if call == 1 {
+			calls := []llm.ToolCall{
+				{ID: "tc-a", Type: "function", Function: llm.ToolCallFunction{Name: "fake_tool", Arguments: `{"input":"a"}`}},
+				{ID: "tc-b", Type: "function", Function: llm.ToolCallFunction{Name: "fake_tool", Arguments: `{"input":"b"}`}},
+			}
+			msg := &llm.Message{Role: "assistant", ToolCalls: calls}
+			return []llm.Event{
+				{Type: llm.EventToolCallStart, Tool: &calls[0]},
+				{Type: llm.EventToolCallStart, Tool: &calls[1]},
+				{Type: llm.EventMessageEnd, Message: msg},
+			}
+		}
+		msg := &llm.Message{Role: "assistant", Content: "完成"}
+		return []llm.Event{
+			{Type: llm.EventMessageDelta, Delta: "完成"},
+			{Type: llm.EventMessageEnd, Message: msg},
+		}
+	}}
+
+	cfg := config.Default()
+	loaded, err := mgr.Create(mustGetwd(t), cfg.Ollama.Model)
+	require.NoError(t, err)
+
+	sess, err := NewAgentSession(cfg, client, registry, mgr, loaded, "")
+	require.NoError(t, err)
+	require.NoError(t, sess.Prompt("调用两次工具"))
+	require.NoError(t, sess.Save())
+
+	current := sess.Messages()
+	require.Len(t, current, 5)
+	assert.Equal(t, "assistant", current[1].Role)
+	require.Len(t, current[1].ToolCalls, 2)
+	assert.Equal(t, "tc-a", current[2].ToolCallID)
+	assert.Equal(t, "tc-b", current[3].ToolCallID)
+
+	reloaded, err := mgr.LoadByID(mustGetwd(t), sess.SessionID())
+	require.NoError(t, err)
+	assert.Equal(t, current, reloaded.Messages)
+
+	// 恢复后的历史应当与模型在同一轮中看到的消息一致
+	requests := client.Requests()
+	require.Len(t, requests, 2)
+	replayed := requests[1].Messages
+	require.Len(t, replayed, len(current)-1)
+	for i, msg := range replayed {
+		assert.Equal(t, msg.Role, reloaded.Messages[i].Role)
+		assert.Equal(t, msg.ToolCalls, reloaded.Messages[i].ToolCalls)
+		assert.Equal(t, msg.ToolCallID, reloaded.Messages[i].ToolCallID)
+	}
+}
+
+func TestIntegrationUsageTotalsPersist(t *testing.T) {
+	root := t.TempDir()
+	mgr := NewSessionManager(root)
+	client := &sequenceClient{handler: func(req *llm.ChatRequest) []llm.Event {
+		msg := &llm.Message{Role: "assistant", Content: "好的"}
+		return []llm.Event{
+			{Type: llm.EventMessageDelta, Delta: "好的"},
+			{Type: llm.EventMessageEnd, Message: msg, Usage: &llm.Usage{PromptTokens: 100 * len(req.Messages), CompletionTokens: 5}},
+		}
+	}}
+
+	cfg := config.Default()
+	loaded, err := mgr.Create(mustGetwd(t), cfg.Ollama.Model)
+	require.NoError(t, err)
+	sess, err := NewAgentSession(cfg, client, tools.NewRegistry(), mgr, loaded, "")
+	require.NoError(t, err)
+
+	var seen []int
+	sess.Subscribe(func(ev agent.AgentEvent) {
+		if ev.Type == agent.AgentEventTurnEnd {
+			seen = append(seen, sess.Usage().Requests)
+		}
+	})
+	require.NoError(t, sess.Prompt("第一条"))
+	require.NoError(t, sess.Prompt("第二条"))
+	require.NoError(t, sess.Save())
+
+	usage := sess.Usage()
+	assert.Equal(t, []int{1, 2}, seen)
+	assert.Equal(t, 2, usage.Requests)
+	assert.Equal(t, 100+300, usage.PromptTokens)
+	assert.Equal(t, 10, usage.CompletionTokens)
+	assert.Equal(t, 300, usage.LastPromptTokens)
+	assert.Equal(t, llm.Usage{PromptTokens: 400, CompletionTokens: 10}, usage.ByModel[cfg.Ollama.Model])
+
+	restored, err := mgr.Load(sess.SessionFile())
+	require.NoError(t, err)
+	assert.Equal(t, usage, restored.Usage)
+	assert.Len(t, restored.Messages, 4)
+}
+
+func TestIntegrationThinkingKeptOutOfLaterRequests(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		mgr := NewSessionManager(t.TempDir())
+		client := &sequenceClient{handler: func(req *llm.ChatRequest) []llm.Event {
+			msg := &llm.Message{Role: "assistant", Content: "答案", Thinking: "推理过程"}
+			return []llm.Event{
+				{Type: llm.EventThinkingDelta, Delta: msg.Thinking},
+				{Type: llm.EventMessageDelta, Delta: msg.Content},
+				{Type: llm.EventMessageEnd, Message: msg},
+			}
+		}}
+		cfg := config.Default()
+		cfg.Context.KeepThinking = keep
+		sess, err := NewAgentSession(cfg, client, tools.NewRegistry(), mgr, nil, "")
+		require.NoError(t, err)
+
+		require.NoError(t, sess.Prompt("第一个问题"))
+		require.NoError(t, sess.Prompt("第二个问题"))
+
+		assert.Equal(t, "推理过程", sess.Messages()[1].Thinking, "推理内容随消息保存")
+		second := client.Requests()[1].Messages
+		var sent string
+		for _, m := range second {
+			if m.Role == "assistant" {
+				sent += m.Thinking
+			}
+		}
+		if keep {
+			assert.Equal(t, "推理过程", sent)
+		} else {
+			assert.Empty(t, sent)
+		}
+
+		require.NoError(t, sess.Save())
+		restored, err := mgr.Load(sess.SessionFile())
+		require.NoError(t, err)
+		assert.Equal(t, "推理过程", restored.Messages[1].Thinking)
+	}
+}
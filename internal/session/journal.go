@@ -0,0 +1,499 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yangruihan/go-pi/internal/agent"
+	"github.com/yangruihan/go-pi/internal/permission"
+	"github.com/yangruihan/go-pi/internal/tools"
+)
+
+// journalMaxBytes 变更日志保留的快照总量上限，超出后丢弃最早的记录
+const journalMaxBytes = 64 * 1024 * 1024
+
+// FileChange 单个文件的一次修改（保存修改前后的完整内容）
+type FileChange struct {
+	Path         string `json:"path"`
+	Before       []byte `json:"before,omitempty"`
+	BeforeExists bool   `json:"before_exists"`
+	After        []byte `json:"after,omitempty"`
+	AfterExists  bool   `json:"after_exists"`
+}
+
+// ChangeSet 一次工具调用产生的全部文件修改
+type ChangeSet struct {
+	ID         int          `json:"id"`
+	EntryID    string       `json:"entry_id,omitempty"` // 对应工具结果消息的 EntryID
+	ToolCallID string       `json:"tool_call_id,omitempty"`
+	Tool       string       `json:"tool"`
+	Files      []FileChange `json:"files"`
+	Undone     bool         `json:"undone,omitempty"`
+	Time       time.Time    `json:"time"`
+}
+
+func (cs ChangeSet) size() int {
+	n := 0
+	for _, f := range cs.Files {
+		n += len(f.Before) + len(f.After)
+	}
+	return n
+}
+
+// journalOp 变更日志文件中的一条记录
+type journalOp struct {
+	Op         string     `json:"op"` // commit / set / bind / undo / redo
+	Set        *ChangeSet `json:"set,omitempty"`
+	ID         int        `json:"id,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	EntryID    string     `json:"entry_id,omitempty"`
+}
+
+// journalPath 返回会话文件对应的变更日志文件（<id>.changes，与会话 JSONL 放在一起）
+func journalPath(sessionFile string) string {
+	if sessionFile == "" {
+		return ""
+	}
+	return strings.TrimSuffix(sessionFile, ".jsonl") + ".changes"
+}
+
+// changeJournal 会话内的文件变更日志，支持 undo/redo。
+// path 非空时每次变更追加写入该文件，继续会话或重启后可从中恢复
+type changeJournal struct {
+	mu     sync.Mutex
+	sets   []*ChangeSet // 按时间顺序；已撤销的记录始终位于末尾（即 redo 栈）
+	nextID int
+	path   string
+}
+
+// loadChangeJournal 从变更日志文件重建日志；文件不存在时返回空日志。
+// 末尾不完整的记录（如写入中途退出）被忽略；重放时丢弃过的记录会触发一次重写以压缩文件
+func loadChangeJournal(path string) *changeJournal {
+	j := &changeJournal{path: path}
+	if path == "" {
+		return j
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return j
+	}
+	defer f.Close()
+
+	dropped := false
+	dec := json.NewDecoder(f)
+	for {
+		var op journalOp
+		if err := dec.Decode(&op); err != nil {
+			break
+		}
+		switch op.Op {
+		case "commit", "set":
+			if op.Set == nil {
+				continue
+			}
+			if op.Set.ID > j.nextID {
+				j.nextID = op.Set.ID
+			}
+			if op.Op == "commit" {
+				dropped = j.add(op.Set) || dropped
+			} else {
+				j.sets = append(j.sets, op.Set)
+			}
+		case "bind":
+			j.bindLocked(op.ToolCallID, op.EntryID)
+		case "undo", "redo":
+			for _, s := range j.sets {
+				if s.ID == op.ID {
+					s.Undone = op.Op == "undo"
+				}
+			}
+		}
+	}
+	if dropped {
+		_ = j.saveLocked()
+	}
+	return j
+}
+
+// add 追加一次新修改：清空 redo 栈，并在超出快照总量上限时丢弃最早的记录。
+// 调用方需持有 j.mu；返回是否丢弃了记录
+func (j *changeJournal) add(cs *ChangeSet) bool {
+	n := len(j.sets)
+	active := j.sets[:0]
+	for _, s := range j.sets {
+		if !s.Undone {
+			active = append(active, s)
+		}
+	}
+	j.sets = append(active, cs)
+	dropped := len(j.sets) <= n
+
+	total := 0
+	for _, s := range j.sets {
+		total += s.size()
+	}
+	for len(j.sets) > 1 && total > journalMaxBytes {
+		total -= j.sets[0].size()
+		j.sets = j.sets[1:]
+		dropped = true
+	}
+	return dropped
+}
+
+// persist 追加一条记录到变更日志文件；写入失败只影响重启后的恢复，不影响本次会话
+func (j *changeJournal) persist(op journalOp) {
+	if j.path == "" {
+		return
+	}
+	_ = appendJSONL(j.path, op)
+}
+
+// saveLocked 用当前记录整体重写变更日志文件；调用方需持有 j.mu
+func (j *changeJournal) saveLocked() error {
+	if j.path == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, s := range j.sets {
+		line, err := marshalJSONLLine(journalOp{Op: "set", Set: s})
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o755); err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// commit 记录一次工具调用的修改；新修改会清空 redo 栈
+func (j *changeJournal) commit(cs *ChangeSet) {
+	if cs == nil || len(cs.Files) == 0 {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.nextID++
+	cs.ID = j.nextID
+	if j.add(cs) {
+		// 丢弃了记录时重写文件，避免其无限增长
+		_ = j.saveLocked()
+		return
+	}
+	j.persist(journalOp{Op: "commit", Set: cs})
+}
+
+// bind 将工具调用产生的修改关联到工具结果消息的 EntryID
+func (j *changeJournal) bind(toolCallID, entryID string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.bindLocked(toolCallID, entryID) {
+		j.persist(journalOp{Op: "bind", ToolCallID: toolCallID, EntryID: entryID})
+	}
+}
+
+func (j *changeJournal) bindLocked(toolCallID, entryID string) bool {
+	for _, s := range j.sets {
+		if s.EntryID == "" && s.ToolCallID == toolCallID {
+			s.EntryID = entryID
+			return true
+		}
+	}
+	return false
+}
+
+// list 返回全部记录的副本
+func (j *changeJournal) list() []ChangeSet {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := make([]ChangeSet, 0, len(j.sets))
+	for _, s := range j.sets {
+		out = append(out, *s)
+	}
+	return out
+}
+
+// undo 撤销最近 n 次修改（从新到旧）
+func (j *changeJournal) undo(n int) ([]ChangeSet, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var done []ChangeSet
+	for i := len(j.sets) - 1; i >= 0 && len(done) < n; i-- {
+		s := j.sets[i]
+		if s.Undone {
+			continue
+		}
+		if err := restoreChangeSet(s, false); err != nil {
+			return done, err
+		}
+		s.Undone = true
+		j.persist(journalOp{Op: "undo", ID: s.ID})
+		done = append(done, *s)
+	}
+	if len(done) == 0 {
+		return nil, fmt.Errorf("没有可撤销的文件修改")
+	}
+	return done, nil
+}
+
+// redo 重做最近撤销的 n 次修改（从旧到新）
+func (j *changeJournal) redo(n int) ([]ChangeSet, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var done []ChangeSet
+	for _, s := range j.sets {
+		if len(done) >= n {
+			break
+		}
+		if !s.Undone {
+			continue
+		}
+		if err := restoreChangeSet(s, true); err != nil {
+			return done, err
+		}
+		s.Undone = false
+		j.persist(journalOp{Op: "redo", ID: s.ID})
+		done = append(done, *s)
+	}
+	if len(done) == 0 {
+		return nil, fmt.Errorf("没有可重做的文件修改")
+	}
+	return done, nil
+}
+
+// rollbackExcept 撤销所有不属于 keep 中条目的修改，并返回只包含保留记录的新日志（写入 branchPath）。
+// 尚未关联条目（EntryID 为空）的修改一律视为不保留
+func (j *changeJournal) rollbackExcept(keep map[string]bool, branchPath string) (*changeJournal, []ChangeSet, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	kept := func(s *ChangeSet) bool { return s.EntryID != "" && keep[s.EntryID] }
+	var rolled []ChangeSet
+	for i := len(j.sets) - 1; i >= 0; i-- {
+		s := j.sets[i]
+		if kept(s) || s.Undone {
+			continue
+		}
+		if err := restoreChangeSet(s, false); err != nil {
+			return nil, rolled, err
+		}
+		s.Undone = true
+		j.persist(journalOp{Op: "undo", ID: s.ID})
+		rolled = append(rolled, *s)
+	}
+
+	branch := &changeJournal{path: branchPath}
+	for _, s := range j.sets {
+		if kept(s) {
+			cp := *s
+			branch.sets = append(branch.sets, &cp)
+			branch.nextID = cp.ID
+		}
+	}
+	if err := branch.saveLocked(); err != nil {
+		return nil, rolled, fmt.Errorf("保存分支变更日志失败: %w", err)
+	}
+	return branch, rolled, nil
+}
+
+// restoreChangeSet 将一组修改恢复为修改前（redo=false）或修改后（redo=true）的内容
+// 文件在此期间被其他方式改动时拒绝覆盖
+func restoreChangeSet(s *ChangeSet, redo bool) error {
+	for _, f := range s.Files {
+		wantData, wantExists := f.After, f.AfterExists
+		if redo {
+			wantData, wantExists = f.Before, f.BeforeExists
+		}
+		if !snapshotMatches(f.Path, wantData, wantExists) {
+			return fmt.Errorf("%s 在 #%d 之后又被修改，已停止以免覆盖", f.Path, s.ID)
+		}
+	}
+	for i := len(s.Files) - 1; i >= 0; i-- {
+		f := s.Files[i]
+		data, exists := f.Before, f.BeforeExists
+		if redo {
+			data, exists = f.After, f.AfterExists
+		}
+		if err := writeSnapshot(f.Path, data, exists); err != nil {
+			return fmt.Errorf("恢复 %s 失败: %w", f.Path, err)
+		}
+	}
+	return nil
+}
+
+func readSnapshot(path string) ([]byte, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func snapshotMatches(path string, data []byte, exists bool) bool {
+	cur, curExists := readSnapshot(path)
+	return curExists == exists && bytes.Equal(cur, data)
+}
+
+func writeSnapshot(path string, data []byte, exists bool) error {
+	if !exists {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return os.WriteFile(path, data, mode)
+}
+
+// pendingChanges 单次工具调用期间记录的修改前快照
+type pendingChanges struct {
+	mu    sync.Mutex
+	order []string
+	files map[string]FileChange
+}
+
+func (p *pendingChanges) BeforeChange(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.files[path]; ok {
+		return
+	}
+	data, exists := readSnapshot(path)
+	p.files[path] = FileChange{Path: path, Before: data, BeforeExists: exists}
+	p.order = append(p.order, path)
+}
+
+// finish 读取修改后的内容，去掉实际未变化的文件
+func (p *pendingChanges) finish() []FileChange {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out []FileChange
+	for _, path := range p.order {
+		f := p.files[path]
+		f.After, f.AfterExists = readSnapshot(path)
+		if f.AfterExists == f.BeforeExists && bytes.Equal(f.After, f.Before) {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// journalExecutor 位于权限层之外，为每次工具调用收集文件修改并写入变更日志
+type journalExecutor struct {
+	next    *permission.Guard
+	journal func() *changeJournal
+}
+
+func (e *journalExecutor) Execute(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	return e.ExecuteStream(ctx, name, args, nil)
+}
+
+func (e *journalExecutor) ExecuteStream(ctx context.Context, name string, args json.RawMessage, onProgress func(chunk string)) (string, error) {
+	rec := &pendingChanges{files: make(map[string]FileChange)}
+	result, err := e.next.ExecuteStream(tools.WithChangeRecorder(ctx, rec), name, args, onProgress)
+	e.journal().commit(&ChangeSet{
+		ToolCallID: agent.ToolCallIDFromContext(ctx),
+		Tool:       name,
+		Files:      rec.finish(),
+		Time:       time.Now(),
+	})
+	return result, err
+}
+
+// FormatChangeSet 单行描述一次修改，用于 /changes 等命令
+func FormatChangeSet(cs ChangeSet) string {
+	paths := make([]string, 0, len(cs.Files))
+	cwd, _ := os.Getwd()
+	for _, f := range cs.Files {
+		p := f.Path
+		if rel, err := filepath.Rel(cwd, p); err == nil && !strings.HasPrefix(rel, "..") {
+			p = rel
+		}
+		switch {
+		case !f.BeforeExists:
+			p = "+" + p
+		case !f.AfterExists:
+			p = "-" + p
+		}
+		paths = append(paths, p)
+	}
+	line := fmt.Sprintf("#%d %s %s %s", cs.ID, cs.Time.Format("15:04:05"), cs.Tool, strings.Join(paths, ", "))
+	if cs.EntryID != "" {
+		line += " (entry " + cs.EntryID + ")"
+	}
+	if cs.Undone {
+		line += " [已撤销]"
+	}
+	return line
+}
+
+// ChangeCommand 处理 /undo [n]、/redo [n]、/changes 斜杠命令，返回要展示的文本
+func ChangeCommand(s Session, cmd string, args []string) string {
+	n := 1
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v <= 0 {
+			return fmt.Sprintf("用法: %s [n]", cmd)
+		}
+		n = v
+	}
+
+	var done []ChangeSet
+	var err error
+	var verb string
+	switch cmd {
+	case "/changes":
+		list := s.Changes()
+		if len(list) == 0 {
+			return "本会话暂无文件修改记录"
+		}
+		lines := []string{"文件修改记录（/undo 撤销、/redo 重做；bash 造成的修改不在其中）:"}
+		for _, cs := range list {
+			lines = append(lines, "  "+FormatChangeSet(cs))
+		}
+		return strings.Join(lines, "\n")
+	case "/undo":
+		done, err = s.Undo(n)
+		verb = "已撤销"
+	case "/redo":
+		done, err = s.Redo(n)
+		verb = "已重做"
+	default:
+		return "未知命令: " + cmd
+	}
+
+	var lines []string
+	for _, cs := range done {
+		lines = append(lines, verb+": "+FormatChangeSet(cs))
+	}
+	if err != nil {
+		lines = append(lines, cmd+" 失败: "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,165 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yangruihan/go-pi/internal/config"
+	"github.com/yangruihan/go-pi/internal/llm"
+	"github.com/yangruihan/go-pi/internal/tools"
+)
+
+// writeFileClient 每次 Prompt 先调用一次 write_file，再给出最终回复
+func writeFileClient(path string, contents ...string) *sequenceClient {
+	var call int
+	return &sequenceClient{handler: func(req *llm.ChatRequest) []llm.Event {
+		call++
+		if call%2 == 1 {
+			args, _ := json.Marshal(map[string]string{"path": path, "content": contents[call/2]})
+			tc := llm.ToolCall{ID: "tc-" + string(rune('a'+call/2)), Type: "function", Function: llm.ToolCallFunction{Name: "write_file", Arguments: string(args)}}
+			msg := &llm.Message{Role: "assistant", ToolCalls: []llm.ToolCall{tc}}
+			return []llm.Event{
+				{Type: llm.EventToolCallStart, Tool: &tc},
+				{Type: llm.EventMessageEnd, Message: msg},
+			}
+		}
+		msg := &llm.Message{Role: "assistant", Content: "完成"}
+		return []llm.Event{{Type: llm.EventMessageEnd, Message: msg}}
+	}}
+}
+
+func newJournalTestSession(t *testing.T, client *sequenceClient) *AgentSession {
+	t.Helper()
+	mgr := NewSessionManager(t.TempDir())
+	registry := tools.NewRegistry()
+	registry.Register(tools.NewWriteTool())
+
+	cfg := config.Default()
+	cfg.Perm.Tools = map[string]string{"write_file": "allow"}
+	cfg.Tools.Sandbox.ExtraRoots = []string{os.TempDir()}
+	loaded, err := mgr.Create(mustGetwd(t), cfg.Ollama.Model)
+	require.NoError(t, err)
+	sess, err := NewAgentSession(cfg, client, registry, mgr, loaded, "")
+	require.NoError(t, err)
+	return sess
+}
+
+func readString(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestJournalUndoRedo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	sess := newJournalTestSession(t, writeFileClient(path, "v1", "v2"))
+
+	require.NoError(t, sess.Prompt("写入 v1"))
+	require.NoError(t, sess.Prompt("写入 v2"))
+	assert.Equal(t, "v2", readString(t, path))
+
+	changes := sess.Changes()
+	require.Len(t, changes, 2)
+	assert.Equal(t, "write_file", changes[0].Tool)
+	assert.NotEmpty(t, changes[0].EntryID)
+
+	done, err := sess.Undo(1)
+	require.NoError(t, err)
+	require.Len(t, done, 1)
+	assert.Equal(t, "v1", readString(t, path))
+
+	_, err = sess.Undo(5)
+	require.NoError(t, err)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "新建的文件撤销后应被删除")
+
+	_, err = sess.Undo(1)
+	assert.Error(t, err)
+
+	_, err = sess.Redo(2)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", readString(t, path))
+
+	// 外部修改后拒绝覆盖
+	require.NoError(t, os.WriteFile(path, []byte("external"), 0o644))
+	_, err = sess.Undo(1)
+	assert.Error(t, err)
+	assert.Equal(t, "external", readString(t, path))
+}
+
+func TestJournalCheckoutRollsBackFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	sess := newJournalTestSession(t, writeFileClient(path, "v1", "v2"))
+
+	require.NoError(t, sess.Prompt("写入 v1"))
+	require.NoError(t, sess.Prompt("写入 v2"))
+	require.NoError(t, sess.Save())
+
+	// 第一次工具结果之后的条目：第二轮的 user 消息之前
+	msgs := sess.Messages()
+	require.Equal(t, "tool", msgs[2].Role)
+	_, err := sess.Checkout(msgs[2].EntryID, WithFileRollback())
+	require.NoError(t, err)
+
+	assert.Equal(t, "v1", readString(t, path))
+	changes := sess.Changes()
+	require.Len(t, changes, 1)
+	assert.Equal(t, msgs[2].EntryID, changes[0].EntryID)
+}
+
+func TestJournalRollbackSkipsUnboundChanges(t *testing.T) {
+	dir := t.TempDir()
+	kept, unbound := filepath.Join(dir, "kept.txt"), filepath.Join(dir, "unbound.txt")
+	require.NoError(t, os.WriteFile(kept, []byte("k"), 0o644))
+	require.NoError(t, os.WriteFile(unbound, []byte("u"), 0o644))
+	j := &changeJournal{sets: []*ChangeSet{
+		{ID: 1, EntryID: "e1", Files: []FileChange{{Path: kept, After: []byte("k"), AfterExists: true}}},
+		{ID: 2, Files: []FileChange{{Path: unbound, After: []byte("u"), AfterExists: true}}},
+	}}
+
+	// 没有 EntryID 的消息不应让未关联条目的修改被当作保留
+	branch, rolled, err := j.rollbackExcept(map[string]bool{"e1": true, "": true}, "")
+	require.NoError(t, err)
+	require.Len(t, rolled, 1)
+	assert.Equal(t, 2, rolled[0].ID)
+	require.Len(t, branch.sets, 1)
+	assert.Equal(t, "e1", branch.sets[0].EntryID)
+	assert.Equal(t, "k", readString(t, kept))
+	_, err = os.Stat(unbound)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestJournalSurvivesResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	sess := newJournalTestSession(t, writeFileClient(path, "v1", "v2"))
+
+	require.NoError(t, sess.Prompt("写入 v1"))
+	require.NoError(t, sess.Prompt("写入 v2"))
+	require.NoError(t, sess.Save())
+	_, err := sess.Undo(1)
+	require.NoError(t, err)
+
+	// 模拟 --continue：从会话文件重新创建会话，变更日志随之恢复
+	loaded, err := sess.manager.Load(sess.SessionFile())
+	require.NoError(t, err)
+	resumed, err := NewAgentSession(sess.cfg, sess.client, sess.registry, sess.manager, loaded, "")
+	require.NoError(t, err)
+
+	changes := resumed.Changes()
+	require.Len(t, changes, 2)
+	assert.NotEmpty(t, changes[0].EntryID)
+	assert.True(t, changes[1].Undone)
+
+	_, err = resumed.Redo(1)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", readString(t, path))
+	_, err = resumed.Undo(2)
+	require.NoError(t, err)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,63 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yangruihan/go-pi/internal/config"
+	"github.com/yangruihan/go-pi/internal/llm"
+)
+
+// generationOptions 计算 model 的生成参数：num_ctx 默认取 context.max_tokens，
+// 再依次叠加 models.yaml 中该模型的 options 与 /set 设置；调用方需持有 s.mu
+func (s *AgentSession) generationOptions(model string) llm.GenerationOptions {
+	p, _ := config.FindModelProfile(model, s.profiles)
+	return s.profileOptions(p)
+}
+
+// profileOptions 计算模型配置 p 的生成参数；p 为零值（未在 models.yaml 中配置）时
+// 只包含默认 num_ctx 与 /set 设置。调用方需持有 s.mu
+func (s *AgentSession) profileOptions(p config.ModelProfile) llm.GenerationOptions {
+	opts := llm.GenerationOptions{NumCtx: s.cfg.Context.MaxTokens}.Merge(p.Options)
+	return opts.Merge(s.genOverrides)
+}
+
+// GenerationOptions 返回当前模型生效的生成参数
+func (s *AgentSession) GenerationOptions() llm.GenerationOptions {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generationOptions(s.model)
+}
+
+// SetGenerationOption 设置本会话的生成参数（对之后的请求生效），value 为空或 default 时取消设置
+func (s *AgentSession) SetGenerationOption(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := s.genOverrides
+	if err := next.Set(key, value); err != nil {
+		return err
+	}
+	s.genOverrides = next
+	return nil
+}
+
+// SetCommand 处理 /set，返回展示给用户的文本
+func SetCommand(s Session, args []string) string {
+	if len(args) == 0 {
+		current := s.GenerationOptions().String()
+		if current == "" {
+			current = "（全部使用后端默认值）"
+		}
+		return fmt.Sprintf("当前生成参数: %s\n用法: /set <参数> <值>，/set <参数> default 恢复默认\n可用参数: %s",
+			current, strings.Join(llm.GenerationOptionKeys, ", "))
+	}
+	key := args[0]
+	value := strings.Join(args[1:], " ")
+	if strings.TrimSpace(value) == "" {
+		return fmt.Sprintf("用法: /set %s <值>（default 恢复默认）", key)
+	}
+	if err := s.SetGenerationOption(key, value); err != nil {
+		return "/set 失败: " + err.Error()
+	}
+	return "当前生成参数: " + s.GenerationOptions().String()
+}
@@ -0,0 +1,42 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yangruihan/go-pi/internal/config"
+	"github.com/yangruihan/go-pi/internal/llm"
+	"github.com/yangruihan/go-pi/internal/tools"
+)
+
+func TestSessionGenerationOptions(t *testing.T) {
+	client := &sequenceClient{handler: func(req *llm.ChatRequest) []llm.Event {
+		msg := &llm.Message{Role: "assistant", Content: "好的"}
+		return []llm.Event{{Type: llm.EventMessageEnd, Message: msg}}
+	}}
+	cfg := config.Default()
+	cfg.Ollama.Model = "qwen3:8b"
+	cfg.Context.MaxTokens = 16384
+	sess, err := NewAgentSession(cfg, client, tools.NewRegistry(), NewSessionManager(t.TempDir()), nil, "")
+	require.NoError(t, err)
+
+	temp := 0.6
+	sess.SetModelProfiles([]config.ModelProfile{{Name: "qwen3", Model: "qwen3:8b", Options: llm.GenerationOptions{Temperature: &temp, KeepAlive: "30m"}}})
+	assert.Equal(t, "keep_alive=30m num_ctx=16384 temperature=0.6", sess.GenerationOptions().String())
+
+	assert.Contains(t, SetCommand(sess, []string{"temperature", "0.2"}), "temperature=0.2")
+	assert.Contains(t, SetCommand(sess, []string{"stop", `"\n\n"`, "END"}), `stop="\n\n" "END"`)
+	assert.Contains(t, SetCommand(sess, []string{"top_p", "3"}), "/set 失败")
+	assert.Contains(t, SetCommand(sess, nil), "可用参数")
+
+	require.NoError(t, sess.Prompt("你好"))
+	opts := client.Requests()[0].Options
+	require.NotNil(t, opts)
+	assert.Equal(t, 16384, opts.NumCtx)
+	assert.Equal(t, 0.2, *opts.Temperature)
+	assert.Equal(t, []string{"\n\n", "END"}, opts.Stop)
+
+	SetCommand(sess, []string{"temperature", "default"})
+	assert.Equal(t, 0.6, *sess.GenerationOptions().Temperature, "恢复默认后回到 models.yaml 的取值")
+}
@@ -22,6 +22,9 @@ const (
 	entryMessage     entryType = "message"
 	entryModelChange entryType = "model_change"
 	entryCompaction  entryType = "compaction"
+	entryPermission  entryType = "permission"
+	entryUsage       entryType = "usage"
+	entryCost        entryType = "cost"
 )
 
 type headerEntry struct {
@@ -38,12 +41,28 @@ type messageEntry struct {
 	ID         string          `json:"id,omitempty"`
 	Role       string          `json:"role"`
 	Content    string          `json:"content,omitempty"`
+	Thinking   string          `json:"thinking,omitempty"`
 	Images     []string        `json:"images,omitempty"`
 	ToolCalls  []llm.ToolCall  `json:"tool_calls,omitempty"`
 	ToolCallID string          `json:"tool_call_id,omitempty"`
 	Timestamp  string          `json:"timestamp"`
 }
 
+// newMessageEntry 将内存中的消息转换为 JSONL 条目（保留 tool_calls 与 tool_call_id 关联）
+func newMessageEntry(msg llm.Message) messageEntry {
+	return messageEntry{
+		Type:       entryMessage,
+		ID:         msg.EntryID,
+		Role:       msg.Role,
+		Content:    msg.Content,
+		Thinking:   msg.Thinking,
+		Images:     msg.Images,
+		ToolCalls:  msg.ToolCalls,
+		ToolCallID: msg.ToolCallID,
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
 type modelChangeEntry struct {
 	Type      entryType `json:"type"`
 	Model     string    `json:"model"`
@@ -58,6 +77,15 @@ type compactionEntry struct {
 	Timestamp   string    `json:"timestamp"`
 }
 
+type permissionEntry struct {
+	Type      entryType `json:"type"`
+	Tool      string    `json:"tool"`
+	Args      string    `json:"args,omitempty"`
+	Allowed   bool      `json:"allowed"`
+	Source    string    `json:"source"`
+	Timestamp string    `json:"timestamp"`
+}
+
 // SessionMeta 会话列表元数据
 type SessionMeta struct {
 	ID        string
@@ -85,6 +113,7 @@ type LoadedSession struct {
 	ParentEntryID string
 	Model    string
 	Messages []llm.Message
+	Usage    UsageStats
 }
 
 // SessionManager 管理会话文件
@@ -223,7 +252,17 @@ func (m *SessionManager) Load(filePath string) (*LoadedSession, error) {
 		case entryMessage:
 			var v messageEntry
 			if json.Unmarshal(line, &v) == nil {
-				out.Messages = append(out.Messages, llm.Message{EntryID: v.ID, Role: v.Role, Content: v.Content, Images: v.Images, ToolCalls: v.ToolCalls, ToolCallID: v.ToolCallID})
+				out.Messages = append(out.Messages, llm.Message{EntryID: v.ID, Role: v.Role, Content: v.Content, Thinking: v.Thinking, Images: v.Images, ToolCalls: v.ToolCalls, ToolCallID: v.ToolCallID})
+			}
+		case entryUsage:
+			var v usageEntry
+			if json.Unmarshal(line, &v) == nil {
+				out.Usage.add(v.Model, llm.Usage{PromptTokens: v.PromptTokens, CompletionTokens: v.CompletionTokens})
+			}
+		case entryCost:
+			var v costEntry
+			if json.Unmarshal(line, &v) == nil {
+				out.Usage.Cost += v.Amount
 			}
 		}
 	}
@@ -259,6 +298,13 @@ func (m *SessionManager) ListEntries(sessionFile string, limit int) ([]SessionEn
 			continue
 		}
 		preview := strings.TrimSpace(msg.Content)
+		if preview == "" && len(msg.ToolCalls) > 0 {
+			names := make([]string, 0, len(msg.ToolCalls))
+			for _, tc := range msg.ToolCalls {
+				names = append(names, tc.Function.Name)
+			}
+			preview = "[调用工具: " + strings.Join(names, ", ") + "]"
+		}
 		if len([]rune(preview)) > 40 {
 			r := []rune(preview)
 			preview = string(r[:40]) + "..."
@@ -294,9 +340,44 @@ func (m *SessionManager) CheckoutFromEntry(cwd, currentSessionID, currentFile, e
 			return nil, err
 		}
 	}
+	// 分支沿用原会话的全部用量与费用记录，/usage 与预算不因检出而清零
+	spend, err := loadSpendLines(currentFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range spend {
+		if err := appendJSONLLine(created.FilePath, line); err != nil {
+			return nil, err
+		}
+	}
 	return m.Load(created.FilePath)
 }
 
+// loadSpendLines 读取会话文件中的 usage 与 cost 记录（原始 JSONL 行）
+func loadSpendLines(filePath string) ([][]byte, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out [][]byte
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var env struct {
+			Type entryType `json:"type"`
+		}
+		if json.Unmarshal(line, &env) != nil || (env.Type != entryUsage && env.Type != entryCost) {
+			continue
+		}
+		out = append(out, append(append([]byte(nil), line...), '\n'))
+	}
+	return out, scanner.Err()
+}
+
+// loadMessagesUntilEntry 读取截至 entryID 的消息。检出点位于带 tool_calls 的 assistant 消息或其部分结果上时，
+// 继续带上紧随其后的工具结果；仍没有结果的调用从 assistant 消息中移除，避免分支历史中出现未应答的 tool_calls
 func loadMessagesUntilEntry(filePath, entryID string) ([]messageEntry, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -306,6 +387,7 @@ func loadMessagesUntilEntry(filePath, entryID string) ([]messageEntry, error) {
 
 	out := make([]messageEntry, 0)
 	found := false
+	pending := map[string]bool{} // 最近一条 assistant 消息中尚无结果的调用
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
 		line := scanner.Bytes()
@@ -317,10 +399,32 @@ func loadMessagesUntilEntry(filePath, entryID string) ([]messageEntry, error) {
 		if json.Unmarshal(line, &msg) != nil {
 			continue
 		}
+		if found {
+			if msg.Role != "tool" || !pending[msg.ToolCallID] {
+				break
+			}
+			delete(pending, msg.ToolCallID)
+			out = append(out, msg)
+			if len(pending) == 0 {
+				break
+			}
+			continue
+		}
 		out = append(out, msg)
+		switch msg.Role {
+		case "assistant":
+			pending = map[string]bool{}
+			for _, tc := range msg.ToolCalls {
+				pending[tc.ID] = true
+			}
+		case "tool":
+			delete(pending, msg.ToolCallID)
+		}
 		if msg.ID == entryID {
 			found = true
-			break
+			if len(pending) == 0 {
+				break
+			}
 		}
 	}
 	if err := scanner.Err(); err != nil {
@@ -329,9 +433,36 @@ func loadMessagesUntilEntry(filePath, entryID string) ([]messageEntry, error) {
 	if !found {
 		return nil, fmt.Errorf("entry id %s not found", entryID)
 	}
+	if len(pending) > 0 {
+		out = dropUnansweredToolCalls(out, pending)
+	}
 	return out, nil
 }
 
+// dropUnansweredToolCalls 从最后一条带 tool_calls 的 assistant 消息中移除 pending 中的调用；
+// 移除后既无正文也无调用的消息一并删除
+func dropUnansweredToolCalls(msgs []messageEntry, pending map[string]bool) []messageEntry {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		m := msgs[i]
+		if m.Role != "assistant" || len(m.ToolCalls) == 0 {
+			continue
+		}
+		var kept []llm.ToolCall
+		for _, tc := range m.ToolCalls {
+			if !pending[tc.ID] {
+				kept = append(kept, tc)
+			}
+		}
+		m.ToolCalls = kept
+		if len(kept) == 0 && strings.TrimSpace(m.Content) == "" {
+			return append(msgs[:i:i], msgs[i+1:]...)
+		}
+		msgs[i] = m
+		return msgs
+	}
+	return msgs
+}
+
 func readSessionHeader(filePath string) headerEntry {
 	f, err := os.Open(filePath)
 	if err != nil {
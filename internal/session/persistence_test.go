@@ -0,0 +1,60 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yangruihan/go-pi/internal/llm"
+)
+
+func TestCheckoutFromEntryKeepsToolCallsAnswered(t *testing.T) {
+	mgr := NewSessionManager(t.TempDir())
+	cwd := t.TempDir()
+	call := func(id string) llm.ToolCall {
+		return llm.ToolCall{ID: id, Type: "function", Function: llm.ToolCallFunction{Name: "read_file", Arguments: `{}`}}
+	}
+	write := func(msgs ...llm.Message) *LoadedSession {
+		created, err := mgr.Create(cwd, "m")
+		require.NoError(t, err)
+		for _, m := range msgs {
+			require.NoError(t, appendJSONL(created.FilePath, newMessageEntry(m)))
+		}
+		return created
+	}
+	roles := func(msgs []llm.Message) []string {
+		var out []string
+		for _, m := range msgs {
+			out = append(out, m.Role)
+		}
+		return out
+	}
+
+	src := write(
+		llm.Message{EntryID: "u1", Role: "user", Content: "读取 a 和 b"},
+		llm.Message{EntryID: "a1", Role: "assistant", ToolCalls: []llm.ToolCall{call("c1"), call("c2")}},
+		llm.Message{EntryID: "t1", Role: "tool", Content: "A", ToolCallID: "c1"},
+		llm.Message{EntryID: "t2", Role: "tool", Content: "B", ToolCallID: "c2"},
+		llm.Message{EntryID: "a2", Role: "assistant", Content: "完成"},
+	)
+
+	// 检出到 assistant 或其部分结果时，带上剩余的工具结果
+	for _, entry := range []string{"a1", "t1"} {
+		loaded, err := mgr.CheckoutFromEntry(cwd, src.ID, src.FilePath, entry, "m")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user", "assistant", "tool", "tool"}, roles(loaded.Messages), entry)
+	}
+
+	// 结果缺失的调用从 assistant 消息中移除
+	src = write(
+		llm.Message{EntryID: "u1", Role: "user", Content: "读取 a 和 b"},
+		llm.Message{EntryID: "a1", Role: "assistant", Content: "读取中", ToolCalls: []llm.ToolCall{call("c1"), call("c2")}},
+		llm.Message{EntryID: "t1", Role: "tool", Content: "A", ToolCallID: "c1"},
+		llm.Message{EntryID: "u2", Role: "user", Content: "算了"},
+	)
+	loaded, err := mgr.CheckoutFromEntry(cwd, src.ID, src.FilePath, "a1", "m")
+	require.NoError(t, err)
+	require.Equal(t, []string{"user", "assistant", "tool"}, roles(loaded.Messages))
+	require.Len(t, loaded.Messages[1].ToolCalls, 1)
+	assert.Equal(t, "c1", loaded.Messages[1].ToolCalls[0].ID)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/yangruihan/go-pi/internal/config"
 	"github.com/yangruihan/go-pi/internal/extensions"
 	"github.com/yangruihan/go-pi/internal/llm"
+	"github.com/yangruihan/go-pi/internal/permission"
 	"github.com/yangruihan/go-pi/internal/tools"
 )
 
@@ -29,6 +30,11 @@ type Session interface {
 	AppendSystemPrompt(text string) error
 	IsStreaming() bool
 	Messages() []llm.Message
+	Usage() UsageStats
+	Budget() config.BudgetConfig
+	SetBudget(b config.BudgetConfig)
+	GenerationOptions() llm.GenerationOptions
+	SetGenerationOption(key, value string) error
 
 	Save() error
 	SessionFile() string
@@ -36,7 +42,27 @@ type Session interface {
 	ListSessions() ([]SessionMeta, error)
 	ListEntries(limit int) ([]SessionEntryMeta, error)
 	SwitchSession(id string) error
-	Checkout(entryID string) (string, error)
+	Checkout(entryID string, opts ...CheckoutOpt) (string, error)
+	SetApprover(a permission.Approver)
+	Jobs() *tools.JobManager
+	Close()
+
+	Undo(n int) ([]ChangeSet, error)
+	Redo(n int) ([]ChangeSet, error)
+	Changes() []ChangeSet
+}
+
+// CheckoutOpt Checkout 选项
+type CheckoutOpt func(*checkoutOptions)
+type checkoutOptions struct {
+	rollbackFiles bool
+}
+
+// WithFileRollback checkout 时同时把工作区文件回滚到该条目时的状态
+func WithFileRollback() CheckoutOpt {
+	return func(o *checkoutOptions) {
+		o.rollbackFiles = true
+	}
 }
 
 type PromptOpt func(*promptOptions)
@@ -60,6 +86,11 @@ type AgentSession struct {
 	systemMsg  string
 	client     agent.LLMClient
 	registry   *tools.Registry
+	guard      *permission.Guard
+	jobs       *tools.JobManager
+	journals   map[string]*changeJournal // 会话 ID -> 文件变更日志
+	files      *tools.FileTracker        // agent 读取/写入过的文件状态，用于过期写入保护
+	paths      *tools.PathPolicy         // 文件工具的工作区限制，nil 表示不限制
 	cfg        config.Config
 	manager    *SessionManager
 	sessionID  string
@@ -67,6 +98,15 @@ type AgentSession struct {
 	messages   []llm.Message
 	bus        *EventBus
 	estimator  *TokenEstimator
+	usage      UsageStats
+	chat       *agent.RetryClient    // 带重试与模型回退的 client，用于对话与压缩
+	profiles   []config.ModelProfile // models.yaml：价格与回退链
+	fallbackClients map[string]agent.LLMClient
+	genOverrides llm.GenerationOptions // /set 设置的生成参数，优先于 models.yaml
+	newClient  func(p config.ModelProfile) (agent.LLMClient, error)
+	budget     config.BudgetConfig
+	warnedTokens bool
+	warnedCost   bool
 
 	streaming bool
 	cancelFn  context.CancelFunc
@@ -84,6 +124,10 @@ func NewAgentSession(
 	systemMsg string,
 ) (*AgentSession, error) {
 	cwd, _ := os.Getwd()
+	policy, err := permission.NewPolicy(cfg.Perm)
+	if err != nil {
+		return nil, err
+	}
 	s := &AgentSession{
 		cwd:       cwd,
 		model:     cfg.Ollama.Model,
@@ -93,10 +137,26 @@ func NewAgentSession(
 		cfg:       cfg,
 		manager:   manager,
 		bus:       NewEventBus(),
+		files:     tools.NewFileTracker(),
+		paths:     tools.NewPathPolicy(cwd, cfg.Tools.Sandbox),
 		estimator: NewTokenEstimator(),
+		budget:    cfg.Budget,
 		beforePromptHook: strings.TrimSpace(cfg.Ext.BeforePrompt),
 		afterResponseHook: strings.TrimSpace(cfg.Ext.AfterResponse),
 	}
+	s.newClient = s.newProfileClient
+	s.chat = agent.NewRetryClient(modelRouter{s: s}, agent.RetryOptions{MaxRetries: cfg.LLM.MaxRetries, Fallbacks: s.fallbacks})
+	s.guard = permission.NewGuard(registry, policy)
+	s.guard.OnRecord(s.recordPermission)
+
+	// 后台任务按会话隔离，与 bash 工具一同提供
+	toolOpts := tools.OptionsFromConfig(cfg.Tools)
+	s.jobs = tools.NewJobManager(toolOpts)
+	if _, ok := registry.Get("bash"); ok {
+		for _, t := range tools.NewJobTools(s.jobs, toolOpts) {
+			registry.Register(t)
+		}
+	}
 
 	if loaded == nil {
 		created, err := manager.Create(cwd, s.model)
@@ -109,6 +169,7 @@ func NewAgentSession(
 		s.sessionID = loaded.ID
 		s.sessionFile = loaded.FilePath
 		s.messages = append(s.messages, loaded.Messages...)
+		s.usage = loaded.Usage
 		if strings.TrimSpace(loaded.Model) != "" {
 			s.model = loaded.Model
 		}
@@ -129,6 +190,10 @@ func (s *AgentSession) Prompt(text string, opts ...PromptOpt) error {
 		}
 	}
 
+	if err := s.checkBudget(); err != nil {
+		return err
+	}
+
 	po := &promptOptions{}
 	for _, opt := range opts {
 		if opt != nil {
@@ -142,6 +207,8 @@ func (s *AgentSession) Prompt(text string, opts ...PromptOpt) error {
 		return fmt.Errorf("agent is already streaming")
 	}
 	ctx, cancel := context.WithCancel(context.Background())
+	ctx = tools.WithFileTracker(ctx, s.files)
+	ctx = tools.WithPathPolicy(ctx, s.paths)
 	s.cancelFn = cancel
 	s.streaming = true
 
@@ -150,9 +217,10 @@ func (s *AgentSession) Prompt(text string, opts ...PromptOpt) error {
 	userMsg := llm.Message{EntryID: newEntryID(), Role: "user", Content: text, Images: po.images}
 	working = append(working, userMsg)
 	model := s.model
+	genOpts := s.generationOptions(model)
 	s.mu.Unlock()
 
-	if err := s.persistEntry(messageEntry{Type: entryMessage, ID: userMsg.EntryID, Role: userMsg.Role, Content: userMsg.Content, Images: userMsg.Images, Timestamp: time.Now().UTC().Format(time.RFC3339)}); err != nil {
+	if err := s.persistEntry(newMessageEntry(userMsg)); err != nil {
 		s.bus.Publish(agent.AgentEvent{Type: agent.AgentEventError, Err: fmt.Errorf("会话写入失败（已缓冲，稍后重试）: %w", err)})
 	}
 
@@ -161,39 +229,69 @@ func (s *AgentSession) Prompt(text string, opts ...PromptOpt) error {
 		s.finishStreaming()
 		return err
 	}
+	s.estimator.SetRequestContext(model, s.systemMsg, llmTools)
 
 	loopCfg := agent.AgentLoopConfig{
 		Model: model,
 		Tools: llmTools,
 		MaxTurns: 30,
 		SystemMsg: s.systemMsg,
+		ToolCalling: s.toolCallingMode(ctx, model),
+		Options: &genOpts,
+		KeepThinking: s.cfg.Context.KeepThinking,
 	}
 
-	eventCh := agent.RunLoop(ctx, working, loopCfg, s.client, s.registry)
+	eventCh := agent.RunLoop(ctx, working, loopCfg, &budgetClient{next: s.chat, check: s.checkBudget}, &journalExecutor{next: s.guard, journal: s.journal})
 	var turnBuilder strings.Builder
 	var finalErr error
 	var lastAssistant string
 
+	usageModel := model // 本轮实际应答的模型，回退时改变
 	for ev := range eventCh {
+		switch ev.Type {
+		case agent.AgentEventFallback:
+			usageModel = ev.Model
+		case agent.AgentEventTurnEnd:
+			if ev.Usage != nil {
+				// 先于事件发布累计，订阅方收到 turn_end 时 Usage() 已是最新值；
+				// 回退模型的用量不用于校准主模型的 token 估算
+				request := working
+				if usageModel != model {
+					request = nil
+				}
+				s.recordUsage(usageModel, *ev.Usage, request)
+			}
+			usageModel = model
+		}
 		s.bus.Publish(ev)
 		switch ev.Type {
 		case agent.AgentEventDelta:
 			turnBuilder.WriteString(ev.Delta)
 		case agent.AgentEventToolResult:
-			toolMsg := llm.Message{EntryID: newEntryID(), Role: "tool", Content: ev.ToolResult}
+			toolMsg := llm.Message{EntryID: newEntryID(), Role: "tool", Content: ev.ToolResult, ToolCallID: ev.ToolCallID}
 			working = append(working, toolMsg)
-			if err := s.persistEntry(messageEntry{Type: entryMessage, ID: toolMsg.EntryID, Role: toolMsg.Role, Content: toolMsg.Content, Images: toolMsg.Images, Timestamp: time.Now().UTC().Format(time.RFC3339)}); err != nil {
+			s.journal().bind(ev.ToolCallID, toolMsg.EntryID)
+			if err := s.persistEntry(newMessageEntry(toolMsg)); err != nil {
 				s.bus.Publish(agent.AgentEvent{Type: agent.AgentEventError, Err: fmt.Errorf("会话写入失败（已缓冲，稍后重试）: %w", err)})
 			}
 		case agent.AgentEventTurnEnd:
 			assistantText := strings.TrimSpace(turnBuilder.String())
-			if assistantText != "" {
-				assistant := llm.Message{EntryID: newEntryID(), Role: "assistant", Content: assistantText}
+			var toolCalls []llm.ToolCall
+			var thinking string
+			if ev.Message != nil {
+				toolCalls = ev.Message.ToolCalls
+				thinking = ev.Message.Thinking
+			}
+			if assistantText != "" || len(toolCalls) > 0 {
+				// 推理内容随消息保存；是否发回模型由 context.keep_thinking 决定（见 agent.requestHistory）
+				assistant := llm.Message{EntryID: newEntryID(), Role: "assistant", Content: assistantText, Thinking: thinking, ToolCalls: toolCalls}
 				working = append(working, assistant)
-				if err := s.persistEntry(messageEntry{Type: entryMessage, ID: assistant.EntryID, Role: assistant.Role, Content: assistant.Content, Images: assistant.Images, Timestamp: time.Now().UTC().Format(time.RFC3339)}); err != nil {
+				if err := s.persistEntry(newMessageEntry(assistant)); err != nil {
 					s.bus.Publish(agent.AgentEvent{Type: agent.AgentEventError, Err: fmt.Errorf("会话写入失败（已缓冲，稍后重试）: %w", err)})
 				}
-				lastAssistant = assistantText
+				if assistantText != "" {
+					lastAssistant = assistantText
+				}
 			}
 			turnBuilder.Reset()
 		case agent.AgentEventError:
@@ -347,17 +445,26 @@ func (s *AgentSession) SwitchSession(id string) error {
 	s.sessionID = loaded.ID
 	s.sessionFile = loaded.FilePath
 	s.messages = append([]llm.Message{}, loaded.Messages...)
+	s.usage = loaded.Usage
+	s.warnedTokens, s.warnedCost = false, false
 	if strings.TrimSpace(loaded.Model) != "" {
 		s.model = loaded.Model
 	}
+	s.guard.ResetSession()
 	return nil
 }
 
-func (s *AgentSession) Checkout(entryID string) (string, error) {
+func (s *AgentSession) Checkout(entryID string, opts ...CheckoutOpt) (string, error) {
 	entryID = strings.TrimSpace(entryID)
 	if entryID == "" {
 		return "", fmt.Errorf("entry id cannot be empty")
 	}
+	co := &checkoutOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(co)
+		}
+	}
 
 	s.mu.Lock()
 	if s.streaming {
@@ -369,22 +476,113 @@ func (s *AgentSession) Checkout(entryID string) (string, error) {
 	model := s.model
 	s.mu.Unlock()
 
+	// 先写入缓冲的条目，分支需要读取完整的消息与用量记录
+	if err := s.Save(); err != nil {
+		return "", err
+	}
 	loaded, err := s.manager.CheckoutFromEntry(s.cwd, currentID, currentFile, entryID, model)
 	if err != nil {
 		return "", err
 	}
 
+	// 分支会话只继承该条目之前的文件修改；需要时把之后的修改从工作区撤销
+	keep := make(map[string]bool, len(loaded.Messages))
+	for _, m := range loaded.Messages {
+		if m.EntryID != "" {
+			keep[m.EntryID] = true
+		}
+	}
+	var branch *changeJournal
+	if co.rollbackFiles {
+		branch, _, err = s.journal().rollbackExcept(keep, journalPath(loaded.FilePath))
+		if err != nil {
+			return "", fmt.Errorf("回滚工作区文件失败（会话未切换）: %w", err)
+		}
+	}
+
 	s.mu.Lock()
 	s.sessionID = loaded.ID
 	s.sessionFile = loaded.FilePath
 	s.messages = append([]llm.Message{}, loaded.Messages...)
+	s.usage = loaded.Usage
+	s.warnedTokens, s.warnedCost = false, false
 	if strings.TrimSpace(loaded.Model) != "" {
 		s.model = loaded.Model
 	}
+	if branch != nil {
+		s.journals[loaded.ID] = branch
+	}
 	s.mu.Unlock()
+	s.guard.ResetSession()
 	return loaded.ID, nil
 }
 
+// SetApprover 设置工具调用的交互式审批器；未设置时按 permissions.non_interactive 处理
+func (s *AgentSession) SetApprover(a permission.Approver) {
+	s.guard.SetApprover(a)
+}
+
+// journal 返回当前会话的文件变更日志；首次访问时从会话文件旁的变更日志恢复，
+// 使继续会话或重启后仍可 /undo 之前的修改
+func (s *AgentSession) journal() *changeJournal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.journals == nil {
+		s.journals = make(map[string]*changeJournal)
+	}
+	j, ok := s.journals[s.sessionID]
+	if !ok {
+		j = loadChangeJournal(journalPath(s.sessionFile))
+		s.journals[s.sessionID] = j
+	}
+	return j
+}
+
+// Undo 撤销本会话最近 n 次工具造成的文件修改
+func (s *AgentSession) Undo(n int) ([]ChangeSet, error) {
+	if s.IsStreaming() {
+		return nil, fmt.Errorf("cannot undo while streaming")
+	}
+	return s.journal().undo(n)
+}
+
+// Redo 重做最近撤销的 n 次文件修改
+func (s *AgentSession) Redo(n int) ([]ChangeSet, error) {
+	if s.IsStreaming() {
+		return nil, fmt.Errorf("cannot redo while streaming")
+	}
+	return s.journal().redo(n)
+}
+
+// Changes 返回本会话记录的文件修改（按时间顺序）
+func (s *AgentSession) Changes() []ChangeSet {
+	return s.journal().list()
+}
+
+// Jobs 返回本会话的后台任务管理器
+func (s *AgentSession) Jobs() *tools.JobManager {
+	return s.jobs
+}
+
+// Close 释放会话持有的资源：终止所有后台任务
+func (s *AgentSession) Close() {
+	s.jobs.Close()
+}
+
+func (s *AgentSession) recordPermission(r permission.Record) {
+	entry := permissionEntry{
+		Type:      entryPermission,
+		Tool:      r.ToolName,
+		Args:      trim(r.Args, 500),
+		Allowed:   r.Allowed,
+		Source:    r.Source,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := s.persistEntry(entry); err != nil {
+		s.bus.Publish(agent.AgentEvent{Type: agent.AgentEventError, Err: fmt.Errorf("会话写入失败（已缓冲，稍后重试）: %w", err)})
+	}
+}
+
 func (s *AgentSession) finishStreaming() {
 	s.mu.Lock()
 	s.streaming = false
@@ -397,6 +595,7 @@ func (s *AgentSession) tryCompact() error {
 	messages := make([]llm.Message, len(s.messages))
 	copy(messages, s.messages)
 	model := s.model
+	opts := s.generationOptions(model)
 	maxTokens := s.cfg.Context.MaxTokens
 	threshold := s.cfg.Context.CompactionThreshold
 	keepRecent := s.cfg.Context.KeepRecent
@@ -410,7 +609,9 @@ func (s *AgentSession) tryCompact() error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
-	res, err := CompactMessages(ctx, s.client, model, messages, keepRecent, s.estimator)
+	// 压缩请求同样受预算约束并计入用量；预算用尽时 CompactMessages 退化为本地摘要
+	client := &budgetClient{next: s.chat, check: s.checkBudget, record: func(m string, u llm.Usage) { s.recordUsage(m, u, nil) }}
+	res, err := CompactMessages(ctx, client, model, &opts, messages, keepRecent, s.estimator)
 	if err != nil || res == nil {
 		s.bus.Publish(agent.AgentEvent{Type: agent.AgentEventError, Err: err})
 		return err
@@ -460,3 +661,24 @@ func (s *AgentSession) persistEntry(entry any) error {
 	s.mu.Unlock()
 	return nil
 }
+
+// toolCallingMode 解析 ollama.tool_calling；auto 模式下通过实际处理该模型请求的 client
+// 探测模型能力（客户端按模型缓存），不支持原生工具调用的模型直接使用 ReAct
+func (s *AgentSession) toolCallingMode(ctx context.Context, model string) agent.ToolCallingMode {
+	mode := agent.ParseToolCallingMode(s.cfg.Ollama.ToolCalling)
+	if mode != agent.ToolCallingAuto {
+		return mode
+	}
+	s.mu.Lock()
+	client := s.clientFor(model)
+	s.mu.Unlock()
+	prober, ok := client.(llm.ToolSupportProber)
+	if !ok {
+		return mode
+	}
+	supported, err := prober.SupportsTools(ctx, model)
+	if err != nil || supported {
+		return mode
+	}
+	return agent.ToolCallingReAct
+}
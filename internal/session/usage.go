@@ -0,0 +1,104 @@
+package session
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yangruihan/go-pi/internal/agent"
+	"github.com/yangruihan/go-pi/internal/config"
+	"github.com/yangruihan/go-pi/internal/llm"
+)
+
+// UsageStats 会话累计的 token 用量（后端返回的实际值）
+type UsageStats struct {
+	PromptTokens     int
+	CompletionTokens int
+	Requests         int                  // 返回了用量的请求数
+	LastPromptTokens int                  // 最近一次请求的输入 token 数，约等于当前上下文大小
+	ByModel          map[string]llm.Usage // 按模型累计
+	Cost             float64              // 按 models.yaml 价格累计的费用，未配置价格的模型不计入
+}
+
+// TotalTokens 返回累计输入与输出 token 之和
+func (u UsageStats) TotalTokens() int { return u.PromptTokens + u.CompletionTokens }
+
+func (u *UsageStats) add(model string, usage llm.Usage) {
+	u.PromptTokens += usage.PromptTokens
+	u.CompletionTokens += usage.CompletionTokens
+	u.Requests++
+	u.LastPromptTokens = usage.PromptTokens
+	if u.ByModel == nil {
+		u.ByModel = map[string]llm.Usage{}
+	}
+	m := u.ByModel[model]
+	m.PromptTokens += usage.PromptTokens
+	m.CompletionTokens += usage.CompletionTokens
+	u.ByModel[model] = m
+}
+
+func (u UsageStats) clone() UsageStats {
+	out := u
+	out.ByModel = make(map[string]llm.Usage, len(u.ByModel))
+	for k, v := range u.ByModel {
+		out.ByModel[k] = v
+	}
+	return out
+}
+
+type costEntry struct {
+	Type      entryType `json:"type"`
+	Model     string    `json:"model"`
+	Amount    float64   `json:"amount"` // 本次请求费用
+	Total     float64   `json:"total"`  // 会话累计费用
+	Timestamp string    `json:"timestamp"`
+}
+
+type usageEntry struct {
+	Type             entryType `json:"type"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Timestamp        string    `json:"timestamp"`
+}
+
+// Usage 返回本会话累计的 token 用量（继续或切换会话时包含历史记录）
+func (s *AgentSession) Usage() UsageStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage.clone()
+}
+
+// recordUsage 累计一次请求的用量，校准 token 估算并写入会话 JSONL；
+// request 为该次请求发送的消息历史，为 nil 时不校准
+func (s *AgentSession) recordUsage(model string, usage llm.Usage, request []llm.Message) {
+	if request != nil {
+		s.estimator.Calibrate(request, usage.PromptTokens)
+	}
+	s.mu.Lock()
+	s.usage.add(model, usage)
+	price, priced := config.ResolveModelPricing(model, s.profiles)
+	var cost float64
+	if priced {
+		cost = price.Cost(usage.PromptTokens, usage.CompletionTokens)
+		s.usage.Cost += cost
+	}
+	total := s.usage.Cost
+	s.mu.Unlock()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	entries := []any{usageEntry{
+		Type:             entryUsage,
+		Model:            model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Timestamp:        now,
+	}}
+	if priced {
+		entries = append(entries, costEntry{Type: entryCost, Model: model, Amount: cost, Total: total, Timestamp: now})
+	}
+	for _, entry := range entries {
+		if err := s.persistEntry(entry); err != nil {
+			s.bus.Publish(agent.AgentEvent{Type: agent.AgentEventError, Err: fmt.Errorf("会话写入失败（已缓冲，稍后重试）: %w", err)})
+		}
+	}
+}
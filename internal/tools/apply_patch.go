@@ -0,0 +1,185 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/yangruihan/go-pi/internal/llm"
+)
+
+// PatchPreviewMaxBytes dry-run 返回的 diff 上限
+const PatchPreviewMaxBytes = 16 * 1024
+
+// ApplyPatchArgs apply_patch 参数
+type ApplyPatchArgs struct {
+	Patch  string `json:"patch"`
+	DryRun bool   `json:"dry_run,omitempty"`
+}
+
+// ApplyPatchTool 多文件补丁工具：全部 hunk 成功才写入
+type ApplyPatchTool struct{}
+
+func NewApplyPatchTool() *ApplyPatchTool { return &ApplyPatchTool{} }
+
+func (t *ApplyPatchTool) Name() string { return "apply_patch" }
+
+func (t *ApplyPatchTool) Description() string {
+	return `一次修改多个文件/多处位置。patch 支持两种格式：
+1) unified diff：--- a/路径、+++ b/路径、@@ -起始,行数 +起始,行数 @@，行首 ' ' 上下文、'-' 删除、'+' 新增；--- /dev/null 表示新建，+++ /dev/null 表示删除。
+2) SEARCH/REPLACE 块：先单独一行写文件路径，然后
+<<<<<<< SEARCH
+原内容
+=======
+新内容
+>>>>>>> REPLACE
+（SEARCH 必须唯一匹配；SEARCH 为空表示追加或新建文件）。
+上下文匹配会容忍行号偏移和空白差异；任何一处无法匹配则全部不写入并报告被拒绝的块。dry_run=true 时只返回结果 diff 不写文件。`
+}
+
+func (t *ApplyPatchTool) Schema() llm.ToolParameters {
+	return llm.ToolParameters{
+		Type: "object",
+		Properties: map[string]llm.ToolProperty{
+			"patch":   {Type: "string", Description: "unified diff 或 SEARCH/REPLACE 块文本"},
+			"dry_run": {Type: "boolean", Description: "仅预览结果 diff，不写入文件，默认 false"},
+		},
+		Required: []string{"patch"},
+	}
+}
+
+func (t *ApplyPatchTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	var a ApplyPatchArgs
+	if err := json.Unmarshal(args, &a); err != nil {
+		return "", fmt.Errorf("parse apply_patch args: %w", err)
+	}
+	if strings.TrimSpace(a.Patch) == "" {
+		return "", fmt.Errorf("patch cannot be empty")
+	}
+
+	patches, err := parsePatch(a.Patch)
+	if err != nil {
+		return "", err
+	}
+	policy := pathPolicyFrom(ctx)
+	targets := make(map[string]string, len(patches))
+	for _, p := range patches {
+		target, err := policy.checkFile(p.path)
+		if err != nil {
+			return "", err
+		}
+		targets[p.path] = target
+	}
+	files, rejects := applyPatches(patches)
+	if len(rejects) > 0 {
+		return "", fmt.Errorf("%s", formatRejects(rejects, countHunks(patches)))
+	}
+	for _, f := range files {
+		f.target = targets[f.path]
+	}
+
+	for _, f := range files {
+		if err := policy.CheckSize(f.path, int64(len(f.content()))); err != nil {
+			return "", err
+		}
+	}
+
+	if a.DryRun {
+		var b strings.Builder
+		b.WriteString("预览（dry_run，未写入任何文件）:\n")
+		for _, f := range files {
+			b.WriteString(UnifiedDiff(f.path, f.original, f.content(), f.created && !f.existed, f.deleted))
+		}
+		out := b.String()
+		if len(out) > PatchPreviewMaxBytes {
+			out = out[:PatchPreviewMaxBytes] + fmt.Sprintf("\n... [diff 超过 %d 字节，已截断]", PatchPreviewMaxBytes)
+		}
+		return strings.TrimRight(out, "\n"), nil
+	}
+
+	// 与 edit_file 相同：读取过的文件若在此之后被改动则整体拒绝，避免覆盖这些修改
+	tracker := fileTrackerFrom(ctx)
+	for _, f := range files {
+		if f.existed {
+			if err := tracker.CheckFresh(f.path); err != nil {
+				return "", err
+			}
+		}
+	}
+	for _, f := range files {
+		recordChange(ctx, f.path)
+	}
+	if err := writePatchedFiles(files); err != nil {
+		return "", err
+	}
+	// 已读取过的文件同步记录新内容，避免后续 edit_file 被误判为过期
+	for _, f := range files {
+		if tracker.Seen(f.path) {
+			tracker.Record(f.path)
+		}
+	}
+	return formatPatchSummary(files), nil
+}
+
+func countHunks(patches []filePatch) int {
+	n := 0
+	for _, p := range patches {
+		n += len(p.hunks)
+		if len(p.hunks) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// formatPatchSummary 列出每个文件的变更统计与模糊匹配说明
+func formatPatchSummary(files []*patchedFile) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "已应用补丁（%d 个文件）:", len(files))
+	for _, f := range files {
+		added, removed := 0, 0
+		for _, op := range diffLines(splitDiffLines(f.original), splitDiffLines(f.content())) {
+			switch op.kind {
+			case '+':
+				added++
+			case '-':
+				removed++
+			}
+		}
+		status := "M"
+		switch {
+		case f.deleted:
+			status = "D"
+		case !f.existed:
+			status = "A"
+		}
+		fmt.Fprintf(&b, "\n  %s %s (+%d -%d)", status, f.path, added, removed)
+		for _, note := range f.notes {
+			fmt.Fprintf(&b, "\n    %s", note)
+		}
+	}
+	return b.String()
+}
+
+// formatRejects 报告被拒绝的 hunk 及其期望内容
+func formatRejects(rejects []hunkReject, total int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "补丁未应用（全部或全不）：%d/%d 个修改块被拒绝，未写入任何文件", len(rejects), total)
+	for _, r := range rejects {
+		fmt.Fprintf(&b, "\n\n[%s] #%d %s: %s", r.path, r.index, r.header, r.reason)
+		expected := oldSide(r.hunk.ops)
+		if len(expected) == 0 {
+			continue
+		}
+		b.WriteString("\n期望匹配的内容:")
+		for i, l := range expected {
+			if i >= 12 {
+				fmt.Fprintf(&b, "\n  ... (共 %d 行)", len(expected))
+				break
+			}
+			b.WriteString("\n  | " + l)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runApplyPatch(t *testing.T, patch string, dryRun bool) (string, error) {
+	t.Helper()
+	args, err := json.Marshal(ApplyPatchArgs{Patch: patch, DryRun: dryRun})
+	require.NoError(t, err)
+	return NewApplyPatchTool().Execute(context.Background(), args)
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestApplyPatchUnifiedMultiFile(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.go")
+	b := filepath.Join(dir, "b.go")
+	writeTestFile(t, a, "package a\n\nfunc A() int {\n\treturn 1\n}\n\nfunc B() int {\n\treturn 2\n}\n")
+	writeTestFile(t, b, "package b\n\nvar x = 1\n")
+	newFile := filepath.Join(dir, "sub", "c.go")
+
+	patch := "--- " + a + "\n+++ " + a + "\n" +
+		// 行号故意偏移，且上下文缩进与文件不同（空格 vs tab）
+		"@@ -5,3 +5,3 @@\n func A() int {\n-    return 1\n+\treturn 10\n }\n" +
+		"@@ -7,3 +7,3 @@\n func B() int {\n-\treturn 2\n+\treturn 20\n }\n" +
+		"--- " + b + "\n+++ " + b + "\n@@ -3 +3 @@\n-var x = 1\n+var x = 2\n" +
+		"--- /dev/null\n+++ " + newFile + "\n@@ -0,0 +1,2 @@\n+package sub\n+\n"
+
+	out, err := runApplyPatch(t, patch, false)
+	require.NoError(t, err)
+	assert.Contains(t, out, "已应用补丁（3 个文件）")
+	assert.Contains(t, out, "偏移")
+
+	assert.Equal(t, "package a\n\nfunc A() int {\n\treturn 10\n}\n\nfunc B() int {\n\treturn 20\n}\n", readTestFile(t, a))
+	assert.Equal(t, "package b\n\nvar x = 2\n", readTestFile(t, b))
+	assert.Equal(t, "package sub\n\n", readTestFile(t, newFile))
+}
+
+func TestApplyPatchAllOrNothing(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	writeTestFile(t, a, "one\ntwo\nthree\n")
+	writeTestFile(t, b, "alpha\nbeta\n")
+
+	patch := a + "\n<<<<<<< SEARCH\ntwo\n=======\n2\n>>>>>>> REPLACE\n\n" +
+		b + "\n<<<<<<< SEARCH\ngamma\n=======\nGAMMA\n>>>>>>> REPLACE\n"
+
+	_, err := runApplyPatch(t, patch, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1/2 个修改块被拒绝")
+	assert.Contains(t, err.Error(), "b.txt] #1 SEARCH/REPLACE #1")
+	assert.Contains(t, err.Error(), "| gamma")
+
+	assert.Equal(t, "one\ntwo\nthree\n", readTestFile(t, a), "有块被拒绝时不应写入任何文件")
+}
+
+func TestApplyPatchSearchReplaceAmbiguous(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	writeTestFile(t, a, "x = 1\ny = 2\nx = 1\n")
+
+	_, err := runApplyPatch(t, a+"\n<<<<<<< SEARCH\nx = 1\n=======\nx = 3\n>>>>>>> REPLACE\n", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "匹配到 2 处")
+}
+
+func TestApplyPatchDryRun(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	writeTestFile(t, a, "one\r\ntwo\r\nthree\r\n")
+
+	patch := a + "\n<<<<<<< SEARCH\ntwo   \n=======\nTWO\n>>>>>>> REPLACE\n"
+	out, err := runApplyPatch(t, patch, true)
+	require.NoError(t, err)
+	assert.Contains(t, out, "dry_run")
+	assert.Contains(t, out, "-two\n+TWO")
+	assert.Equal(t, "one\r\ntwo\r\nthree\r\n", readTestFile(t, a))
+
+	_, err = runApplyPatch(t, patch, false)
+	require.NoError(t, err)
+	assert.Equal(t, "one\r\nTWO\r\nthree\r\n", readTestFile(t, a), "保留 CRLF 换行")
+}
+
+func TestUnifiedDiffHunks(t *testing.T) {
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	updated := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n"
+	diff := UnifiedDiff("n.txt", old, updated, false, false)
+	assert.Equal(t, "--- a/n.txt\n+++ b/n.txt\n"+
+		"@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n"+
+		"@@ -8,3 +8,4 @@\n 8\n 9\n 10\n+11\n", diff)
+}
@@ -4,10 +4,16 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -29,25 +35,31 @@ type BashArgs struct {
 }
 
 // BashTool 是持久化 shell 工具
-// 维护一个持久化的 bash/cmd 进程，保留工作目录和环境变量
+// 维护一个持久化的 bash 进程，保留工作目录和环境变量（Windows 下退化为逐条执行）
 type BashTool struct {
+	opts    Options
 	mu      sync.Mutex
 	cmd     *exec.Cmd
 	stdin   io.WriteCloser
-	stdout  io.ReadCloser
-	stderr  io.ReadCloser
+	output  chan string   // shell 合并输出（stdout+stderr）的分块流，进程退出后关闭
+	exited  chan struct{} // shell 进程退出
+	cwd     string        // 最近一次命令结束时的工作目录，重启时沿用
 	started bool
 }
 
 // NewBashTool 创建一个新的 BashTool
-func NewBashTool() *BashTool {
-	return &BashTool{}
+func NewBashTool(opts Options) *BashTool {
+	return &BashTool{opts: opts.normalize()}
 }
 
 func (b *BashTool) Name() string { return "bash" }
 
 func (b *BashTool) Description() string {
-	return "在持久化的 shell 进程中执行 bash 命令。支持 cd 切换目录，状态在多次调用间保留。命令超时时间默认 30s，输出超过 8KB 自动截断。"
+	desc := fmt.Sprintf("在持久化的 shell 进程中执行 bash 命令。支持 cd 切换目录，工作目录和环境变量在多次调用间保留；结果末尾附带退出码和当前工作目录。命令超时时间默认 %s（超时会终止命令并重启 shell），输出超过 %d 字节自动截断。", b.opts.BashTimeout, b.opts.BashMaxOutput)
+	if b.opts.RestrictShell {
+		desc += "运行在受限环境中：仅保留基础环境变量，网络可能不可用。"
+	}
+	return desc
 }
 
 func (b *BashTool) Schema() llm.ToolParameters {
@@ -60,7 +72,7 @@ func (b *BashTool) Schema() llm.ToolParameters {
 			},
 			"timeout": {
 				Type:        "integer",
-				Description: "超时时间（秒），默认 30",
+				Description: fmt.Sprintf("超时时间（秒），默认 %d", int(b.opts.BashTimeout.Seconds())),
 			},
 		},
 		Required: []string{"command"},
@@ -73,42 +85,91 @@ func (b *BashTool) ensureStarted() error {
 		return nil
 	}
 
-	// 使用 cmd.exe /K 保持 shell 存活（Windows），Linux/Mac 使用 bash
-	var cmd *exec.Cmd
-	// 检测系统，使用 bash on Unix-like，cmd/powershell on Windows
-	if isWindows() {
-		cmd = exec.Command("cmd", "/Q")
-	} else {
-		cmd = exec.Command("bash")
+	cmd := shellCommand(b.opts.RestrictShell, "bash", "--noprofile", "--norc")
+	if b.cwd == "" {
+		b.cwd, _ = os.Getwd()
 	}
+	if b.cwd != "" {
+		if info, err := os.Stat(b.cwd); err == nil && info.IsDir() {
+			cmd.Dir = b.cwd
+		}
+	}
+	setProcessGroup(cmd)
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return fmt.Errorf("create stdin pipe: %w", err)
 	}
-	stdout, err := cmd.StdoutPipe()
+	// stdout 与 stderr 共用一个管道，保证输出顺序与终端一致
+	pr, pw, err := os.Pipe()
 	if err != nil {
-		return fmt.Errorf("create stdout pipe: %w", err)
-	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("create stderr pipe: %w", err)
+		return fmt.Errorf("create output pipe: %w", err)
 	}
+	cmd.Stdout = pw
+	cmd.Stderr = pw
 
 	if err := cmd.Start(); err != nil {
+		pr.Close()
+		pw.Close()
 		return fmt.Errorf("start shell: %w", err)
 	}
+	pw.Close()
+
+	output := make(chan string, 256)
+	go func() {
+		defer close(output)
+		defer pr.Close()
+		reader := bufio.NewReaderSize(pr, 64*1024)
+		for {
+			chunk, err := reader.ReadSlice('\n')
+			if len(chunk) > 0 {
+				output <- string(chunk)
+			}
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
 
 	b.cmd = cmd
 	b.stdin = stdin
-	b.stdout = stdout
-	b.stderr = stderr
+	b.output = output
+	b.exited = exited
 	b.started = true
 	return nil
 }
 
-// Execute 执行 bash 命令，流式返回输出
+// stop 终止 shell 进程组并丢弃剩余输出，下次调用时重新启动
+func (b *BashTool) stop() {
+	if !b.started {
+		return
+	}
+	killProcessGroup(b.cmd)
+	b.stdin.Close()
+	go func(output <-chan string) {
+		for range output {
+		}
+	}(b.output)
+	<-b.exited
+	b.started = false
+}
+
+// Execute 在持久化 shell 中执行命令
 func (b *BashTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	return b.ExecuteStream(ctx, args, nil)
+}
+
+// ExecuteStream 在持久化 shell 中执行命令，并通过 onProgress 实时回传输出
+func (b *BashTool) ExecuteStream(ctx context.Context, args json.RawMessage, onProgress ProgressFunc) (string, error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -121,7 +182,7 @@ func (b *BashTool) Execute(ctx context.Context, args json.RawMessage) (string, e
 		return "", fmt.Errorf("command cannot be empty")
 	}
 
-	timeout := BashTimeout
+	timeout := b.opts.BashTimeout
 	if a.Timeout > 0 {
 		timeout = time.Duration(a.Timeout) * time.Second
 	}
@@ -129,38 +190,158 @@ func (b *BashTool) Execute(ctx context.Context, args json.RawMessage) (string, e
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	// 直接使用 exec.CommandContext 执行单次命令（兼容性更好）
-	result, err := b.runCommand(ctx, a.Command)
-	if err == nil {
-		return result, nil
+	if isWindows() {
+		return b.runCommand(ctx, a.Command, onProgress)
+	}
+
+	result, err := b.runInShell(ctx, a.Command, onProgress)
+	if err == errShellUnavailable && ctx.Err() == nil {
+		// shell 已崩溃或无法写入：重启后重试一次
+		b.stop()
+		return b.runInShell(ctx, a.Command, onProgress)
+	}
+	return result, err
+}
+
+var errShellUnavailable = errors.New("shell 不可用")
+
+// runInShell 以哨兵行分隔的方式在持久化 shell 中执行一条命令
+// 命令通过 heredoc 读入后 eval，语法错误不会导致 shell 退出；stdin 重定向到 /dev/null，
+// 避免命令读取 shell 自身的输入流
+func (b *BashTool) runInShell(ctx context.Context, command string, onProgress ProgressFunc) (string, error) {
+	if err := b.ensureStarted(); err != nil {
+		return "", err
+	}
+
+	token := newShellToken()
+	sentinel := "__GOPI_DONE_" + token
+	script := fmt.Sprintf("__gopi_cmd=$(cat <<'__GOPI_EOF_%[1]s'\n%[2]s\n__GOPI_EOF_%[1]s\n)\n"+
+		"eval \"$__gopi_cmd\" </dev/null\n"+
+		"printf '\\n%[3]s %%d %%s\\n' \"$?\" \"$PWD\"\n", token, command, sentinel)
+	if _, err := io.WriteString(b.stdin, script); err != nil {
+		return "", errShellUnavailable
+	}
+
+	var out bytes.Buffer
+	truncated := false
+	appendOutput := func(chunk string) {
+		if truncated {
+			return
+		}
+		if out.Len()+len(chunk) > b.opts.BashMaxOutput {
+			// 退回到字符边界，避免把多字节字符截成半个（该字符可能跨越前一块）
+			out.WriteString(chunk)
+			data, limit := out.Bytes(), b.opts.BashMaxOutput
+			for limit > 0 && !utf8.RuneStart(data[limit]) {
+				limit--
+			}
+			out.Truncate(limit)
+			truncated = true
+			return
+		}
+		out.WriteString(chunk)
+	}
+	render := func() string {
+		combined := strings.TrimSuffix(normalizeShellOutput(out.Bytes()), "\n")
+		if truncated {
+			combined += fmt.Sprintf("\n... [输出超过 %d 字节，已截断]", b.opts.BashMaxOutput)
+		}
+		return combined
 	}
 
-	// 崩溃/启动异常自动重试一次（Phase4 健壮性）
-	if ctx.Err() == nil {
-		retryResult, retryErr := b.runCommand(ctx, a.Command)
-		if retryErr == nil {
-			if strings.TrimSpace(result) != "" {
-				retryResult = strings.TrimSpace(result) + "\n[bash 已自动重试恢复]\n" + retryResult
+	var pending string
+	for {
+		select {
+		case chunk, ok := <-b.output:
+			if !ok {
+				// shell 在命令执行过程中退出（如 exit、set -e）
+				if pending != "" {
+					onProgress(normalizeShellOutput([]byte(pending)))
+				}
+				exitCode := -1
+				<-b.exited
+				if b.cmd.ProcessState != nil {
+					exitCode = b.cmd.ProcessState.ExitCode()
+				}
+				b.started = false
+				if out.Len() == 0 && !truncated && exitCode < 0 {
+					return "", errShellUnavailable
+				}
+				return formatShellResult(render(), exitCode, b.cwd) +
+					"\n[shell 已退出，下次调用将在原工作目录重新启动，环境变量已重置]", nil
+			}
+			if strings.HasPrefix(chunk, sentinel+" ") {
+				if pending = strings.TrimSuffix(pending, "\n"); pending != "" {
+					onProgress(normalizeShellOutput([]byte(pending)))
+				}
+				exitCode, cwd := parseSentinel(strings.TrimSpace(strings.TrimPrefix(chunk, sentinel+" ")))
+				if cwd != "" {
+					b.cwd = cwd
+				}
+				return formatShellResult(render(), exitCode, b.cwd), nil
+			}
+			appendOutput(chunk)
+			if onProgress != nil {
+				// 延后一块转发，便于在命令结束时去掉哨兵前补的换行
+				if pending != "" {
+					onProgress(normalizeShellOutput([]byte(pending)))
+				}
+				pending = chunk
+			}
+
+		case <-ctx.Done():
+			if pending != "" {
+				onProgress(normalizeShellOutput([]byte(pending)))
 			}
-			return retryResult, nil
+			b.stop()
+			combined := render()
+			if ctx.Err() == context.DeadlineExceeded {
+				return combined, fmt.Errorf("命令超时，shell 已重启（工作目录保留，环境变量已重置）（已执行的输出：%s）", combined)
+			}
+			return combined, ctx.Err()
 		}
 	}
+}
 
-	return result, err
+// parseSentinel 解析哨兵行中的 "<exit code> <cwd>"
+func parseSentinel(s string) (int, string) {
+	codeText, cwd, _ := strings.Cut(s, " ")
+	code, err := strconv.Atoi(codeText)
+	if err != nil {
+		code = -1
+	}
+	return code, cwd
 }
 
-// runCommand 使用独立进程执行命令（跨平台兼容）
-func (b *BashTool) runCommand(ctx context.Context, command string) (string, error) {
-	var cmd *exec.Cmd
-	if isWindows() {
-		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
-	} else {
-		cmd = exec.CommandContext(ctx, "bash", "-c", command)
+// formatShellResult 在输出末尾附加退出码和工作目录
+func formatShellResult(output string, exitCode int, cwd string) string {
+	status := fmt.Sprintf("[退出码: %d | 工作目录: %s]", exitCode, cwd)
+	if strings.TrimSpace(output) == "" {
+		return status
 	}
+	return output + "\n\n" + status
+}
+
+// newShellToken 生成哨兵随机后缀，避免与命令输出冲突
+func newShellToken() string {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// runCommand 使用独立进程执行命令（Windows 下不支持持久化 shell）
+func (b *BashTool) runCommand(ctx context.Context, command string, onProgress ProgressFunc) (string, error) {
+	cmd := exec.CommandContext(ctx, "cmd", "/C", command)
 
 	var outBuf, errBuf bytes.Buffer
 	cmd.Stdout = &outBuf
 	cmd.Stderr = &errBuf
+	if onProgress != nil {
+		cmd.Stdout = io.MultiWriter(&outBuf, progressWriter(onProgress))
+		cmd.Stderr = io.MultiWriter(&errBuf, progressWriter(onProgress))
+	}
 
 	err := cmd.Run()
 
@@ -175,8 +356,8 @@ func (b *BashTool) runCommand(ctx context.Context, command string) (string, erro
 	combined := normalizeShellOutput(combinedBytes)
 
 	// 截断超长输出
-	if len(combined) > BashOutputMaxBytes {
-		combined = combined[:BashOutputMaxBytes] + fmt.Sprintf("\n... [输出超过 %d 字节，已截断]", BashOutputMaxBytes)
+	if len(combined) > b.opts.BashMaxOutput {
+		combined = combined[:b.opts.BashMaxOutput] + fmt.Sprintf("\n... [输出超过 %d 字节，已截断]", b.opts.BashMaxOutput)
 	}
 
 	if err != nil {
@@ -193,6 +374,14 @@ func (b *BashTool) runCommand(ctx context.Context, command string) (string, erro
 	return combined, nil
 }
 
+// progressWriter 将写入内容实时转发给 onProgress
+type progressWriter ProgressFunc
+
+func (w progressWriter) Write(p []byte) (int, error) {
+	w(normalizeShellOutput(p))
+	return len(p), nil
+}
+
 func normalizeShellOutput(raw []byte) string {
 	if len(raw) == 0 {
 		return ""
@@ -223,34 +412,16 @@ func (b *BashTool) Close() {
 		return
 	}
 
+	// 先关闭 stdin 让 shell 正常退出，超时后再强制终止进程组
 	b.stdin.Close()
-	b.cmd.Wait()
-	b.started = false
+	select {
+	case <-b.exited:
+	case <-time.After(2 * time.Second):
+	}
+	b.stop()
 }
 
 // isWindows 检测是否在 Windows 上运行
 func isWindows() bool {
-	// 检测 GOARCH/GOOS 在编译时确定，通过文件分隔符检测更可靠
-	return exec.Command("cmd", "/C", "echo test").Run() == nil
-}
-
-// streamReader 从 reader 读取内容，直到 sentinel 标记
-func streamReader(r io.Reader, sentinel string, maxBytes int) (string, error) {
-	var buf strings.Builder
-	scanner := bufio.NewScanner(r)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, sentinel) {
-			break
-		}
-		buf.WriteString(line)
-		buf.WriteString("\n")
-		if buf.Len() > maxBytes {
-			buf.WriteString(fmt.Sprintf("... [输出超过 %d 字节，已截断]", maxBytes))
-			break
-		}
-	}
-
-	return buf.String(), scanner.Err()
+	return runtime.GOOS == "windows"
 }
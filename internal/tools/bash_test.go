@@ -0,0 +1,127 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runBash(t *testing.T, b *BashTool, command string) (string, error) {
+	t.Helper()
+	args, err := json.Marshal(BashArgs{Command: command})
+	require.NoError(t, err)
+	return b.Execute(context.Background(), args)
+}
+
+func newTestBashTool(t *testing.T, opts Options) *BashTool {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("持久化 shell 仅支持类 Unix 系统")
+	}
+	b := NewBashTool(opts)
+	t.Cleanup(b.Close)
+	return b
+}
+
+func TestBashToolPersistsCwd(t *testing.T) {
+	b := newTestBashTool(t, DefaultOptions())
+
+	_, err := runBash(t, b, "cd /tmp")
+	require.NoError(t, err)
+
+	out, err := runBash(t, b, "pwd")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "/tmp\n"), out)
+	assert.Contains(t, out, "[退出码: 0 | 工作目录: /tmp]")
+}
+
+func TestBashToolPersistsEnvAndExitCode(t *testing.T) {
+	b := newTestBashTool(t, DefaultOptions())
+
+	_, err := runBash(t, b, "export GOPI_TEST_VAR=hello")
+	require.NoError(t, err)
+
+	out, err := runBash(t, b, "echo $GOPI_TEST_VAR; echo oops >&2; false")
+	require.NoError(t, err)
+	assert.Contains(t, out, "hello\noops")
+	assert.Contains(t, out, "[退出码: 1 |")
+
+	// 语法错误不应杀死 shell
+	out, err = runBash(t, b, "if then")
+	require.NoError(t, err)
+	assert.Contains(t, out, "[退出码: 2 |")
+
+	out, err = runBash(t, b, "echo $GOPI_TEST_VAR")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "hello\n"), out)
+}
+
+func TestBashToolTimeoutRestartsShell(t *testing.T) {
+	opts := DefaultOptions()
+	opts.BashTimeout = 300 * time.Millisecond
+	b := newTestBashTool(t, opts)
+
+	_, err := runBash(t, b, "cd /tmp")
+	require.NoError(t, err)
+
+	_, err = runBash(t, b, "echo start; sleep 10")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "命令超时")
+
+	// 重启后沿用原工作目录
+	out, err := runBash(t, b, "pwd")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "/tmp\n"), out)
+}
+
+func TestBashToolRecoversFromExit(t *testing.T) {
+	b := newTestBashTool(t, DefaultOptions())
+
+	out, err := runBash(t, b, "echo bye; exit 3")
+	require.NoError(t, err)
+	assert.Contains(t, out, "bye")
+	assert.Contains(t, out, "[退出码: 3 |")
+
+	out, err = runBash(t, b, "echo again")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "again\n"), out)
+}
+
+func TestBashToolTruncatesOutput(t *testing.T) {
+	opts := DefaultOptions()
+	opts.BashMaxOutput = 100
+	b := newTestBashTool(t, opts)
+
+	out, err := runBash(t, b, "yes x | head -n 1000")
+	require.NoError(t, err)
+	assert.Contains(t, out, "[输出超过 100 字节，已截断]")
+	assert.Contains(t, out, "[退出码: 0 |")
+
+	// 截断点落在多字节字符中间时退回到字符边界
+	out, err = runBash(t, b, "printf 'a%.0s' $(seq 99); printf '中文'")
+	require.NoError(t, err)
+	assert.True(t, utf8.ValidString(out), out)
+	assert.True(t, strings.HasPrefix(out, strings.Repeat("a", 99)+"\n..."), out)
+}
+
+func TestBashToolStreamsProgress(t *testing.T) {
+	b := newTestBashTool(t, DefaultOptions())
+
+	var chunks []string
+	args, err := json.Marshal(BashArgs{Command: "echo one; echo two"})
+	require.NoError(t, err)
+	out, err := b.ExecuteStream(context.Background(), args, func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "one\ntwo\n", strings.Join(chunks, ""))
+	assert.True(t, strings.HasPrefix(out, "one\ntwo\n"), out)
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package tools
+
+import "os/exec"
+
+// setProcessGroup Windows 下不做进程组设置
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup 终止 shell 进程
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	_ = cmd.Process.Kill()
+}
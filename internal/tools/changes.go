@@ -0,0 +1,22 @@
+package tools
+
+import "context"
+
+// ChangeRecorder 在工具修改文件之前保存原内容（由会话层的变更日志实现）
+type ChangeRecorder interface {
+	BeforeChange(path string)
+}
+
+type changeRecorderKey struct{}
+
+// WithChangeRecorder 返回携带变更记录器的 context，供修改文件的工具使用
+func WithChangeRecorder(ctx context.Context, r ChangeRecorder) context.Context {
+	return context.WithValue(ctx, changeRecorderKey{}, r)
+}
+
+// recordChange 通知记录器 path 即将被修改；未设置记录器时不做任何事
+func recordChange(ctx context.Context, path string) {
+	if r, ok := ctx.Value(changeRecorderKey{}).(ChangeRecorder); ok && r != nil {
+		r.BeforeChange(path)
+	}
+}
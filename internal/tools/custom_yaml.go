@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,15 +24,52 @@ type yamlToolsFile struct {
 type yamlToolSpec struct {
 	Name        string `yaml:"name"`
 	Description string `yaml:"description"`
-	Command     string `yaml:"command"`
-	TimeoutSec  int    `yaml:"timeout_sec"`
+	// Command 通过 shell 执行；其中的 {{param}} 替换为对应环境变量的引用（不拼接参数值）
+	Command string `yaml:"command"`
+	// Argv 不经 shell 直接执行；每个元素中的 {{param}} 替换为参数值，元素恰为 {{数组参数}} 时展开为多个参数
+	Argv       []string          `yaml:"argv"`
+	Params     []yamlToolParam   `yaml:"params"`
+	Workdir    string            `yaml:"workdir"`
+	Env        map[string]string `yaml:"env"`
+	Stdin      string            `yaml:"stdin"`
+	Output     yamlToolOutput    `yaml:"output"`
+	TimeoutSec int               `yaml:"timeout_sec"`
 }
 
+type yamlToolParam struct {
+	Name        string   `yaml:"name"`
+	Type        string   `yaml:"type"` // string（默认） / integer / number / boolean / array（字符串数组）
+	Description string   `yaml:"description"`
+	Enum        []string `yaml:"enum"`
+	Required    bool     `yaml:"required"`
+	Default     any      `yaml:"default"`
+}
+
+type yamlToolOutput struct {
+	Format   string `yaml:"format"`    // text（默认，去除首尾空白） / json（校验后原样返回）
+	MaxBytes int    `yaml:"max_bytes"` // 默认 BashOutputMaxBytes
+}
+
+// yamlParamValue 校验后的参数值；数组参数同时保留各元素
+type yamlParamValue struct {
+	text  string
+	items []string
+}
+
+var (
+	yamlTemplateRe  = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	yamlParamNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// legacyInputParam 未声明 params 的旧版工具使用的单个 input 参数
+var legacyInputParam = yamlToolParam{Name: "input", Type: "string", Description: "传给脚本的文本参数"}
+
 type yamlShellTool struct {
 	name        string
 	description string
-	command     string
+	spec        yamlToolSpec
 	timeout     time.Duration
+	restricted  bool // 与 bash 一致遵循 sandbox.restrict_bash
 }
 
 func (t *yamlShellTool) Name() string { return t.name }
@@ -37,48 +77,271 @@ func (t *yamlShellTool) Name() string { return t.name }
 func (t *yamlShellTool) Description() string { return t.description }
 
 func (t *yamlShellTool) Schema() llm.ToolParameters {
-	return llm.ToolParameters{
-		Type: "object",
-		Properties: map[string]llm.ToolProperty{
-			"input": {Type: "string", Description: "传给脚本的文本参数"},
-		},
+	params := llm.ToolParameters{Type: "object", Properties: map[string]llm.ToolProperty{}}
+	for _, p := range t.spec.Params {
+		prop := llm.ToolProperty{Type: p.Type, Description: p.Description, Default: p.Default}
+		var enum []any
+		for _, e := range p.Enum {
+			enum = append(enum, e)
+		}
+		if p.Type == "array" {
+			prop.Items = &llm.ToolProperty{Type: "string", Enum: enum}
+		} else {
+			prop.Enum = enum
+		}
+		params.Properties[p.Name] = prop
+		if p.Required {
+			params.Required = append(params.Required, p.Name)
+		}
 	}
+	return params
 }
 
 func (t *yamlShellTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
-	var payload map[string]any
-	_ = json.Unmarshal(args, &payload)
-	input := ""
-	if v, ok := payload["input"]; ok {
-		input = fmt.Sprint(v)
+	values, err := t.bindArgs(args)
+	if err != nil {
+		return "", err
 	}
-	cmdline := strings.ReplaceAll(t.command, "{{input}}", input)
-
-	if t.timeout <= 0 {
-		t.timeout = 15 * time.Second
+	render := func(s string) string {
+		return yamlTemplateRe.ReplaceAllStringFunc(s, func(m string) string {
+			return values[yamlTemplateRe.FindStringSubmatch(m)[1]].text
+		})
 	}
+
 	cmdCtx, cancel := context.WithTimeout(ctx, t.timeout)
 	defer cancel()
 
 	var cmd *exec.Cmd
-	if isWindowsTool() {
-		cmd = exec.CommandContext(cmdCtx, "cmd", "/C", cmdline)
+	if len(t.spec.Argv) > 0 {
+		var argv []string
+		for _, a := range t.spec.Argv {
+			if m := yamlTemplateRe.FindStringSubmatch(a); m != nil && m[0] == a && values[m[1]].items != nil {
+				argv = append(argv, values[m[1]].items...)
+				continue
+			}
+			argv = append(argv, render(a))
+		}
+		cmd = shellCommandContext(cmdCtx, t.restricted, argv[0], argv[1:]...)
+	} else if runtime.GOOS == "windows" {
+		cmdline := yamlTemplateRe.ReplaceAllStringFunc(t.spec.Command, func(m string) string {
+			return "!" + yamlParamEnvName(yamlTemplateRe.FindStringSubmatch(m)[1]) + "!"
+		})
+		// 延迟展开 (!VAR!) 在命令解析之后进行，参数值中的 & | 等不会被当作命令
+		cmd = exec.CommandContext(cmdCtx, "cmd", "/V:ON", "/C", cmdline)
 	} else {
-		cmd = exec.CommandContext(cmdCtx, "bash", "-c", cmdline)
+		cmd = shellCommandContext(cmdCtx, t.restricted, "bash", "-c", shellParamCommand(t.spec.Command))
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	for _, p := range t.spec.Params {
+		cmd.Env = append(cmd.Env, yamlParamEnvName(p.Name)+"="+values[p.Name].text)
 	}
+	for k, v := range t.spec.Env {
+		cmd.Env = append(cmd.Env, k+"="+render(v))
+	}
+	if t.spec.Workdir != "" {
+		dir, err := pathPolicyFrom(ctx).Check(render(t.spec.Workdir))
+		if err != nil {
+			return "", err
+		}
+		cmd.Dir = dir
+	}
+	if t.spec.Stdin != "" {
+		cmd.Stdin = strings.NewReader(render(t.spec.Stdin))
+	}
+
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	if err := cmd.Run(); err != nil {
+		out := t.truncate(strings.TrimSpace(stdout.String()))
 		if stderr.Len() > 0 {
-			return strings.TrimSpace(stdout.String()), fmt.Errorf("custom tool %s failed: %s", t.name, strings.TrimSpace(stderr.String()))
+			return out, fmt.Errorf("custom tool %s failed: %s", t.name, t.truncate(strings.TrimSpace(stderr.String())))
 		}
-		return strings.TrimSpace(stdout.String()), fmt.Errorf("custom tool %s failed: %w", t.name, err)
+		return out, fmt.Errorf("custom tool %s failed: %w", t.name, err)
 	}
-	return strings.TrimSpace(stdout.String()), nil
+	return t.formatOutput(stdout.Bytes())
 }
 
-func LoadCustomToolsFromYAML(path string) ([]Tool, error) {
+// bindArgs 按声明校验参数类型、枚举与必填项，并填充默认值
+func (t *yamlShellTool) bindArgs(args json.RawMessage) (map[string]yamlParamValue, error) {
+	payload := map[string]any{}
+	if len(bytes.TrimSpace(args)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(args))
+		dec.UseNumber()
+		if err := dec.Decode(&payload); err != nil {
+			return nil, fmt.Errorf("parse %s args: %w", t.name, err)
+		}
+	}
+	values := map[string]yamlParamValue{}
+	for _, p := range t.spec.Params {
+		raw, ok := payload[p.Name]
+		if !ok || raw == nil {
+			if p.Default == nil {
+				if p.Required {
+					return nil, fmt.Errorf("%s: 缺少必填参数 %s", t.name, p.Name)
+				}
+				values[p.Name] = yamlParamValue{}
+				continue
+			}
+			raw = p.Default
+		}
+		v, err := convertYAMLParam(p, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: 参数 %s %w", t.name, p.Name, err)
+		}
+		values[p.Name] = v
+	}
+	return values, nil
+}
+
+func convertYAMLParam(p yamlToolParam, raw any) (yamlParamValue, error) {
+	var v yamlParamValue
+	switch p.Type {
+	case "integer":
+		n, err := strconv.ParseInt(strings.TrimSpace(fmt.Sprint(raw)), 10, 64)
+		if err != nil {
+			return v, fmt.Errorf("应为整数，实际为 %v", raw)
+		}
+		v.text = strconv.FormatInt(n, 10)
+	case "number":
+		f, err := strconv.ParseFloat(strings.TrimSpace(fmt.Sprint(raw)), 64)
+		if err != nil {
+			return v, fmt.Errorf("应为数字，实际为 %v", raw)
+		}
+		v.text = strconv.FormatFloat(f, 'f', -1, 64)
+	case "boolean":
+		b, err := strconv.ParseBool(strings.TrimSpace(fmt.Sprint(raw)))
+		if err != nil {
+			return v, fmt.Errorf("应为布尔值，实际为 %v", raw)
+		}
+		v.text = strconv.FormatBool(b)
+	case "array":
+		list, ok := raw.([]any)
+		if !ok {
+			return v, fmt.Errorf("应为数组，实际为 %v", raw)
+		}
+		v.items = []string{}
+		for _, item := range list {
+			if _, nested := item.([]any); nested {
+				return v, fmt.Errorf("数组元素应为标量")
+			}
+			v.items = append(v.items, fmt.Sprint(item))
+		}
+		data, _ := json.Marshal(v.items)
+		v.text = string(data)
+	default:
+		switch raw.(type) {
+		case []any, map[string]any:
+			return v, fmt.Errorf("应为字符串，实际为 %v", raw)
+		}
+		v.text = fmt.Sprint(raw)
+	}
+	if len(p.Enum) > 0 {
+		check := v.items
+		if check == nil {
+			check = []string{v.text}
+		}
+		for _, c := range check {
+			if !containsString(p.Enum, c) {
+				return v, fmt.Errorf("取值 %q 不在可选值 %v 中", c, p.Enum)
+			}
+		}
+	}
+	return v, nil
+}
+
+func (t *yamlShellTool) formatOutput(stdout []byte) (string, error) {
+	out := strings.TrimSpace(string(stdout))
+	if t.spec.Output.Format == "json" {
+		if !json.Valid([]byte(out)) {
+			return t.truncate(out), fmt.Errorf("custom tool %s: 输出不是合法 JSON", t.name)
+		}
+		if len(out) > t.maxBytes() {
+			return "", fmt.Errorf("custom tool %s: JSON 输出 %d 字节，超过 max_bytes (%d)", t.name, len(out), t.maxBytes())
+		}
+		return out, nil
+	}
+	return t.truncate(out), nil
+}
+
+func (t *yamlShellTool) maxBytes() int {
+	if t.spec.Output.MaxBytes > 0 {
+		return t.spec.Output.MaxBytes
+	}
+	return BashOutputMaxBytes
+}
+
+func (t *yamlShellTool) truncate(s string) string {
+	if max := t.maxBytes(); len(s) > max {
+		return s[:max] + fmt.Sprintf("\n... [输出超过 %d 字节，已截断]", max)
+	}
+	return s
+}
+
+// yamlParamEnvName 参数对应的环境变量名，如 path → GOPI_PARAM_PATH
+func yamlParamEnvName(name string) string {
+	return "GOPI_PARAM_" + strings.ToUpper(name)
+}
+
+// shellParamCommand 把 command 中的 {{name}} 替换为对应环境变量的引用，并按所在位置的引号处理：
+// 引号外为 "$VAR"，双引号内为 ${VAR}，单引号内先闭合单引号再插入 "$VAR"，
+// 因此旧版工具中的 '{{input}}'、"{{input}}" 写法仍得到原样的参数值
+func shellParamCommand(command string) string {
+	var b strings.Builder
+	quote := byte(0) // 0、'\'' 或 '"'
+	escaped := false
+	last := 0
+	for _, loc := range yamlTemplateRe.FindAllStringSubmatchIndex(command, -1) {
+		for i := last; i < loc[0]; i++ {
+			c := command[i]
+			switch {
+			case escaped:
+				escaped = false
+			case quote == '\'':
+				if c == '\'' {
+					quote = 0
+				}
+			case c == '\\':
+				escaped = true
+			case quote == '"':
+				if c == '"' {
+					quote = 0
+				}
+			case c == '\'' || c == '"':
+				quote = c
+			}
+		}
+		b.WriteString(command[last:loc[0]])
+		name := yamlParamEnvName(command[loc[2]:loc[3]])
+		switch quote {
+		case '\'':
+			b.WriteString(`'"$` + name + `"'`)
+		case '"':
+			b.WriteString("${" + name + "}")
+		default:
+			b.WriteString(`"$` + name + `"`)
+		}
+		escaped = false
+		last = loc[1]
+	}
+	b.WriteString(command[last:])
+	return b.String()
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadCustomToolsFromYAML 加载自定义 YAML 工具；opts.RestrictShell 为 true 时与 bash 一样在受限 shell 中执行
+func LoadCustomToolsFromYAML(path string, opts Options) ([]Tool, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -89,25 +352,84 @@ func LoadCustomToolsFromYAML(path string) ([]Tool, error) {
 	}
 	tools := make([]Tool, 0, len(cfg.Tools))
 	for _, spec := range cfg.Tools {
-		name := strings.TrimSpace(spec.Name)
-		cmd := strings.TrimSpace(spec.Command)
-		if name == "" || cmd == "" {
+		spec.Name = strings.TrimSpace(spec.Name)
+		spec.Command = strings.TrimSpace(spec.Command)
+		if spec.Name == "" || (spec.Command == "" && len(spec.Argv) == 0) {
 			continue
 		}
+		if err := normalizeYAMLToolSpec(&spec); err != nil {
+			return nil, fmt.Errorf("tool %s: %w", spec.Name, err)
+		}
 		timeout := 15 * time.Second
 		if spec.TimeoutSec > 0 {
 			timeout = time.Duration(spec.TimeoutSec) * time.Second
 		}
 		tools = append(tools, &yamlShellTool{
-			name:        name,
+			name:        spec.Name,
 			description: strings.TrimSpace(spec.Description),
-			command:     cmd,
+			spec:        spec,
 			timeout:     timeout,
+			restricted:  opts.RestrictShell,
 		})
 	}
 	return tools, nil
 }
 
-func isWindowsTool() bool {
-	return exec.Command("cmd", "/C", "echo ok").Run() == nil
+// normalizeYAMLToolSpec 校验工具定义：参数类型、默认值、模板引用与输出格式
+func normalizeYAMLToolSpec(spec *yamlToolSpec) error {
+	if spec.Command != "" && len(spec.Argv) > 0 {
+		return fmt.Errorf("command 与 argv 只能设置一个")
+	}
+	if len(spec.Params) == 0 && len(spec.Argv) == 0 {
+		spec.Params = []yamlToolParam{legacyInputParam}
+	}
+	declared := map[string]bool{}
+	for i := range spec.Params {
+		p := &spec.Params[i]
+		p.Name = strings.TrimSpace(p.Name)
+		if !yamlParamNameRe.MatchString(p.Name) {
+			return fmt.Errorf("非法参数名 %q", p.Name)
+		}
+		if declared[p.Name] {
+			return fmt.Errorf("参数 %s 重复定义", p.Name)
+		}
+		declared[p.Name] = true
+		if p.Type == "" {
+			p.Type = "string"
+		}
+		switch p.Type {
+		case "string", "integer", "number", "boolean", "array":
+		default:
+			return fmt.Errorf("参数 %s 类型 %q 不支持（string / integer / number / boolean / array）", p.Name, p.Type)
+		}
+		if p.Default != nil {
+			if _, err := convertYAMLParam(*p, p.Default); err != nil {
+				return fmt.Errorf("参数 %s 默认值 %w", p.Name, err)
+			}
+		}
+	}
+
+	templates := append([]string{spec.Command, spec.Workdir, spec.Stdin}, spec.Argv...)
+	for _, v := range spec.Env {
+		templates = append(templates, v)
+	}
+	for _, s := range templates {
+		for _, m := range yamlTemplateRe.FindAllStringSubmatch(s, -1) {
+			if !declared[m[1]] {
+				return fmt.Errorf("模板引用了未声明的参数 %s", m[1])
+			}
+		}
+	}
+	if len(spec.Argv) > 0 && yamlTemplateRe.MatchString(spec.Argv[0]) {
+		return fmt.Errorf("argv[0] 不能包含参数模板")
+	}
+
+	switch spec.Output.Format {
+	case "":
+		spec.Output.Format = "text"
+	case "text", "json":
+	default:
+		return fmt.Errorf("output.format %q 不支持（text / json）", spec.Output.Format)
+	}
+	return nil
 }
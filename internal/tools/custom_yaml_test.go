@@ -0,0 +1,143 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadYAMLTools(t *testing.T, content string) map[string]Tool {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("示例命令依赖 bash")
+	}
+	path := filepath.Join(t.TempDir(), "tools.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	loaded, err := LoadCustomToolsFromYAML(path, DefaultOptions())
+	require.NoError(t, err)
+	out := map[string]Tool{}
+	for _, tool := range loaded {
+		out[tool.Name()] = tool
+	}
+	return out
+}
+
+func TestYAMLToolParams(t *testing.T) {
+	tools := loadYAMLTools(t, `
+tools:
+  - name: legacy
+    command: "echo {{input}}"
+  - name: quoted
+    command: "printf '%s|%s|%s' '{{input}}' \"<{{input}}>\" 'x'\\''{{input}}'"
+  - name: greet
+    command: "printf '%s x%s' {{name}} {{times}}"
+    params:
+      - name: name
+        required: true
+      - name: times
+        type: integer
+        default: 2
+  - name: args
+    argv: ["printf", "[%s]", "{{files}}", "--mode={{mode}}"]
+    params:
+      - name: files
+        type: array
+      - name: mode
+        enum: [fast, slow]
+        default: fast
+  - name: piped
+    command: "cat; printf ' %s' \"$EXTRA\""
+    stdin: "in={{v}}"
+    env:
+      EXTRA: "env={{v}}"
+    params:
+      - name: v
+  - name: js
+    command: "printf '%s' {{raw}}"
+    output:
+      format: json
+      max_bytes: 20
+    params:
+      - name: raw
+`)
+	ctx := context.Background()
+
+	// 参数值以环境变量传入，不会被 shell 解析
+	out, err := execTool(t, ctx, tools["legacy"], map[string]any{"input": "a; echo pwned $(id)"})
+	require.NoError(t, err)
+	assert.Equal(t, "a; echo pwned $(id)", out)
+
+	// 旧版工具中写在引号内的占位符同样得到原样的参数值
+	out, err = execTool(t, ctx, tools["quoted"], map[string]any{"input": "it's $HOME"})
+	require.NoError(t, err)
+	assert.Equal(t, "it's $HOME|<it's $HOME>|x'it's $HOME", out)
+
+	out, err = execTool(t, ctx, tools["greet"], map[string]any{"name": "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, "bob x2", out)
+	_, err = execTool(t, ctx, tools["greet"], map[string]any{"name": "bob", "times": "many"})
+	assert.ErrorContains(t, err, "应为整数")
+	_, err = execTool(t, ctx, tools["greet"], map[string]any{})
+	assert.ErrorContains(t, err, "缺少必填参数 name")
+
+	out, err = execTool(t, ctx, tools["args"], map[string]any{"files": []string{"a b", "c"}})
+	require.NoError(t, err)
+	assert.Equal(t, "[a b][c][--mode=fast]", out)
+	_, err = execTool(t, ctx, tools["args"], map[string]any{"files": []string{}, "mode": "x"})
+	assert.ErrorContains(t, err, "不在可选值")
+	schema, err := json.Marshal(tools["args"].Schema())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"object","properties":{"files":{"type":"array","items":{"type":"string"}},"mode":{"type":"string","enum":["fast","slow"],"default":"fast"}}}`, string(schema))
+
+	out, err = execTool(t, ctx, tools["piped"], map[string]any{"v": "1"})
+	require.NoError(t, err)
+	assert.Equal(t, "in=1 env=1", out)
+
+	out, err = execTool(t, ctx, tools["js"], map[string]any{"raw": `{"ok":true}`})
+	require.NoError(t, err)
+	assert.Equal(t, `{"ok":true}`, out)
+	_, err = execTool(t, ctx, tools["js"], map[string]any{"raw": "not json"})
+	assert.ErrorContains(t, err, "不是合法 JSON")
+	_, err = execTool(t, ctx, tools["js"], map[string]any{"raw": `{"long":"xxxxxxxxxxxxxxxxxxxx"}`})
+	assert.ErrorContains(t, err, "超过 max_bytes")
+}
+
+func TestYAMLToolRestrictedShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("示例命令依赖 bash")
+	}
+	t.Setenv("GOPI_TEST_SECRET", "leak")
+	path := filepath.Join(t.TempDir(), "tools.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+tools:
+  - name: env
+    command: "echo \"[$GOPI_TEST_SECRET]\" {{input}}"
+`), 0o644))
+	opts := DefaultOptions()
+	opts.RestrictShell = true
+	loaded, err := LoadCustomToolsFromYAML(path, opts)
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	out, err := execTool(t, context.Background(), loaded[0], map[string]any{"input": "ok"})
+	require.NoError(t, err)
+	assert.Equal(t, "[] ok", out)
+}
+
+func TestYAMLToolInvalidSpec(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tools.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+tools:
+  - name: bad
+    command: "echo {{missing}}"
+    params:
+      - name: x
+`), 0o644))
+	_, err := LoadCustomToolsFromYAML(path, DefaultOptions())
+	assert.ErrorContains(t, err, "未声明的参数 missing")
+}
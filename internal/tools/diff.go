@@ -0,0 +1,202 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	diffContextLines = 3
+	diffMaxLCSCells  = 4_000_000 // 中间差异区域超过该规模时不做 LCS，整体视为替换
+)
+
+// diffOp 逐行差异操作：' ' 保留、'-' 删除、'+' 新增
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// UnifiedDiff 生成 oldText -> newText 的 unified diff；内容相同返回空串
+// oldText 为空且 isNew 时按新建文件输出，newText 为空且 isDelete 时按删除输出
+func UnifiedDiff(path, oldText, newText string, isNew, isDelete bool) string {
+	if oldText == newText && !isNew && !isDelete {
+		return ""
+	}
+	oldLines := splitDiffLines(oldText)
+	newLines := splitDiffLines(newText)
+	ops := diffLines(oldLines, newLines)
+
+	oldName, newName := "a/"+path, "b/"+path
+	if isNew {
+		oldName = "/dev/null"
+	}
+	if isDelete {
+		newName = "/dev/null"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range groupHunks(ops) {
+		b.WriteString(h)
+	}
+	return b.String()
+}
+
+func splitDiffLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines 去掉公共前后缀后对中间部分做 LCS
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	ops = append(ops, lcsDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops
+}
+
+func lcsDiff(a, b []string) []diffOp {
+	var ops []diffOp
+	if len(a)*len(b) > diffMaxLCSCells || len(a) == 0 || len(b) == 0 {
+		for _, l := range a {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range b {
+			ops = append(ops, diffOp{'+', l})
+		}
+		return ops
+	}
+
+	// dp[i][j] = a[i:] 与 b[j:] 的 LCS 长度
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else if dp[i+1][j] >= dp[i][j+1] {
+				dp[i][j] = dp[i+1][j]
+			} else {
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case dp[i+1][j] >= dp[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// groupHunks 将差异操作按上下文行数分组为 hunk 文本
+func groupHunks(ops []diffOp) []string {
+	var hunks []string
+	oldLine, newLine := 1, 1
+	i := 0
+	for i < len(ops) {
+		if ops[i].kind == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// 向前取上下文
+		start := i
+		for start > 0 && i-start < diffContextLines && ops[start-1].kind == ' ' {
+			start--
+		}
+		oldStart := oldLine - (i - start)
+		newStart := newLine - (i - start)
+
+		// 向后扩展，直到连续相同行超过 2*上下文
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := 0
+			for end+run < len(ops) && ops[end+run].kind == ' ' {
+				run++
+			}
+			if end+run >= len(ops) || run > 2*diffContextLines {
+				if run > diffContextLines {
+					run = diffContextLines
+				}
+				end += run
+				break
+			}
+			end += run
+		}
+
+		var body strings.Builder
+		oldCount, newCount := 0, 0
+		for _, op := range ops[start:end] {
+			body.WriteByte(op.kind)
+			body.WriteString(op.text)
+			body.WriteByte('\n')
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+		hunks = append(hunks, fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)+body.String())
+
+		for _, op := range ops[i:end] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return hunks
+}
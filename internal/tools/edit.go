@@ -40,7 +40,7 @@ func (t *EditTool) Schema() llm.ToolParameters {
 	}
 }
 
-func (t *EditTool) Execute(_ context.Context, args json.RawMessage) (string, error) {
+func (t *EditTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
 	var a EditArgs
 	if err := json.Unmarshal(args, &a); err != nil {
 		return "", fmt.Errorf("parse edit_file args: %w", err)
@@ -49,7 +49,17 @@ func (t *EditTool) Execute(_ context.Context, args json.RawMessage) (string, err
 		return "", fmt.Errorf("path and old_string are required")
 	}
 
-	contentBytes, err := os.ReadFile(a.Path)
+	policy := pathPolicyFrom(ctx)
+	target, err := policy.checkFile(a.Path)
+	if err != nil {
+		return "", err
+	}
+	tracker := fileTrackerFrom(ctx)
+	if err := tracker.CheckFresh(a.Path); err != nil {
+		return "", err
+	}
+
+	contentBytes, err := os.ReadFile(target)
 	if err != nil {
 		return "", fmt.Errorf("read file: %w", err)
 	}
@@ -64,9 +74,14 @@ func (t *EditTool) Execute(_ context.Context, args json.RawMessage) (string, err
 	}
 
 	updated := strings.Replace(content, a.OldString, a.NewString, 1)
-	if err := os.WriteFile(a.Path, []byte(updated), 0o644); err != nil {
+	if err := policy.CheckSize(a.Path, int64(len(updated))); err != nil {
+		return "", err
+	}
+	recordChange(ctx, a.Path)
+	if err := os.WriteFile(target, []byte(updated), 0o644); err != nil {
 		return "", fmt.Errorf("write file: %w", err)
 	}
+	tracker.Record(a.Path)
 
 	return fmt.Sprintf("已更新 %s（成功替换 1 处）", a.Path), nil
 }
@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fileStamp 文件在某一时刻的状态
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+// FileTracker 记录 agent 通过 read_file 看到（或自己写入）的文件状态，
+// 用于在写入前发现文件已被用户或其他工具修改
+type FileTracker struct {
+	mu    sync.Mutex
+	files map[string]fileStamp
+}
+
+// NewFileTracker 创建文件状态跟踪器
+func NewFileTracker() *FileTracker {
+	return &FileTracker{files: make(map[string]fileStamp)}
+}
+
+type fileTrackerKey struct{}
+
+// WithFileTracker 返回携带文件跟踪器的 context；未携带时读写工具不做过期检查
+func WithFileTracker(ctx context.Context, t *FileTracker) context.Context {
+	return context.WithValue(ctx, fileTrackerKey{}, t)
+}
+
+func fileTrackerFrom(ctx context.Context) *FileTracker {
+	t, _ := ctx.Value(fileTrackerKey{}).(*FileTracker)
+	return t
+}
+
+func trackerKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size(), hash: sha256.Sum256(data)}, nil
+}
+
+// Record 记录文件当前状态（读取或写入之后调用）；文件不存在时清除记录
+func (t *FileTracker) Record(path string) {
+	if t == nil {
+		return
+	}
+	key := trackerKey(path)
+	st, err := statFile(path)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		delete(t.files, key)
+		return
+	}
+	t.files[key] = st
+}
+
+// Seen 返回 agent 是否读取或写入过该文件
+func (t *FileTracker) Seen(path string) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.files[trackerKey(path)]
+	return ok
+}
+
+// CheckFresh 检查文件自上次读取后是否被修改；未读取过的文件不做检查
+// 仅修改时间变化而内容不变（如 touch）不视为修改
+func (t *FileTracker) CheckFresh(path string) error {
+	if t == nil {
+		return nil
+	}
+	key := trackerKey(path)
+	t.mu.Lock()
+	prev, ok := t.files[key]
+	t.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s 自上次 read_file 后已被删除，请先确认文件状态再修改", path)
+		}
+		return nil
+	}
+	if info.ModTime().Equal(prev.modTime) && info.Size() == prev.size {
+		return nil
+	}
+	cur, err := statFile(path)
+	if err == nil && cur.hash == prev.hash {
+		t.mu.Lock()
+		t.files[key] = cur
+		t.mu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("%s 自上次 read_file 后已被修改（可能是用户或其他工具所为），为避免覆盖这些修改已拒绝写入，请重新 read_file 后再修改", path)
+}
@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func execTool(t *testing.T, ctx context.Context, tool Tool, args map[string]any) (string, error) {
+	t.Helper()
+	raw, err := json.Marshal(args)
+	require.NoError(t, err)
+	return tool.Execute(ctx, raw)
+}
+
+func TestStaleWriteProtection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	require.NoError(t, os.WriteFile(path, []byte("hello\n"), 0o644))
+	ctx := WithFileTracker(context.Background(), NewFileTracker())
+	read, write, edit := NewReadTool(DefaultOptions()), NewWriteTool(), NewEditTool()
+
+	// 未读取过的已有文件需要 overwrite=true 才能整体覆盖
+	_, err := execTool(t, ctx, write, map[string]any{"path": path, "content": "x"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "overwrite=true")
+
+	_, err = execTool(t, ctx, read, map[string]any{"path": path})
+	require.NoError(t, err)
+	_, err = execTool(t, ctx, edit, map[string]any{"path": path, "old_string": "hello", "new_string": "hi"})
+	require.NoError(t, err)
+	// 自己的修改不会导致后续编辑被拒绝
+	_, err = execTool(t, ctx, edit, map[string]any{"path": path, "old_string": "hi", "new_string": "hey"})
+	require.NoError(t, err)
+
+	// 外部修改后拒绝编辑与覆盖，提示重新读取
+	require.NoError(t, os.WriteFile(path, []byte("hey\nuser change\n"), 0o644))
+	require.NoError(t, os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	_, err = execTool(t, ctx, edit, map[string]any{"path": path, "old_string": "hey", "new_string": "yo"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "重新 read_file")
+	_, err = execTool(t, ctx, write, map[string]any{"path": path, "content": "x"})
+	require.Error(t, err)
+
+	_, err = execTool(t, ctx, write, map[string]any{"path": path, "content": "forced", "overwrite": true})
+	require.NoError(t, err)
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, "forced", string(data))
+
+	// 仅修改时间变化不视为过期
+	require.NoError(t, os.Chtimes(path, time.Now().Add(2*time.Minute), time.Now().Add(2*time.Minute)))
+	_, err = execTool(t, ctx, write, map[string]any{"path": path, "content": "again"})
+	require.NoError(t, err)
+
+	// 新建文件不需要读取
+	_, err = execTool(t, ctx, write, map[string]any{"path": filepath.Join(filepath.Dir(path), "new.txt"), "content": "n"})
+	require.NoError(t, err)
+}
+
+func TestApplyPatchRejectsStaleFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	writeTestFile(t, path, "one\ntwo\n")
+	ctx := WithFileTracker(context.Background(), NewFileTracker())
+	_, err := execTool(t, ctx, NewReadTool(DefaultOptions()), map[string]any{"path": path})
+	require.NoError(t, err)
+
+	// 读取后被外部修改：即使补丁仍能套用也拒绝写入
+	writeTestFile(t, path, "one\ntwo\nuser change\n")
+	require.NoError(t, os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	patch := "--- " + path + "\n+++ " + path + "\n@@ -1,2 +1,2 @@\n one\n-two\n+2\n"
+	_, err = execTool(t, ctx, NewApplyPatchTool(), map[string]any{"patch": patch})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "重新 read_file")
+	assert.Equal(t, "one\ntwo\nuser change\n", readTestFile(t, path))
+
+	_, err = execTool(t, ctx, NewReadTool(DefaultOptions()), map[string]any{"path": path})
+	require.NoError(t, err)
+	_, err = execTool(t, ctx, NewApplyPatchTool(), map[string]any{"patch": patch})
+	require.NoError(t, err)
+	assert.Equal(t, "one\n2\nuser change\n", readTestFile(t, path))
+}
@@ -6,40 +6,65 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/yangruihan/go-pi/internal/llm"
 )
 
 // FindArgs 文件查找参数
 type FindArgs struct {
-	Pattern string `json:"pattern"`
-	Path    string `json:"path,omitempty"`
+	Pattern  string `json:"pattern"`
+	Path     string `json:"path,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Sort     string `json:"sort,omitempty"`
+	MaxDepth int    `json:"max_depth,omitempty"`
+	NoIgnore bool   `json:"no_ignore,omitempty"`
 }
 
 // FindTool 按 glob 查找文件
-type FindTool struct{}
+type FindTool struct {
+	maxResults int
+}
 
-func NewFindTool() *FindTool { return &FindTool{} }
+func NewFindTool(opts Options) *FindTool { return &FindTool{maxResults: opts.normalize().FindMaxResults} }
 
 func (t *FindTool) Name() string { return "find_files" }
 
 func (t *FindTool) Description() string {
-	return "按 glob 模式查找文件（例如 **/*.go, cmd/*/*.go）。自动跳过 .git 与常见依赖目录。"
+	return fmt.Sprintf("按 glob 模式查找文件或目录（例如 **/*.go、cmd/*/main.go、*.{yaml,yml}）。含 / 的模式匹配相对 path 的完整路径（* 不跨目录，** 匹配任意层级），不含 / 的模式匹配任意层级的文件名。遵循 .gitignore / .ignore，最多返回 %d 条结果。", t.maxResults)
 }
 
 func (t *FindTool) Schema() llm.ToolParameters {
 	return llm.ToolParameters{
 		Type: "object",
 		Properties: map[string]llm.ToolProperty{
-			"pattern": {Type: "string", Description: "glob 模式，如 **/*.go"},
-			"path": {Type: "string", Description: "根目录，默认当前目录"},
+			"pattern": {Type: "string", Description: "glob 模式，如 **/*_test.go；多个模式用逗号分隔"},
+			"path":    {Type: "string", Description: "根目录，默认当前目录"},
+			"type": {
+				Type:        "string",
+				Description: "结果类型：file（默认）、dir 或 any",
+				Enum:        []any{"file", "dir", "any"},
+			},
+			"sort": {
+				Type:        "string",
+				Description: "排序：path（默认，按路径）或 mtime（最近修改的在前）",
+				Enum:        []any{"path", "mtime"},
+			},
+			"max_depth": {Type: "integer", Description: "最大目录深度，path 的直接子项为 1，默认不限"},
+			"no_ignore": {Type: "boolean", Description: "不遵循 .gitignore / .ignore，也查找 node_modules 等依赖目录，默认 false"},
 		},
 		Required: []string{"pattern"},
 	}
 }
 
-func (t *FindTool) Execute(_ context.Context, args json.RawMessage) (string, error) {
+type foundEntry struct {
+	path    string
+	modTime time.Time
+}
+
+func (t *FindTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
 	var a FindArgs
 	if err := json.Unmarshal(args, &a); err != nil {
 		return "", fmt.Errorf("parse find_files args: %w", err)
@@ -50,56 +75,66 @@ func (t *FindTool) Execute(_ context.Context, args json.RawMessage) (string, err
 	if a.Path == "" {
 		a.Path = "."
 	}
+	wantFiles, wantDirs := true, false
+	switch a.Type {
+	case "", "file":
+	case "dir":
+		wantFiles, wantDirs = false, true
+	case "any":
+		wantDirs = true
+	default:
+		return "", fmt.Errorf("invalid type %q (file | dir | any)", a.Type)
+	}
+	if a.Sort != "" && a.Sort != "path" && a.Sort != "mtime" {
+		return "", fmt.Errorf("invalid sort %q (path | mtime)", a.Sort)
+	}
 
-	pattern := strings.ReplaceAll(a.Pattern, "\\", "/")
-	var matches []string
-	_ = filepath.Walk(a.Path, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
-		}
-		if info.IsDir() {
-			name := info.Name()
-			if name == ".git" || name == "node_modules" || strings.HasPrefix(name, ".") {
-				if path != a.Path {
-					return filepath.SkipDir
-				}
-			}
-			return nil
+	policy := pathPolicyFrom(ctx)
+	if _, err := policy.Check(a.Path); err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(a.Path); err != nil {
+		return "", fmt.Errorf("stat path: %w", err)
+	} else if !info.IsDir() {
+		return "", fmt.Errorf("%s 不是目录", a.Path)
+	}
+
+	patterns := splitGlobs(strings.TrimPrefix(a.Pattern, "./"))
+	var matches []foundEntry
+	o := walkOptions{recursive: true, noIgnore: a.NoIgnore, includeDirs: wantDirs, maxDepth: a.MaxDepth, policy: policy}
+	err := walkFiles(ctx, a.Path, o, func(path string, info os.FileInfo) bool {
+		if info.IsDir() && !wantDirs || !info.IsDir() && !wantFiles {
+			return true
 		}
 		rel, relErr := filepath.Rel(a.Path, path)
 		if relErr != nil {
 			rel = path
 		}
-		rel = strings.ReplaceAll(rel, "\\", "/")
-		ok, _ := filepath.Match(pattern, rel)
-		if ok || strings.Contains(pattern, "**") && simpleDoubleStarMatch(pattern, rel) {
-			matches = append(matches, path)
+		if matchAnyGlob(patterns, filepath.ToSlash(rel)) {
+			if info.IsDir() {
+				path += string(filepath.Separator)
+			}
+			matches = append(matches, foundEntry{path: path, modTime: info.ModTime()})
 		}
-		return nil
+		return true
 	})
+	if err != nil {
+		return "", err
+	}
 
 	if len(matches) == 0 {
 		return "未找到匹配文件", nil
 	}
-	if len(matches) > 200 {
-		matches = matches[:200]
-		matches = append(matches, "... 结果过多，已截断为 200 条")
+	if a.Sort == "mtime" {
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].modTime.After(matches[j].modTime) })
 	}
-	return strings.Join(matches, "\n"), nil
-}
-
-func simpleDoubleStarMatch(pattern, rel string) bool {
-	parts := strings.Split(pattern, "**")
-	idx := 0
-	for _, p := range parts {
-		if p == "" {
-			continue
-		}
-		n := strings.Index(rel[idx:], strings.Trim(p, "/"))
-		if n < 0 {
-			return false
+	lines := make([]string, 0, t.maxResults+1)
+	for i, m := range matches {
+		if i >= t.maxResults {
+			lines = append(lines, fmt.Sprintf("... 还有 %d 个结果未显示（共 %d 个），可缩小 path、调整 pattern 或使用 max_depth", len(matches)-t.maxResults, len(matches)))
+			break
 		}
-		idx += n + len(strings.Trim(p, "/"))
+		lines = append(lines, m.path)
 	}
-	return true
+	return strings.Join(lines, "\n"), nil
 }
@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runFind(t *testing.T, maxResults int, args map[string]any) []string {
+	t.Helper()
+	out, err := execTool(t, context.Background(), NewFindTool(Options{FindMaxResults: maxResults}), args)
+	require.NoError(t, err)
+	root := args["path"].(string) + string(filepath.Separator)
+	var rel []string
+	for _, l := range strings.Split(out, "\n") {
+		rel = append(rel, filepath.ToSlash(strings.TrimPrefix(l, root)))
+	}
+	return rel
+}
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"**/*_test.go", "a/b/foo_test.go", true},
+		{"**/*_test.go", "foo_test.go", true},
+		{"**/*_test.go", "a/foo_test.go.bak", false},
+		{"src/*.go", "src/a.go", true},
+		{"src/*.go", "src/sub/a.go", false},
+		{"src/**/*.go", "src/sub/deep/a.go", true},
+		{"a/**/b", "a/b", true},
+		{"[a-c]?.txt", "b1.txt", true},
+		{"[a-c]?.txt", "d1.txt", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, matchGlob(c.pattern, c.name), "%s vs %s", c.pattern, c.name)
+	}
+	assert.Equal(t, []string{"*.go", "*.md", "x/a", "x/b/c", "x/b/d"}, splitGlobs("*.{go,md}, x/{a,b/{c,d}}"))
+}
+
+func TestFindFiles(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		".gitignore":         "dist/\n",
+		"main.go":            "",
+		"main_test.go":       "",
+		"pkg/a/a_test.go":    "",
+		"pkg/a/a_test.go.bk": "",
+		"pkg/b/b.yaml":       "",
+		"dist/x_test.go":     "",
+		".github/ci.yml":     "",
+	})
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "main_test.go"), old, old))
+
+	assert.Equal(t, []string{"main_test.go", "pkg/a/a_test.go"}, runFind(t, 200, map[string]any{"pattern": "**/*_test.go", "path": root}))
+	assert.Equal(t, []string{"pkg/a/a_test.go", "main_test.go"}, runFind(t, 200, map[string]any{"pattern": "*_test.go", "path": root, "sort": "mtime"}))
+	assert.Equal(t, []string{".github/ci.yml", "pkg/b/b.yaml"}, runFind(t, 200, map[string]any{"pattern": "*.{yaml,yml}", "path": root}))
+	assert.Equal(t, []string{"main_test.go"}, runFind(t, 200, map[string]any{"pattern": "*_test.go", "path": root, "max_depth": 1}))
+	assert.Equal(t, []string{"pkg/a/", "pkg/b/"}, runFind(t, 200, map[string]any{"pattern": "pkg/*", "path": root, "type": "dir"}))
+
+	got := runFind(t, 1, map[string]any{"pattern": "**", "path": root})
+	require.Len(t, got, 2)
+	assert.Contains(t, got[1], "还有 6 个结果未显示（共 7 个）")
+}
@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// matchGlob 匹配 / 分隔的路径，支持 **（匹配零个或多个目录层级）；
+// 单个层级内支持 *、? 与字符类 [a-z]，* 不跨越 /。花括号需先经 expandBraces 展开
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pat, parts []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for len(pat) > 1 && pat[1] == "**" {
+				pat = pat[1:]
+			}
+			if len(pat) == 1 {
+				return true
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pat[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], parts[0]); !ok {
+			return false
+		}
+		pat, parts = pat[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// splitGlobs 解析逗号分隔的多个 glob（花括号内的逗号不分隔），并展开花括号
+func splitGlobs(s string) []string {
+	var out []string
+	depth, start := 0, 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			switch s[i] {
+			case '{':
+				depth++
+				continue
+			case '}':
+				if depth > 0 {
+					depth--
+				}
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		if g := strings.TrimSpace(s[start:i]); g != "" {
+			out = append(out, expandBraces(strings.ReplaceAll(g, "\\", "/"))...)
+		}
+		start = i + 1
+	}
+	return out
+}
+
+// expandBraces 展开 {a,b} 形式的备选（支持嵌套），如 *.{go,md} -> *.go, *.md
+func expandBraces(pattern string) []string {
+	open := strings.IndexByte(pattern, '{')
+	if open < 0 {
+		return []string{pattern}
+	}
+	depth := 0
+	var alts []string
+	last := open + 1
+	for i := open; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case ',':
+			if depth == 1 {
+				alts = append(alts, pattern[last:i])
+				last = i + 1
+			}
+		case '}':
+			depth--
+			if depth == 0 {
+				alts = append(alts, pattern[last:i])
+				var out []string
+				for _, alt := range alts {
+					out = append(out, expandBraces(pattern[:open]+alt+pattern[i+1:])...)
+				}
+				return out
+			}
+		}
+	}
+	return []string{pattern} // 花括号不配对时按字面处理
+}
+
+// matchAnyGlob 不含 / 的模式匹配文件名，否则匹配相对路径
+func matchAnyGlob(globs []string, rel string) bool {
+	for _, g := range globs {
+		target := rel
+		if !strings.Contains(g, "/") {
+			target = filepath.Base(rel)
+		}
+		if matchGlob(g, target) {
+			return true
+		}
+	}
+	return false
+}
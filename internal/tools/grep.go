@@ -2,52 +2,98 @@ package tools
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/yangruihan/go-pi/internal/llm"
 )
 
-const GrepMaxMatches = 50
+const (
+	GrepMaxMatches = 50
+
+	grepMaxContext   = 10
+	grepBinarySniff  = 8000            // 检测二进制时读取的前缀字节数
+	grepMaxLineBytes = 4 * 1024 * 1024 // 超长行之后的内容不再扫描
+)
 
 // GrepArgs 搜索参数
 type GrepArgs struct {
-	Pattern   string `json:"pattern"`
-	Path      string `json:"path,omitempty"`
-	Recursive bool   `json:"recursive,omitempty"`
-	Literal   bool   `json:"literal,omitempty"`
+	Pattern       string `json:"pattern"`
+	Path          string `json:"path,omitempty"`
+	Recursive     *bool  `json:"recursive,omitempty"`
+	Literal       bool   `json:"literal,omitempty"`
+	IgnoreCase    bool   `json:"ignore_case,omitempty"`
+	Include       string `json:"include,omitempty"`
+	Exclude       string `json:"exclude,omitempty"`
+	Context       int    `json:"context,omitempty"`
+	BeforeContext int    `json:"before_context,omitempty"`
+	AfterContext  int    `json:"after_context,omitempty"`
+	OutputMode    string `json:"output_mode,omitempty"`
+	NoIgnore      bool   `json:"no_ignore,omitempty"`
 }
 
 // GrepTool 正则/字面量搜索
-type GrepTool struct{}
+type GrepTool struct {
+	maxMatches int
+}
 
-func NewGrepTool() *GrepTool { return &GrepTool{} }
+func NewGrepTool(opts Options) *GrepTool { return &GrepTool{maxMatches: opts.normalize().GrepMaxMatches} }
 
 func (t *GrepTool) Name() string { return "grep_search" }
 
 func (t *GrepTool) Description() string {
-	return "在文件中进行正则或字面量搜索。支持递归目录搜索，输出文件名、行号和内容。"
+	return fmt.Sprintf("在文件中进行正则或字面量搜索。目录搜索遵循 .gitignore / .ignore 并跳过二进制文件，结果按路径排序；支持上下文行、include/exclude 过滤与仅列文件/计数模式，最多返回 %d 条结果。", t.maxMatches)
 }
 
 func (t *GrepTool) Schema() llm.ToolParameters {
 	return llm.ToolParameters{
 		Type: "object",
 		Properties: map[string]llm.ToolProperty{
-			"pattern": {Type: "string", Description: "搜索模式（正则表达式或字面量）"},
-			"path": {Type: "string", Description: "文件或目录路径，默认当前目录"},
-			"recursive": {Type: "boolean", Description: "目录是否递归搜索，默认 true"},
-			"literal": {Type: "boolean", Description: "是否按字面量匹配，默认 false（正则）"},
+			"pattern":        {Type: "string", Description: "搜索模式（正则表达式或字面量）"},
+			"path":           {Type: "string", Description: "文件或目录路径，默认当前目录"},
+			"recursive":      {Type: "boolean", Description: "目录是否递归搜索，默认 true"},
+			"literal":        {Type: "boolean", Description: "是否按字面量匹配，默认 false（正则）"},
+			"ignore_case":    {Type: "boolean", Description: "忽略大小写，默认 false"},
+			"include":        {Type: "string", Description: "只搜索匹配的文件，glob，多个用逗号分隔，如 *.go,cmd/**/*.go"},
+			"exclude":        {Type: "string", Description: "排除匹配的文件，glob，多个用逗号分隔，如 *_test.go"},
+			"context":        {Type: "integer", Description: fmt.Sprintf("匹配行前后各显示的上下文行数（最多 %d）", grepMaxContext)},
+			"before_context": {Type: "integer", Description: "匹配行之前显示的上下文行数"},
+			"after_context":  {Type: "integer", Description: "匹配行之后显示的上下文行数"},
+			"output_mode": {
+				Type:        "string",
+				Description: "content 输出匹配行（默认）；files_with_matches 只列出文件；count 输出每个文件的匹配数",
+				Enum:        []any{"content", "files_with_matches", "count"},
+			},
+			"no_ignore": {Type: "boolean", Description: "不遵循 .gitignore / .ignore，也搜索 node_modules 等依赖目录，默认 false"},
 		},
 		Required: []string{"pattern"},
 	}
 }
 
-func (t *GrepTool) Execute(_ context.Context, args json.RawMessage) (string, error) {
+// grepLine 匹配行或上下文行
+type grepLine struct {
+	num     int
+	text    string
+	isMatch bool
+}
+
+// grepFileResult 单个文件的搜索结果；lines 只保留输出所需的前若干条匹配及其上下文
+type grepFileResult struct {
+	path    string
+	matches int
+	lines   []grepLine
+}
+
+func (t *GrepTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
 	var a GrepArgs
 	if err := json.Unmarshal(args, &a); err != nil {
 		return "", fmt.Errorf("parse grep_search args: %w", err)
@@ -58,73 +104,245 @@ func (t *GrepTool) Execute(_ context.Context, args json.RawMessage) (string, err
 	if a.Path == "" {
 		a.Path = "."
 	}
-	if !a.Recursive {
-		a.Recursive = true
+	mode := a.OutputMode
+	switch mode {
+	case "":
+		mode = "content"
+	case "content", "files_with_matches", "count":
+	default:
+		return "", fmt.Errorf("invalid output_mode %q (content | files_with_matches | count)", a.OutputMode)
 	}
+	before, after := clampContext(a.BeforeContext, a.Context), clampContext(a.AfterContext, a.Context)
 
-	matcher := func(s string) bool { return false }
+	pattern := a.Pattern
 	if a.Literal {
-		matcher = func(s string) bool { return strings.Contains(strings.ToLower(s), strings.ToLower(a.Pattern)) }
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if a.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex: %w", err)
+	}
+
+	policy := pathPolicyFrom(ctx)
+	if _, err := policy.Check(a.Path); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(a.Path)
+	if err != nil {
+		return "", fmt.Errorf("stat path: %w", err)
+	}
+
+	includes, excludes := splitGlobs(a.Include), splitGlobs(a.Exclude)
+	var files []string
+	if !info.IsDir() {
+		if isBinaryFile(a.Path) {
+			return fmt.Sprintf("%s 是二进制文件，已跳过", a.Path), nil
+		}
+		files = []string{a.Path}
 	} else {
-		re, err := regexp.Compile(a.Pattern)
+		recursive := a.Recursive == nil || *a.Recursive
+		err = walkFiles(ctx, a.Path, walkOptions{recursive: recursive, noIgnore: a.NoIgnore, policy: policy}, func(p string, fi os.FileInfo) bool {
+			rel, relErr := filepath.Rel(a.Path, p)
+			if relErr != nil {
+				rel = p
+			}
+			rel = filepath.ToSlash(rel)
+			if len(includes) > 0 && !matchAnyGlob(includes, rel) || matchAnyGlob(excludes, rel) {
+				return true
+			}
+			if policy.CheckSize(p, fi.Size()) != nil {
+				return true
+			}
+			files = append(files, p)
+			return true
+		})
 		if err != nil {
-			return "", fmt.Errorf("invalid regex: %w", err)
+			return "", err
 		}
-		matcher = re.MatchString
 	}
 
-	var results []string
-	scanFile := func(path string) {
-		f, err := os.Open(path)
-		if err != nil {
-			return
-		}
-		defer f.Close()
-		scanner := bufio.NewScanner(f)
-		lineNo := 0
-		for scanner.Scan() {
-			lineNo++
-			line := scanner.Text()
-			if matcher(line) {
-				results = append(results, fmt.Sprintf("%s:%d:%s", path, lineNo, line))
-				if len(results) >= GrepMaxMatches {
-					return
-				}
+	// 并发扫描，结果按遍历顺序（路径字典序）输出
+	keep := t.maxMatches
+	if mode != "content" {
+		keep = 0
+	}
+	results := make([]*grepFileResult, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = scanGrepFile(files[i], re, before, after, keep, info.IsDir())
 			}
+		}()
+	}
+	for i := range files {
+		if ctx.Err() != nil {
+			break
 		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return "", err
 	}
 
-	info, err := os.Stat(a.Path)
+	return formatGrepResults(results, mode, t.maxMatches, before > 0 || after > 0), nil
+}
+
+func clampContext(n, fallback int) int {
+	if n <= 0 {
+		n = fallback
+	}
+	if n < 0 {
+		return 0
+	}
+	if n > grepMaxContext {
+		return grepMaxContext
+	}
+	return n
+}
+
+func isBinaryFile(path string) bool {
+	f, err := os.Open(path)
 	if err != nil {
-		return "", fmt.Errorf("stat path: %w", err)
+		return false
 	}
+	defer f.Close()
+	buf := make([]byte, grepBinarySniff)
+	n, _ := io.ReadFull(f, buf)
+	return bytes.IndexByte(buf[:n], 0) >= 0
+}
 
-	if !info.IsDir() {
-		scanFile(a.Path)
-	} else {
-		_ = filepath.Walk(a.Path, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return nil
-			}
-			if info.IsDir() {
-				name := info.Name()
-				if name == ".git" || name == "node_modules" || strings.HasPrefix(name, ".") {
-					if path != a.Path {
-						return filepath.SkipDir
-					}
+// scanGrepFile 扫描单个文件；keep 为保留输出的匹配数上限（0 表示只计数）
+func scanGrepFile(path string, re *regexp.Regexp, before, after, keep int, skipBinary bool) *grepFileResult {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	reader := bufio.NewReaderSize(f, 64*1024)
+	if skipBinary {
+		if head, _ := reader.Peek(grepBinarySniff); bytes.IndexByte(head, 0) >= 0 {
+			return nil
+		}
+	}
+
+	res := &grepFileResult{path: path}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), grepMaxLineBytes)
+	var window []grepLine // 最近的 before 行，作为下一次匹配的前置上下文
+	afterLeft := 0
+	lastEmitted := 0
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		text := scanner.Text()
+		if !re.MatchString(text) {
+			if afterLeft > 0 {
+				res.lines = append(res.lines, grepLine{num: lineNo, text: text})
+				lastEmitted = lineNo
+				afterLeft--
+			} else if before > 0 {
+				window = append(window, grepLine{num: lineNo, text: text})
+				if len(window) > before {
+					window = window[1:]
 				}
-				return nil
 			}
-			if len(results) >= GrepMaxMatches {
-				return fmt.Errorf("stop")
+			continue
+		}
+		res.matches++
+		if res.matches > keep {
+			afterLeft = 0
+			continue
+		}
+		for _, l := range window {
+			if l.num > lastEmitted {
+				res.lines = append(res.lines, l)
 			}
-			scanFile(path)
-			return nil
-		})
+		}
+		window = window[:0]
+		res.lines = append(res.lines, grepLine{num: lineNo, text: text, isMatch: true})
+		lastEmitted = lineNo
+		afterLeft = after
 	}
+	if res.matches == 0 {
+		return nil
+	}
+	return res
+}
 
-	if len(results) == 0 {
-		return "未找到匹配项", nil
+func formatGrepResults(results []*grepFileResult, mode string, limit int, withContext bool) string {
+	totalMatches, totalFiles := 0, 0
+	for _, r := range results {
+		if r != nil {
+			totalMatches += r.matches
+			totalFiles++
+		}
+	}
+	if totalFiles == 0 {
+		return "未找到匹配项"
+	}
+
+	var out []string
+	shown := 0
+	switch mode {
+	case "files_with_matches", "count":
+		for _, r := range results {
+			if r == nil {
+				continue
+			}
+			if shown >= limit {
+				break
+			}
+			if mode == "count" {
+				out = append(out, fmt.Sprintf("%s:%d", r.path, r.matches))
+			} else {
+				out = append(out, r.path)
+			}
+			shown++
+		}
+		if rest := totalFiles - shown; rest > 0 {
+			out = append(out, fmt.Sprintf("... 还有 %d 个文件未显示（共 %d 个文件、%d 处匹配）", rest, totalFiles, totalMatches))
+		}
+	default:
+		for _, r := range results {
+			if r == nil || shown >= limit {
+				continue
+			}
+			prev := 0
+			for _, l := range r.lines {
+				if l.isMatch && shown >= limit {
+					break
+				}
+				if withContext && prev > 0 && l.num > prev+1 {
+					out = append(out, "--")
+				}
+				sep := "-"
+				if l.isMatch {
+					sep = ":"
+					shown++
+				}
+				out = append(out, fmt.Sprintf("%s%s%d%s%s", r.path, sep, l.num, sep, l.text))
+				prev = l.num
+			}
+			if withContext && shown < limit {
+				out = append(out, "--")
+			}
+		}
+		if withContext && len(out) > 0 && out[len(out)-1] == "--" {
+			out = out[:len(out)-1]
+		}
+		if rest := totalMatches - shown; rest > 0 {
+			out = append(out, fmt.Sprintf("... 还有 %d 处匹配未显示（共 %d 处，分布在 %d 个文件），可缩小 path 或使用 include/output_mode 过滤", rest, totalMatches, totalFiles))
+		}
 	}
-	return strings.Join(results, "\n"), nil
+	return strings.Join(out, "\n")
 }
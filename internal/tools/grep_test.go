@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+}
+
+func runGrep(t *testing.T, maxMatches int, args map[string]any) string {
+	t.Helper()
+	out, err := execTool(t, context.Background(), NewGrepTool(Options{GrepMaxMatches: maxMatches}), args)
+	require.NoError(t, err)
+	return out
+}
+
+func TestGrepRespectsIgnoreFilesAndBinary(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		".gitignore":            "build/\n*.log\n!keep.log\n",
+		".github/workflow.yml":  "needle\n",
+		"src/a.go":              "needle\n",
+		"src/.ignore":           "gen_*.go\n",
+		"src/gen_x.go":          "needle\n",
+		"build/out.go":          "needle\n",
+		"debug.log":             "needle\n",
+		"keep.log":              "needle\n",
+		"node_modules/pkg/x.js": "needle\n",
+		"bin.dat":               "needle\x00\x01",
+	})
+
+	out := runGrep(t, 50, map[string]any{"pattern": "needle", "path": root, "output_mode": "files_with_matches"})
+	rel := strings.ReplaceAll(out, root+string(filepath.Separator), "")
+	assert.Equal(t, strings.Join([]string{".github/workflow.yml", "keep.log", "src/a.go"}, "\n"), filepath.ToSlash(rel))
+
+	out = runGrep(t, 50, map[string]any{"pattern": "needle", "path": root, "no_ignore": true, "output_mode": "count"})
+	assert.Contains(t, out, "gen_x.go:1")
+	assert.Contains(t, out, "node_modules")
+	assert.NotContains(t, out, "bin.dat")
+
+	out = runGrep(t, 50, map[string]any{"pattern": "needle", "path": root, "recursive": false, "output_mode": "files_with_matches"})
+	assert.Equal(t, filepath.Join(root, "keep.log"), out)
+}
+
+func TestGrepContextCaseAndLimit(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.txt":     "one\nTwo\nthree\nfour\nfive\nsix\ntwo\n",
+		"b.go":      "two\n",
+		"b_test.go": "two\n",
+	})
+	a := filepath.Join(root, "a.txt")
+
+	out := runGrep(t, 50, map[string]any{"pattern": "two", "path": root, "literal": true, "include": "*.txt"})
+	assert.Equal(t, a+":7:two", out)
+
+	out = runGrep(t, 50, map[string]any{"pattern": "two", "path": a, "ignore_case": true, "context": 1})
+	assert.Equal(t, strings.Join([]string{
+		a + "-1-one", a + ":2:Two", a + "-3-three", "--", a + "-6-six", a + ":7:two",
+	}, "\n"), out)
+
+	out = runGrep(t, 1, map[string]any{"pattern": "(?i)two", "path": root, "exclude": "*_test.go"})
+	lines := strings.Split(out, "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, a+":2:Two", lines[0])
+	assert.Contains(t, lines[1], "还有 2 处匹配未显示（共 3 处，分布在 2 个文件）")
+}
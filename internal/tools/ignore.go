@@ -0,0 +1,225 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// alwaysSkipDirs 遍历时始终跳过的目录（版本库元数据）
+var alwaysSkipDirs = map[string]bool{".git": true, ".hg": true, ".svn": true}
+
+// defaultSkipDirs 未关闭忽略规则时额外跳过的依赖目录（即使没有 .gitignore）
+var defaultSkipDirs = map[string]bool{"node_modules": true}
+
+// ignoreRule .gitignore 中的一条规则
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool // 模式中含 /，相对规则文件所在目录匹配；否则匹配任意层级的文件名
+}
+
+// ignoreFile 某个目录下 .gitignore / .ignore 的规则集合
+type ignoreFile struct {
+	dir   string // 规则文件所在目录（绝对路径）
+	rules []ignoreRule
+}
+
+// ignoreStack 从外到内的规则文件，后面（更深目录、更靠后的规则）优先
+type ignoreStack []*ignoreFile
+
+func parseIgnoreRules(dir string, names ...string) *ignoreFile {
+	f := &ignoreFile{dir: dir}
+	for _, name := range names {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if r, ok := parseIgnoreLine(scanner.Text()); ok {
+				f.rules = append(f.rules, r)
+			}
+		}
+		file.Close()
+	}
+	if len(f.rules) == 0 {
+		return nil
+	}
+	return f
+}
+
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	var r ignoreRule
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	}
+	line = strings.TrimPrefix(line, "\\")
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		r.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	r.pattern = line
+	return r, true
+}
+
+// match 返回规则是否命中，以及命中时是否为忽略（否定规则返回 false）
+func (f *ignoreFile) match(abs string, isDir bool) (matched, ignored bool) {
+	rel, err := filepath.Rel(f.dir, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false, false
+	}
+	rel = filepath.ToSlash(rel)
+	for i := len(f.rules) - 1; i >= 0; i-- {
+		r := f.rules[i]
+		if r.dirOnly && !isDir {
+			continue
+		}
+		target := rel
+		if !r.anchored {
+			target = path.Base(rel)
+		}
+		if matchGlob(r.pattern, target) {
+			return true, !r.negate
+		}
+	}
+	return false, false
+}
+
+func (s ignoreStack) ignored(abs string, isDir bool) bool {
+	for i := len(s) - 1; i >= 0; i-- {
+		if matched, ignored := s[i].match(abs, isDir); matched {
+			return ignored
+		}
+	}
+	return false
+}
+
+// ancestorIgnores 加载 root 上层直到版本库根目录的忽略规则（含 .git/info/exclude）
+func ancestorIgnores(root string) ignoreStack {
+	var dirs []string
+	repoRoot := ""
+	for dir := filepath.Dir(root); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			repoRoot = dir
+			break
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	var stack ignoreStack
+	if _, err := os.Stat(filepath.Join(root, ".git")); err == nil {
+		repoRoot, dirs = root, nil
+	}
+	if repoRoot == "" {
+		return nil
+	}
+	if f := parseIgnoreRules(repoRoot, filepath.Join(".git", "info", "exclude")); f != nil {
+		stack = append(stack, f)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if f := parseIgnoreRules(dirs[i], ".gitignore", ".ignore"); f != nil {
+			stack = append(stack, f)
+		}
+	}
+	return stack
+}
+
+// walkOptions 目录遍历选项
+type walkOptions struct {
+	recursive   bool
+	noIgnore    bool // 不读取 .gitignore / .ignore，也不跳过依赖目录
+	includeDirs bool // 目录也回调 fn（在进入目录之前）
+	maxDepth    int  // 最大深度，root 的直接子项为 1；0 表示不限
+	policy      *PathPolicy
+}
+
+// walkFiles 按字典序遍历 root 下的文件（includeDirs 时含目录），遵循忽略规则与路径策略；fn 返回 false 时停止
+func walkFiles(ctx context.Context, root string, o walkOptions, fn func(path string, info os.FileInfo) bool) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	var stack ignoreStack
+	if !o.noIgnore {
+		stack = ancestorIgnores(absRoot)
+	}
+	_, err = walkDir(ctx, root, absRoot, 1, stack, o, fn)
+	return err
+}
+
+func walkDir(ctx context.Context, dir, absDir string, depth int, stack ignoreStack, o walkOptions, fn func(string, os.FileInfo) bool) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if !o.noIgnore {
+		if f := parseIgnoreRules(absDir, ".gitignore", ".ignore"); f != nil {
+			stack = append(stack[:len(stack):len(stack)], f)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return true, nil
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, e := range entries {
+		name := e.Name()
+		p := filepath.Join(dir, name)
+		abs := filepath.Join(absDir, name)
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if o.policy.skipInWalk(p, info) {
+			continue
+		}
+		if e.IsDir() {
+			if alwaysSkipDirs[name] || !o.noIgnore && defaultSkipDirs[name] {
+				continue
+			}
+			if stack.ignored(abs, true) {
+				continue
+			}
+			if o.includeDirs && !fn(p, info) {
+				return false, nil
+			}
+			if !o.recursive || o.maxDepth > 0 && depth >= o.maxDepth {
+				continue
+			}
+			cont, err := walkDir(ctx, p, abs, depth+1, stack, o, fn)
+			if err != nil || !cont {
+				return cont, err
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() && info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		if stack.ignored(abs, false) {
+			continue
+		}
+		if !fn(p, info) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,358 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	JobBufferMaxBytes = 256 * 1024 // 每个后台任务保留的输出上限（只保留末尾）
+	JobMaxRunning     = 8          // 同时运行的后台任务上限
+)
+
+// JobStatus 后台任务状态
+type JobStatus string
+
+const (
+	JobRunning JobStatus = "running"
+	JobExited  JobStatus = "exited"
+	JobKilled  JobStatus = "killed"
+)
+
+// JobInfo 后台任务快照
+type JobInfo struct {
+	ID        string
+	Command   string
+	Dir       string
+	PID       int
+	Status    JobStatus
+	ExitCode  int
+	StartedAt time.Time
+	EndedAt   time.Time
+	Unread    int64 // 尚未读取的输出字节数
+}
+
+// Job 一个后台运行的 shell 命令
+type Job struct {
+	id        string
+	command   string
+	dir       string
+	startedAt time.Time
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	done      chan struct{}
+
+	mu       sync.Mutex
+	buf      []byte // 输出末尾 JobBufferMaxBytes 字节
+	written  int64  // 累计输出字节数
+	readPos  int64  // 已读取到的位置（累计偏移）
+	status   JobStatus
+	exitCode int
+	endedAt  time.Time
+}
+
+// Write 追加任务输出，超过上限时丢弃最早的内容
+func (j *Job) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.buf = append(j.buf, p...)
+	if over := len(j.buf) - JobBufferMaxBytes; over > 0 {
+		j.buf = append(j.buf[:0], j.buf[over:]...)
+	}
+	j.written += int64(len(p))
+	return len(p), nil
+}
+
+// ReadNew 返回上次读取之后的新输出（最多 maxBytes 字节），dropped 为因缓冲区上限被丢弃的字节数
+func (j *Job) ReadNew(maxBytes int) (out string, dropped int64, remaining int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	bufStart := j.written - int64(len(j.buf))
+	if j.readPos < bufStart {
+		dropped = bufStart - j.readPos
+		j.readPos = bufStart
+	}
+	chunk := j.buf[j.readPos-bufStart:]
+	if maxBytes > 0 && len(chunk) > maxBytes {
+		chunk = chunk[:maxBytes]
+	}
+	j.readPos += int64(len(chunk))
+	return string(chunk), dropped, j.written - j.readPos
+}
+
+// Info 返回任务快照
+func (j *Job) Info() JobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := JobInfo{
+		ID:        j.id,
+		Command:   j.command,
+		Dir:       j.dir,
+		Status:    j.status,
+		ExitCode:  j.exitCode,
+		StartedAt: j.startedAt,
+		EndedAt:   j.endedAt,
+		Unread:    j.written - j.readPos,
+	}
+	if j.cmd.Process != nil {
+		info.PID = j.cmd.Process.Pid
+	}
+	return info
+}
+
+// SendInput 向任务 stdin 写入内容
+func (j *Job) SendInput(input string) error {
+	j.mu.Lock()
+	running := j.status == JobRunning
+	j.mu.Unlock()
+	if !running {
+		return fmt.Errorf("后台任务 %s 已结束", j.id)
+	}
+	if _, err := io.WriteString(j.stdin, input); err != nil {
+		return fmt.Errorf("write stdin: %w", err)
+	}
+	return nil
+}
+
+// Kill 终止任务及其子进程
+func (j *Job) Kill() {
+	j.mu.Lock()
+	if j.status != JobRunning {
+		j.mu.Unlock()
+		return
+	}
+	j.status = JobKilled
+	j.mu.Unlock()
+
+	killProcessGroup(j.cmd)
+	select {
+	case <-j.done:
+	case <-time.After(2 * time.Second):
+	}
+}
+
+// Wait 等待任务结束或超时，返回任务是否已结束
+func (j *Job) Wait(d time.Duration) bool {
+	select {
+	case <-j.done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+// JobManager 管理一个会话内的后台任务
+type JobManager struct {
+	opts   Options
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	nextID int
+	closed bool
+}
+
+// NewJobManager 创建后台任务管理器
+func NewJobManager(opts Options) *JobManager {
+	return &JobManager{opts: opts.normalize(), jobs: make(map[string]*Job)}
+}
+
+// Start 在后台启动命令；dir 为空时使用当前工作目录
+func (m *JobManager) Start(command, dir string) (*Job, error) {
+	if strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("command cannot be empty")
+	}
+	if dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("workdir: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("workdir %s 不是目录", dir)
+		}
+	} else {
+		dir, _ = os.Getwd()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, fmt.Errorf("后台任务管理器已关闭")
+	}
+	running := 0
+	for _, j := range m.jobs {
+		if j.Info().Status == JobRunning {
+			running++
+		}
+	}
+	if running >= JobMaxRunning {
+		return nil, fmt.Errorf("同时运行的后台任务已达上限（%d），请先终止不需要的任务", JobMaxRunning)
+	}
+
+	var cmd *exec.Cmd
+	if isWindows() {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = shellCommand(m.opts.RestrictShell, "bash", "-c", command)
+	}
+	cmd.Dir = dir
+	cmd.WaitDelay = time.Second // 进程退出后不再等待仍持有输出管道的孙进程
+	setProcessGroup(cmd)
+
+	m.nextID++
+	job := &Job{
+		id:        "job-" + strconv.Itoa(m.nextID),
+		command:   command,
+		dir:       dir,
+		startedAt: time.Now(),
+		cmd:       cmd,
+		done:      make(chan struct{}),
+		status:    JobRunning,
+	}
+	cmd.Stdout = job
+	cmd.Stderr = job
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("create stdin pipe: %w", err)
+	}
+	job.stdin = stdin
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start job: %w", err)
+	}
+
+	go func() {
+		err := cmd.Wait()
+		job.mu.Lock()
+		if job.status == JobRunning {
+			job.status = JobExited
+		}
+		job.exitCode = cmd.ProcessState.ExitCode()
+		if err != nil && job.exitCode == 0 {
+			job.exitCode = -1
+		}
+		job.endedAt = time.Now()
+		job.mu.Unlock()
+		close(job.done)
+	}()
+
+	m.jobs[job.id] = job
+	return job, nil
+}
+
+// Get 按 ID 获取任务
+func (m *JobManager) Get(id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[strings.TrimSpace(id)]
+	if !ok {
+		return nil, fmt.Errorf("后台任务 %q 不存在", id)
+	}
+	return j, nil
+}
+
+// Kill 终止指定任务
+func (m *JobManager) Kill(id string) (JobInfo, error) {
+	j, err := m.Get(id)
+	if err != nil {
+		return JobInfo{}, err
+	}
+	j.Kill()
+	return j.Info(), nil
+}
+
+// List 返回全部任务快照，按启动顺序排列
+func (m *JobManager) List() []JobInfo {
+	m.mu.Lock()
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j)
+	}
+	m.mu.Unlock()
+
+	out := make([]JobInfo, 0, len(jobs))
+	for _, j := range jobs {
+		out = append(out, j.Info())
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].StartedAt.Before(out[k].StartedAt) })
+	return out
+}
+
+// Close 终止所有运行中的任务，之后不再接受新任务
+func (m *JobManager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j)
+	}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j *Job) {
+			defer wg.Done()
+			j.Kill()
+		}(j)
+	}
+	wg.Wait()
+}
+
+// FormatJobInfo 单行描述任务状态
+func FormatJobInfo(info JobInfo) string {
+	status := string(info.Status)
+	switch info.Status {
+	case JobRunning:
+		status += fmt.Sprintf("，已运行 %s", time.Since(info.StartedAt).Round(time.Second))
+	case JobExited:
+		status += fmt.Sprintf("，退出码 %d", info.ExitCode)
+	}
+	line := fmt.Sprintf("%s [%s] pid=%d %s", info.ID, status, info.PID, info.Command)
+	if info.Unread > 0 {
+		line += fmt.Sprintf("（%d 字节未读）", info.Unread)
+	}
+	return line
+}
+
+// JobsCommand 处理 /jobs 斜杠命令：无参数时列出任务，kill <id|all> 终止任务
+func JobsCommand(m *JobManager, args []string) string {
+	if m == nil {
+		return "后台任务不可用"
+	}
+	if len(args) == 0 || args[0] == "list" {
+		list := m.List()
+		if len(list) == 0 {
+			return "暂无后台任务"
+		}
+		lines := []string{"后台任务:"}
+		for _, info := range list {
+			lines = append(lines, "  - "+FormatJobInfo(info))
+		}
+		return strings.Join(lines, "\n")
+	}
+	if args[0] != "kill" || len(args) < 2 {
+		return "用法: /jobs [kill <id|all>]"
+	}
+	if args[1] == "all" {
+		killed := 0
+		for _, info := range m.List() {
+			if info.Status == JobRunning {
+				if _, err := m.Kill(info.ID); err == nil {
+					killed++
+				}
+			}
+		}
+		return fmt.Sprintf("已终止 %d 个后台任务", killed)
+	}
+	info, err := m.Kill(args[1])
+	if err != nil {
+		return err.Error()
+	}
+	return "已终止: " + FormatJobInfo(info)
+}
@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestJobManager(t *testing.T) *JobManager {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("后台任务测试依赖 bash")
+	}
+	m := NewJobManager(DefaultOptions())
+	t.Cleanup(m.Close)
+	return m
+}
+
+func TestJobReadNewOutputAndInput(t *testing.T) {
+	m := newTestJobManager(t)
+
+	job, err := m.Start(`echo ready; while read line; do echo "got $line"; done`, "")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return job.Info().Unread > 0 }, 2*time.Second, 10*time.Millisecond)
+	out, _, _ := job.ReadNew(0)
+	assert.Equal(t, "ready\n", out)
+
+	require.NoError(t, job.SendInput("ping\n"))
+	require.Eventually(t, func() bool { return job.Info().Unread > 0 }, 2*time.Second, 10*time.Millisecond)
+	out, _, _ = job.ReadNew(0)
+	assert.Equal(t, "got ping\n", out, "只返回上次读取之后的新输出")
+
+	info, err := m.Kill(job.Info().ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobKilled, info.Status)
+	assert.Error(t, job.SendInput("again\n"))
+}
+
+func TestJobExitCodeAndBufferCap(t *testing.T) {
+	m := newTestJobManager(t)
+
+	job, err := m.Start("head -c 300000 /dev/zero | tr '\\0' x; exit 4", "")
+	require.NoError(t, err)
+	require.True(t, job.Wait(5*time.Second))
+
+	info := job.Info()
+	assert.Equal(t, JobExited, info.Status)
+	assert.Equal(t, 4, info.ExitCode)
+
+	out, dropped, remaining := job.ReadNew(1000)
+	assert.Equal(t, int64(300000-JobBufferMaxBytes), dropped)
+	assert.Len(t, out, 1000)
+	assert.Equal(t, int64(JobBufferMaxBytes-1000), remaining)
+}
+
+func TestJobManagerCloseKillsRunningJobs(t *testing.T) {
+	m := newTestJobManager(t)
+
+	job, err := m.Start("sleep 30", "")
+	require.NoError(t, err)
+	m.Close()
+
+	assert.Equal(t, JobKilled, job.Info().Status)
+	_, err = m.Start("echo hi", "")
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(JobsCommand(m, nil), "killed"))
+}
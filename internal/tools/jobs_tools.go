@@ -0,0 +1,265 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yangruihan/go-pi/internal/llm"
+)
+
+// jobStartWait 启动后等待片刻，让立即失败的命令（端口占用、命令不存在）直接反馈
+const jobStartWait = 500 * time.Millisecond
+
+// JobArgs 后台任务工具参数
+type JobArgs struct {
+	ID      string `json:"id,omitempty"`
+	Command string `json:"command,omitempty"`
+	Workdir string `json:"workdir,omitempty"`
+	Input   string `json:"input,omitempty"`
+}
+
+func parseJobArgs(tool string, args json.RawMessage) (JobArgs, error) {
+	var a JobArgs
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &a); err != nil {
+			return a, fmt.Errorf("parse %s args: %w", tool, err)
+		}
+	}
+	return a, nil
+}
+
+// NewJobTools 创建操作后台任务的一组工具
+func NewJobTools(jobs *JobManager, opts Options) []Tool {
+	opts = opts.normalize()
+	return []Tool{
+		&JobStartTool{jobs: jobs, maxOutput: opts.BashMaxOutput},
+		&JobOutputTool{jobs: jobs, maxOutput: opts.BashMaxOutput},
+		&JobInputTool{jobs: jobs},
+		&JobStatusTool{jobs: jobs},
+		&JobKillTool{jobs: jobs},
+	}
+}
+
+// JobStartTool 在后台启动长时间运行的命令
+type JobStartTool struct {
+	jobs      *JobManager
+	maxOutput int
+}
+
+func (t *JobStartTool) Name() string { return "job_start" }
+
+func (t *JobStartTool) Description() string {
+	return fmt.Sprintf("在后台启动长时间运行的命令（如开发服务器、文件监听），立即返回任务 ID，不会阻塞或超时。之后用 job_output 读取新输出、job_input 发送输入、job_status 查看状态、job_kill 终止。同时最多运行 %d 个任务。", JobMaxRunning)
+}
+
+func (t *JobStartTool) Schema() llm.ToolParameters {
+	return llm.ToolParameters{
+		Type: "object",
+		Properties: map[string]llm.ToolProperty{
+			"command": {Type: "string", Description: "要在后台运行的 shell 命令"},
+			"workdir": {Type: "string", Description: "工作目录，默认当前目录"},
+		},
+		Required: []string{"command"},
+	}
+}
+
+func (t *JobStartTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	a, err := parseJobArgs(t.Name(), args)
+	if err != nil {
+		return "", err
+	}
+	if a.Workdir != "" {
+		dir, err := pathPolicyFrom(ctx).Check(a.Workdir)
+		if err != nil {
+			return "", err
+		}
+		a.Workdir = dir
+	}
+	job, err := t.jobs.Start(a.Command, a.Workdir)
+	if err != nil {
+		return "", err
+	}
+	job.Wait(jobStartWait)
+
+	info := job.Info()
+	out, _, remaining := job.ReadNew(t.maxOutput)
+	var b strings.Builder
+	fmt.Fprintf(&b, "已启动后台任务 %s（pid %d，工作目录 %s）\n状态: %s", info.ID, info.PID, info.Dir, FormatJobInfo(info))
+	if strings.TrimSpace(out) != "" {
+		fmt.Fprintf(&b, "\n\n初始输出:\n%s", strings.TrimRight(out, "\n"))
+	}
+	if remaining > 0 {
+		fmt.Fprintf(&b, "\n... [还有 %d 字节未读，使用 job_output 继续读取]", remaining)
+	}
+	return b.String(), nil
+}
+
+// JobOutputTool 读取后台任务自上次读取以来的新输出
+type JobOutputTool struct {
+	jobs      *JobManager
+	maxOutput int
+}
+
+func (t *JobOutputTool) Name() string { return "job_output" }
+
+func (t *JobOutputTool) Description() string {
+	return fmt.Sprintf("读取后台任务自上次读取以来的新输出（stdout 与 stderr 合并），每次最多返回 %d 字节。", t.maxOutput)
+}
+
+func (t *JobOutputTool) Schema() llm.ToolParameters {
+	return llm.ToolParameters{
+		Type: "object",
+		Properties: map[string]llm.ToolProperty{
+			"id": {Type: "string", Description: "任务 ID，如 job-1"},
+		},
+		Required: []string{"id"},
+	}
+}
+
+func (t *JobOutputTool) Execute(_ context.Context, args json.RawMessage) (string, error) {
+	a, err := parseJobArgs(t.Name(), args)
+	if err != nil {
+		return "", err
+	}
+	job, err := t.jobs.Get(a.ID)
+	if err != nil {
+		return "", err
+	}
+
+	out, dropped, remaining := job.ReadNew(t.maxOutput)
+	var b strings.Builder
+	if dropped > 0 {
+		fmt.Fprintf(&b, "[输出过多，已丢弃最早的 %d 字节]\n", dropped)
+	}
+	if out == "" {
+		b.WriteString("（无新输出）")
+	} else {
+		b.WriteString(strings.TrimRight(out, "\n"))
+	}
+	if remaining > 0 {
+		fmt.Fprintf(&b, "\n... [还有 %d 字节未读，再次调用 job_output 继续读取]", remaining)
+	}
+	fmt.Fprintf(&b, "\n\n[%s]", FormatJobInfo(job.Info()))
+	return b.String(), nil
+}
+
+// JobInputTool 向后台任务的 stdin 发送内容
+type JobInputTool struct {
+	jobs *JobManager
+}
+
+func (t *JobInputTool) Name() string { return "job_input" }
+
+func (t *JobInputTool) Description() string {
+	return "向后台任务的标准输入发送内容；未以换行结尾时自动追加换行。"
+}
+
+func (t *JobInputTool) Schema() llm.ToolParameters {
+	return llm.ToolParameters{
+		Type: "object",
+		Properties: map[string]llm.ToolProperty{
+			"id":    {Type: "string", Description: "任务 ID，如 job-1"},
+			"input": {Type: "string", Description: "要发送的内容"},
+		},
+		Required: []string{"id", "input"},
+	}
+}
+
+func (t *JobInputTool) Execute(_ context.Context, args json.RawMessage) (string, error) {
+	a, err := parseJobArgs(t.Name(), args)
+	if err != nil {
+		return "", err
+	}
+	job, err := t.jobs.Get(a.ID)
+	if err != nil {
+		return "", err
+	}
+	input := a.Input
+	if !strings.HasSuffix(input, "\n") {
+		input += "\n"
+	}
+	if err := job.SendInput(input); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("已向 %s 发送 %d 字节", job.Info().ID, len(input)), nil
+}
+
+// JobStatusTool 查看后台任务状态
+type JobStatusTool struct {
+	jobs *JobManager
+}
+
+func (t *JobStatusTool) Name() string { return "job_status" }
+
+func (t *JobStatusTool) Description() string {
+	return "查看后台任务状态；不指定 id 时列出全部任务。"
+}
+
+func (t *JobStatusTool) Schema() llm.ToolParameters {
+	return llm.ToolParameters{
+		Type: "object",
+		Properties: map[string]llm.ToolProperty{
+			"id": {Type: "string", Description: "任务 ID，留空列出全部"},
+		},
+	}
+}
+
+func (t *JobStatusTool) Execute(_ context.Context, args json.RawMessage) (string, error) {
+	a, err := parseJobArgs(t.Name(), args)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(a.ID) != "" {
+		job, err := t.jobs.Get(a.ID)
+		if err != nil {
+			return "", err
+		}
+		return FormatJobInfo(job.Info()), nil
+	}
+
+	list := t.jobs.List()
+	if len(list) == 0 {
+		return "暂无后台任务", nil
+	}
+	lines := make([]string, 0, len(list))
+	for _, info := range list {
+		lines = append(lines, FormatJobInfo(info))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// JobKillTool 终止后台任务
+type JobKillTool struct {
+	jobs *JobManager
+}
+
+func (t *JobKillTool) Name() string { return "job_kill" }
+
+func (t *JobKillTool) Description() string {
+	return "终止后台任务及其所有子进程。"
+}
+
+func (t *JobKillTool) Schema() llm.ToolParameters {
+	return llm.ToolParameters{
+		Type: "object",
+		Properties: map[string]llm.ToolProperty{
+			"id": {Type: "string", Description: "任务 ID，如 job-1"},
+		},
+		Required: []string{"id"},
+	}
+}
+
+func (t *JobKillTool) Execute(_ context.Context, args json.RawMessage) (string, error) {
+	a, err := parseJobArgs(t.Name(), args)
+	if err != nil {
+		return "", err
+	}
+	info, err := t.jobs.Kill(a.ID)
+	if err != nil {
+		return "", err
+	}
+	return "已终止: " + FormatJobInfo(info), nil
+}
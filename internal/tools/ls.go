@@ -39,7 +39,7 @@ func (t *LSTool) Schema() llm.ToolParameters {
 	}
 }
 
-func (t *LSTool) Execute(_ context.Context, args json.RawMessage) (string, error) {
+func (t *LSTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
 	var a LSArgs
 	if len(args) > 0 {
 		if err := json.Unmarshal(args, &a); err != nil {
@@ -49,9 +49,13 @@ func (t *LSTool) Execute(_ context.Context, args json.RawMessage) (string, error
 	if a.Path == "" {
 		a.Path = "."
 	}
+	policy := pathPolicyFrom(ctx)
+	if _, err := policy.Check(a.Path); err != nil {
+		return "", err
+	}
 
 	if a.Tree {
-		return renderTree(a.Path)
+		return renderTree(a.Path, policy)
 	}
 
 	entries, err := os.ReadDir(a.Path)
@@ -60,6 +64,9 @@ func (t *LSTool) Execute(_ context.Context, args json.RawMessage) (string, error
 	}
 	items := make([]string, 0, len(entries))
 	for _, e := range entries {
+		if info, err := e.Info(); err == nil && policy.skipInWalk(filepath.Join(a.Path, e.Name()), info) {
+			continue
+		}
 		name := e.Name()
 		if e.IsDir() {
 			name += "/"
@@ -70,7 +77,7 @@ func (t *LSTool) Execute(_ context.Context, args json.RawMessage) (string, error
 	return strings.Join(items, "\n"), nil
 }
 
-func renderTree(root string) (string, error) {
+func renderTree(root string, policy *PathPolicy) (string, error) {
 	var lines []string
 	lines = append(lines, root)
 	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
@@ -80,6 +87,12 @@ func renderTree(root string) (string, error) {
 		if path == root {
 			return nil
 		}
+		if policy.skipInWalk(path, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 		rel, _ := filepath.Rel(root, path)
 		depth := strings.Count(rel, string(filepath.Separator))
 		indent := strings.Repeat("  ", depth)
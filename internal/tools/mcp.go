@@ -0,0 +1,482 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yangruihan/go-pi/internal/config"
+	"github.com/yangruihan/go-pi/internal/llm"
+)
+
+// MCP（Model Context Protocol）stdio 客户端：每行一条 JSON-RPC 2.0 消息
+
+const (
+	mcpProtocolVersion    = "2024-11-05"
+	mcpInitTimeout        = 30 * time.Second
+	mcpDefaultCallTimeout = 60 * time.Second
+	mcpStderrTail         = 4096
+	// MCPToolPrefix MCP 工具在注册表中的名称前缀，完整名称为 mcp__<服务器名>__<工具名>
+	MCPToolPrefix = "mcp__"
+)
+
+var errMCPClosed = errors.New("mcp server exited")
+
+type mcpMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  any             `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *mcpError) Error() string { return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message) }
+
+// mcpConn 一个正在运行的 MCP 服务器进程
+type mcpConn struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stderr  *tailBuffer
+	writeMu sync.Mutex
+	nextID  atomic.Int64
+
+	pendingMu sync.Mutex
+	pending   map[string]chan mcpMessage
+
+	done chan struct{}
+	err  error // done 关闭前写入
+}
+
+func startMCPConn(ctx context.Context, name string, cfg config.MCPServerConfig) (*mcpConn, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+os.ExpandEnv(v))
+	}
+	setProcessGroup(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	c := &mcpConn{
+		cmd:     cmd,
+		stdin:   stdin,
+		stderr:  &tailBuffer{max: mcpStderrTail},
+		pending: map[string]chan mcpMessage{},
+		done:    make(chan struct{}),
+	}
+	cmd.Stderr = c.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start mcp server %s: %w", name, err)
+	}
+	go c.readLoop(stdout)
+
+	initCtx, cancel := context.WithTimeout(ctx, mcpInitTimeout)
+	defer cancel()
+	params := map[string]any{
+		"protocolVersion": mcpProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "gopi", "version": "0.1.0"},
+	}
+	if err := c.call(initCtx, "initialize", params, nil); err != nil {
+		c.close()
+		return nil, fmt.Errorf("initialize mcp server %s: %w%s", name, err, c.stderrHint())
+	}
+	if err := c.notify("notifications/initialized", nil); err != nil {
+		c.close()
+		return nil, fmt.Errorf("initialize mcp server %s: %w", name, err)
+	}
+	return c, nil
+}
+
+func (c *mcpConn) alive() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (c *mcpConn) stderrHint() string {
+	if s := strings.TrimSpace(c.stderr.String()); s != "" {
+		return "\nstderr: " + s
+	}
+	return ""
+}
+
+func (c *mcpConn) send(msg mcpMessage) error {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if !c.alive() {
+		return errMCPClosed
+	}
+	_, err = c.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (c *mcpConn) notify(method string, params any) error {
+	return c.send(mcpMessage{Method: method, Params: params})
+}
+
+// call 发送请求并等待响应；ctx 取消时通知服务器取消该请求
+func (c *mcpConn) call(ctx context.Context, method string, params any, out any) error {
+	id := json.RawMessage(fmt.Sprint(c.nextID.Add(1)))
+	ch := make(chan mcpMessage, 1)
+	c.pendingMu.Lock()
+	c.pending[string(id)] = ch
+	c.pendingMu.Unlock()
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, string(id))
+		c.pendingMu.Unlock()
+	}()
+
+	if err := c.send(mcpMessage{ID: id, Method: method, Params: params}); err != nil {
+		return err
+	}
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if out != nil {
+			return json.Unmarshal(resp.Result, out)
+		}
+		return nil
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		_ = c.notify("notifications/cancelled", map[string]any{"requestId": id, "reason": ctx.Err().Error()})
+		return ctx.Err()
+	}
+}
+
+func (c *mcpConn) readLoop(stdout io.Reader) {
+	r := bufio.NewReader(stdout)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			c.handle(line)
+		}
+		if err != nil {
+			c.err = errMCPClosed
+			if s := strings.TrimSpace(c.stderr.String()); s != "" {
+				c.err = fmt.Errorf("%w: %s", errMCPClosed, s)
+			}
+			close(c.done)
+			_ = c.cmd.Wait()
+			return
+		}
+	}
+}
+
+func (c *mcpConn) handle(line []byte) {
+	var msg struct {
+		mcpMessage
+		Params json.RawMessage `json:"params,omitempty"`
+	}
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return // 忽略服务器输出的非 JSON 行
+	}
+	switch {
+	case msg.Method != "" && len(msg.ID) > 0:
+		// 服务器发起的请求：仅支持 ping
+		reply := mcpMessage{ID: msg.ID, Result: json.RawMessage("{}")}
+		if msg.Method != "ping" {
+			reply = mcpMessage{ID: msg.ID, Error: &mcpError{Code: -32601, Message: "method not found: " + msg.Method}}
+		}
+		go func() { _ = c.send(reply) }()
+	case msg.Method == "" && len(msg.ID) > 0:
+		c.pendingMu.Lock()
+		ch := c.pending[string(msg.ID)]
+		c.pendingMu.Unlock()
+		if ch != nil {
+			ch <- msg.mcpMessage
+		}
+	}
+}
+
+// close 关闭 stdin 请求服务器退出，超时后强制结束进程组
+func (c *mcpConn) close() {
+	c.writeMu.Lock()
+	_ = c.stdin.Close()
+	c.writeMu.Unlock()
+	select {
+	case <-c.done:
+	case <-time.After(2 * time.Second):
+		killProcessGroup(c.cmd)
+		<-c.done
+	}
+}
+
+// tailBuffer 只保留最后 max 字节的输出
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+	max int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// mcpServer 一个已配置的 MCP 服务器，进程退出后在下次调用时重新启动
+type mcpServer struct {
+	name    string
+	cfg     config.MCPServerConfig
+	timeout time.Duration
+
+	mu     sync.Mutex
+	conn   *mcpConn
+	closed bool
+}
+
+func (s *mcpServer) connect(ctx context.Context) (*mcpConn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, fmt.Errorf("mcp server %s is closed", s.name)
+	}
+	if s.conn != nil && s.conn.alive() {
+		return s.conn, nil
+	}
+	conn, err := startMCPConn(ctx, s.name, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.conn = conn
+	return conn, nil
+}
+
+func (s *mcpServer) close() {
+	s.mu.Lock()
+	conn := s.conn
+	s.conn = nil
+	s.closed = true
+	s.mu.Unlock()
+	if conn != nil {
+		conn.close()
+	}
+}
+
+type mcpToolInfo struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+func (s *mcpServer) listTools(ctx context.Context) ([]mcpToolInfo, error) {
+	conn, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var all []mcpToolInfo
+	cursor := ""
+	for {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var page struct {
+			Tools      []mcpToolInfo `json:"tools"`
+			NextCursor string        `json:"nextCursor"`
+		}
+		if err := conn.call(ctx, "tools/list", params, &page); err != nil {
+			return nil, fmt.Errorf("list tools of mcp server %s: %w", s.name, err)
+		}
+		all = append(all, page.Tools...)
+		if page.NextCursor == "" {
+			return all, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+type mcpCallResult struct {
+	Content []struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		MimeType string `json:"mimeType"`
+		Resource *struct {
+			URI  string `json:"uri"`
+			Text string `json:"text"`
+		} `json:"resource"`
+	} `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent"`
+	IsError           bool            `json:"isError"`
+}
+
+func (s *mcpServer) callTool(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	conn, err := s.connect(ctx)
+	if err != nil {
+		return "", err
+	}
+	callCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	var res mcpCallResult
+	if err := conn.call(callCtx, "tools/call", map[string]any{"name": name, "arguments": args}, &res); err != nil {
+		return "", fmt.Errorf("mcp tool %s/%s: %w", s.name, name, err)
+	}
+
+	var parts []string
+	for _, c := range res.Content {
+		switch {
+		case c.Type == "text":
+			parts = append(parts, c.Text)
+		case c.Type == "resource" && c.Resource != nil:
+			if c.Resource.Text != "" {
+				parts = append(parts, c.Resource.Text)
+			} else {
+				parts = append(parts, "[resource: "+c.Resource.URI+"]")
+			}
+		default:
+			parts = append(parts, fmt.Sprintf("[%s: %s]", c.Type, c.MimeType))
+		}
+	}
+	if len(parts) == 0 && len(res.StructuredContent) > 0 {
+		parts = append(parts, string(res.StructuredContent))
+	}
+	out := strings.Join(parts, "\n")
+	if res.IsError {
+		return "", fmt.Errorf("mcp tool %s/%s failed: %s", s.name, name, out)
+	}
+	return out, nil
+}
+
+// MCPManager 管理配置中的全部 MCP 服务器
+type MCPManager struct {
+	servers []*mcpServer
+}
+
+// NewMCPManager 按配置创建管理器（不启动进程），跳过 disabled 与未配置 command 的服务器
+func NewMCPManager(servers map[string]config.MCPServerConfig) *MCPManager {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	m := &MCPManager{}
+	for _, name := range names {
+		cfg := servers[name]
+		if cfg.Disabled || strings.TrimSpace(cfg.Command) == "" {
+			continue
+		}
+		timeout := mcpDefaultCallTimeout
+		if cfg.TimeoutSec > 0 {
+			timeout = time.Duration(cfg.TimeoutSec) * time.Second
+		}
+		m.servers = append(m.servers, &mcpServer{name: name, cfg: cfg, timeout: timeout})
+	}
+	return m
+}
+
+// Start 启动全部服务器、完成握手并返回其工具；单个服务器失败不影响其他服务器，错误合并返回
+func (m *MCPManager) Start(ctx context.Context) ([]Tool, error) {
+	var out []Tool
+	var errs []error
+	for _, s := range m.servers {
+		infos, err := s.listTools(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			s.close()
+			continue
+		}
+		for _, info := range infos {
+			out = append(out, &mcpTool{server: s, info: info})
+		}
+	}
+	return out, errors.Join(errs...)
+}
+
+// Close 关闭全部服务器进程
+func (m *MCPManager) Close() {
+	if m == nil {
+		return
+	}
+	for _, s := range m.servers {
+		s.close()
+	}
+}
+
+// mcpTool MCP 服务器提供的一个工具
+type mcpTool struct {
+	server *mcpServer
+	info   mcpToolInfo
+}
+
+func (t *mcpTool) Name() string {
+	return MCPToolPrefix + sanitizeToolName(t.server.name) + "__" + sanitizeToolName(t.info.Name)
+}
+
+func (t *mcpTool) Description() string {
+	return fmt.Sprintf("[MCP %s] %s", t.server.name, strings.TrimSpace(t.info.Description))
+}
+
+// Schema 解析 inputSchema（用于参数校验；发送给模型时使用 RawSchema 原样传递）
+func (t *mcpTool) Schema() llm.ToolParameters {
+	params := llm.ToolParameters{Type: "object", Properties: map[string]llm.ToolProperty{}}
+	_ = json.Unmarshal(t.RawSchema(), &params)
+	return params
+}
+
+func (t *mcpTool) RawSchema() json.RawMessage {
+	if len(t.info.InputSchema) == 0 || string(t.info.InputSchema) == "null" {
+		return json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	return t.info.InputSchema
+}
+
+func (t *mcpTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	if len(strings.TrimSpace(string(args))) == 0 {
+		args = json.RawMessage("{}")
+	}
+	return t.server.callTool(ctx, t.info.Name, args)
+}
+
+// sanitizeToolName 将名称中 LLM 工具名不允许的字符替换为 _
+func sanitizeToolName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,131 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yangruihan/go-pi/internal/config"
+)
+
+const fakeEchoSchema = `{"type":"object","properties":{"text":{"type":"string","description":"回显内容"},"tags":{"type":"array","items":{"type":"string"}}},"required":["text"]}`
+
+// TestFakeMCPServerProcess 以子进程方式运行的假 MCP 服务器（仅在设置环境变量时生效）
+func TestFakeMCPServerProcess(t *testing.T) {
+	if os.Getenv("GOPI_FAKE_MCP_SERVER") != "1" {
+		return
+	}
+	runFakeMCPServer()
+	os.Exit(0)
+}
+
+func runFakeMCPServer() {
+	in := bufio.NewScanner(os.Stdin)
+	initialized := false
+	reply := func(id json.RawMessage, result string) {
+		fmt.Printf(`{"jsonrpc":"2.0","id":%s,"result":%s}`+"\n", id, result)
+	}
+	for in.Scan() {
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				Cursor    string         `json:"cursor"`
+				Name      string         `json:"name"`
+				Arguments map[string]any `json:"arguments"`
+			} `json:"params"`
+		}
+		if json.Unmarshal(in.Bytes(), &msg) != nil {
+			continue
+		}
+		switch msg.Method {
+		case "initialize":
+			reply(msg.ID, `{"protocolVersion":"2024-11-05","capabilities":{"tools":{}},"serverInfo":{"name":"fake","version":"1"}}`)
+		case "notifications/initialized":
+			initialized = true
+		case "tools/list":
+			if !initialized {
+				fmt.Printf(`{"jsonrpc":"2.0","id":%s,"error":{"code":-32002,"message":"not initialized"}}`+"\n", msg.ID)
+			} else if msg.Params.Cursor == "" {
+				reply(msg.ID, `{"tools":[{"name":"echo","description":"回显文本","inputSchema":`+fakeEchoSchema+`}],"nextCursor":"p2"}`)
+			} else {
+				reply(msg.ID, `{"tools":[{"name":"fail","inputSchema":{"type":"object"}},{"name":"crash.now","inputSchema":{"type":"object"}}]}`)
+			}
+		case "tools/call":
+			switch msg.Params.Name {
+			case "echo":
+				text, _ := json.Marshal(fmt.Sprint(msg.Params.Arguments["text"]))
+				reply(msg.ID, `{"content":[{"type":"text","text":`+string(text)+`}]}`)
+			case "fail":
+				reply(msg.ID, `{"content":[{"type":"text","text":"boom"}],"isError":true}`)
+			case "crash.now":
+				os.Exit(3)
+			}
+		}
+	}
+}
+
+func TestMCPManager(t *testing.T) {
+	mgr := NewMCPManager(map[string]config.MCPServerConfig{
+		"fake": {
+			Command: os.Args[0],
+			Args:    []string{"-test.run=^TestFakeMCPServerProcess$"},
+			Env:     map[string]string{"GOPI_FAKE_MCP_SERVER": "1"},
+		},
+		"off": {Command: "does-not-exist", Disabled: true},
+	})
+	defer mgr.Close()
+
+	tools, err := mgr.Start(context.Background())
+	require.NoError(t, err)
+	reg := NewRegistry()
+	var names []string
+	for _, tool := range tools {
+		reg.Register(tool)
+		names = append(names, tool.Name())
+	}
+	assert.Equal(t, []string{"mcp__fake__echo", "mcp__fake__fail", "mcp__fake__crash_now"}, names)
+
+	llmTools, err := reg.ToLLMTools()
+	require.NoError(t, err)
+	for _, lt := range llmTools {
+		if lt.Function.Name == "mcp__fake__echo" {
+			assert.JSONEq(t, fakeEchoSchema, string(lt.Function.Parameters))
+			assert.Equal(t, "[MCP fake] 回显文本", lt.Function.Description)
+		}
+	}
+	echo, _ := reg.Get("mcp__fake__echo")
+	assert.Equal(t, []string{"text"}, echo.Schema().Required)
+
+	ctx := context.Background()
+	out, err := reg.Execute(ctx, "mcp__fake__echo", json.RawMessage(`{"text":"hello"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", out)
+
+	// 执行前按服务器提供的 schema 校验参数
+	_, err = reg.Execute(ctx, "mcp__fake__echo", json.RawMessage(`{"tags":"x"}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "缺少必填字段 text; tags 应为 array")
+
+	_, err = reg.Execute(ctx, "mcp__fake__fail", json.RawMessage(`{}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+
+	// 服务器退出后下次调用自动重启
+	_, err = reg.Execute(ctx, "mcp__fake__crash_now", nil)
+	require.Error(t, err)
+	out, err = reg.Execute(ctx, "mcp__fake__echo", json.RawMessage(`{"text":"again"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "again", out)
+
+	mgr.Close()
+	_, err = reg.Execute(ctx, "mcp__fake__echo", json.RawMessage(`{"text":"x"}`))
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "closed"))
+}
@@ -0,0 +1,64 @@
+package tools
+
+import (
+	"time"
+
+	"github.com/yangruihan/go-pi/internal/config"
+)
+
+// FindMaxResults find_files 默认最多返回的结果数
+const FindMaxResults = 200
+
+// Options 内置工具的资源限制，由 config.ToolsConfig 构建
+type Options struct {
+	BashTimeout    time.Duration
+	BashMaxOutput  int
+	ReadMaxLines   int
+	GrepMaxMatches int
+	FindMaxResults int
+	RestrictShell  bool // bash 与后台任务使用精简环境变量，并在可用时断开网络
+}
+
+// DefaultOptions 返回内置默认限制
+func DefaultOptions() Options {
+	return Options{
+		BashTimeout:    BashTimeout,
+		BashMaxOutput:  BashOutputMaxBytes,
+		ReadMaxLines:   FileReadMaxLines,
+		GrepMaxMatches: GrepMaxMatches,
+		FindMaxResults: FindMaxResults,
+	}
+}
+
+// OptionsFromConfig 根据已加载的配置（home + project 合并后）构建工具选项，
+// 未配置或非法的值回退为默认值
+func OptionsFromConfig(cfg config.ToolsConfig) Options {
+	return Options{
+		BashTimeout:    cfg.BashTimeout,
+		BashMaxOutput:  cfg.BashMaxOutput,
+		ReadMaxLines:   cfg.ReadMaxLines,
+		GrepMaxMatches: cfg.GrepMaxMatches,
+		FindMaxResults: cfg.FindMaxResults,
+		RestrictShell:  cfg.Sandbox.RestrictBash,
+	}.normalize()
+}
+
+func (o Options) normalize() Options {
+	d := DefaultOptions()
+	if o.BashTimeout <= 0 {
+		o.BashTimeout = d.BashTimeout
+	}
+	if o.BashMaxOutput <= 0 {
+		o.BashMaxOutput = d.BashMaxOutput
+	}
+	if o.ReadMaxLines <= 0 {
+		o.ReadMaxLines = d.ReadMaxLines
+	}
+	if o.GrepMaxMatches <= 0 {
+		o.GrepMaxMatches = d.GrepMaxMatches
+	}
+	if o.FindMaxResults <= 0 {
+		o.FindMaxResults = d.FindMaxResults
+	}
+	return o
+}
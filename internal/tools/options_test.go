@@ -0,0 +1,64 @@
+package tools
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yangruihan/go-pi/internal/config"
+)
+
+func TestOptionsFromConfig(t *testing.T) {
+	d := DefaultOptions()
+	cases := []struct {
+		name string
+		cfg  config.ToolsConfig
+		want Options
+	}{
+		{"未配置使用默认值", config.ToolsConfig{}, d},
+		{
+			"负数回退为默认值",
+			config.ToolsConfig{BashTimeout: -time.Second, BashMaxOutput: -1, ReadMaxLines: -1, GrepMaxMatches: -5, FindMaxResults: -10},
+			d,
+		},
+		{
+			"正数原样保留",
+			config.ToolsConfig{BashTimeout: 5 * time.Second, BashMaxOutput: 1024, ReadMaxLines: 50, GrepMaxMatches: 7, FindMaxResults: 3},
+			Options{BashTimeout: 5 * time.Second, BashMaxOutput: 1024, ReadMaxLines: 50, GrepMaxMatches: 7, FindMaxResults: 3},
+		},
+		{
+			"部分配置只替换对应项",
+			config.ToolsConfig{FindMaxResults: 12, Sandbox: config.SandboxConfig{RestrictBash: true}},
+			Options{BashTimeout: d.BashTimeout, BashMaxOutput: d.BashMaxOutput, ReadMaxLines: d.ReadMaxLines, GrepMaxMatches: d.GrepMaxMatches, FindMaxResults: 12, RestrictShell: true},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, OptionsFromConfig(c.cfg))
+		})
+	}
+}
+
+func TestToolDescriptionsShowLimits(t *testing.T) {
+	opts := OptionsFromConfig(config.ToolsConfig{BashTimeout: 7 * time.Second, BashMaxOutput: 4321, ReadMaxLines: 123, GrepMaxMatches: 45, FindMaxResults: 67})
+	cases := []struct {
+		tool Tool
+		want []string
+	}{
+		{NewFindTool(opts), []string{"最多返回 67 条结果"}},
+		{NewGrepTool(opts), []string{"最多返回 45 条结果"}},
+		{NewCodeSymbolsTool(opts), []string{"最多返回 45 条结果"}},
+		{NewReadTool(opts), []string{"最多读取 123 行"}},
+		{NewBashTool(opts), []string{"默认 7s", "超过 4321 字节"}},
+		// 未经 OptionsFromConfig 的零值同样回退为默认值
+		{NewFindTool(Options{}), []string{fmt.Sprintf("最多返回 %d 条结果", FindMaxResults)}},
+		{NewReadTool(Options{ReadMaxLines: -1}), []string{fmt.Sprintf("最多读取 %d 行", FileReadMaxLines)}},
+	}
+	for _, c := range cases {
+		desc := c.tool.Description()
+		for _, w := range c.want {
+			assert.Contains(t, desc, w, c.tool.Name())
+		}
+	}
+}
@@ -0,0 +1,585 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// patchHunk 一个待应用的修改块
+type patchHunk struct {
+	header   string   // @@ 行或 search/replace 块描述，用于报告
+	ops      []diffOp // ' ' 上下文、'-' 删除、'+' 新增
+	oldStart int      // @@ 中的原始起始行（1-based），0 表示未知
+	search   bool     // 来自 search/replace 块：要求唯一匹配
+}
+
+// filePatch 针对单个文件的补丁
+type filePatch struct {
+	path     string
+	isNew    bool
+	isDelete bool
+	hunks    []patchHunk
+}
+
+// hunkReject 未能应用的 hunk
+type hunkReject struct {
+	path   string
+	index  int
+	header string
+	reason string
+	hunk   patchHunk
+}
+
+// patchedFile 应用补丁后的文件状态（仅在内存中）
+type patchedFile struct {
+	path     string
+	target   string // 写入路径（沙箱检查时解析的路径），为空时使用 path
+	original string
+	existed  bool
+	lines    []string
+	crlf     bool
+	eofNL    bool
+	created  bool
+	deleted  bool
+	notes    []string
+}
+
+func (f *patchedFile) writePath() string {
+	if f.target != "" {
+		return f.target
+	}
+	return f.path
+}
+
+func (f *patchedFile) content() string {
+	if f.deleted {
+		return ""
+	}
+	eol := "\n"
+	if f.crlf {
+		eol = "\r\n"
+	}
+	s := strings.Join(f.lines, eol)
+	if f.eofNL && len(f.lines) > 0 {
+		s += eol
+	}
+	return s
+}
+
+// parsePatch 解析 unified diff 或 search/replace 块
+func parsePatch(text string) ([]filePatch, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if strings.Contains(text, "<<<<<<< SEARCH") {
+		return parseSearchReplace(text)
+	}
+	return parseUnifiedDiff(text)
+}
+
+func parseUnifiedDiff(text string) ([]filePatch, error) {
+	lines := strings.Split(text, "\n")
+	var patches []filePatch
+	var cur *filePatch
+	var hunk *patchHunk
+
+	flushHunk := func() {
+		if cur != nil && hunk != nil && len(hunk.ops) > 0 {
+			cur.hunks = append(cur.hunks, *hunk)
+		}
+		hunk = nil
+	}
+	flushFile := func() {
+		flushHunk()
+		if cur != nil {
+			patches = append(patches, *cur)
+		}
+		cur = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			flushFile()
+			oldPath := diffHeaderPath(line[4:])
+			newPath := diffHeaderPath(lines[i+1][4:])
+			i++
+			if strings.HasPrefix(oldPath, "a/") && strings.HasPrefix(newPath, "b/") {
+				oldPath, newPath = oldPath[2:], newPath[2:]
+			}
+			fp := filePatch{path: newPath}
+			if oldPath == "/dev/null" {
+				fp.isNew = true
+			}
+			if newPath == "/dev/null" {
+				fp.isDelete = true
+				fp.path = oldPath
+			}
+			cur = &fp
+
+		case strings.HasPrefix(line, "@@"):
+			if cur == nil {
+				return nil, fmt.Errorf("第 %d 行: hunk 之前缺少 ---/+++ 文件头", i+1)
+			}
+			flushHunk()
+			hunk = &patchHunk{header: strings.TrimSpace(line), oldStart: parseHunkStart(line)}
+
+		case hunk != nil && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "-") || strings.HasPrefix(line, "+")):
+			hunk.ops = append(hunk.ops, diffOp{line[0], line[1:]})
+
+		case hunk != nil && line == "":
+			// 模型常省略空上下文行前的空格；末尾空行单独处理
+			if i == len(lines)-1 {
+				continue
+			}
+			hunk.ops = append(hunk.ops, diffOp{' ', ""})
+
+		case strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file"
+
+		default:
+			// diff --git / index / 说明文字等，结束当前 hunk
+			flushHunk()
+		}
+	}
+	flushFile()
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("未识别到补丁内容：需要 unified diff（---/+++/@@）或 SEARCH/REPLACE 块")
+	}
+	for i := range patches {
+		trimTrailingBlankContext(&patches[i])
+	}
+	return patches, nil
+}
+
+// trimTrailingBlankContext 去掉 hunk 末尾由空行补出的多余上下文
+func trimTrailingBlankContext(fp *filePatch) {
+	for i := range fp.hunks {
+		ops := fp.hunks[i].ops
+		for len(ops) > 0 && ops[len(ops)-1].kind == ' ' && ops[len(ops)-1].text == "" {
+			ops = ops[:len(ops)-1]
+		}
+		fp.hunks[i].ops = ops
+	}
+}
+
+func diffHeaderPath(s string) string {
+	if i := strings.Index(s, "\t"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.Trim(strings.TrimSpace(s), `"`)
+}
+
+// parseHunkStart 解析 "@@ -12,5 +12,7 @@" 中的原始起始行
+func parseHunkStart(header string) int {
+	fields := strings.Fields(header)
+	for _, f := range fields {
+		if strings.HasPrefix(f, "-") {
+			num, _, _ := strings.Cut(f[1:], ",")
+			if n, err := strconv.Atoi(num); err == nil {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+func parseSearchReplace(text string) ([]filePatch, error) {
+	lines := strings.Split(text, "\n")
+	var patches []filePatch
+	index := make(map[string]int)
+	lastPath := ""
+
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed != "<<<<<<< SEARCH" {
+			if trimmed != "" && !strings.HasPrefix(trimmed, "```") {
+				lastPath = strings.Trim(trimmed, "`*: ")
+			}
+			continue
+		}
+		if lastPath == "" {
+			return nil, fmt.Errorf("第 %d 行: SEARCH 块之前需要单独一行写出文件路径", i+1)
+		}
+
+		var search, replace []string
+		j := i + 1
+		for ; j < len(lines) && strings.TrimSpace(lines[j]) != "======="; j++ {
+			search = append(search, lines[j])
+		}
+		if j >= len(lines) {
+			return nil, fmt.Errorf("第 %d 行: SEARCH 块缺少 =======", i+1)
+		}
+		k := j + 1
+		for ; k < len(lines) && strings.TrimSpace(lines[k]) != ">>>>>>> REPLACE"; k++ {
+			replace = append(replace, lines[k])
+		}
+		if k >= len(lines) {
+			return nil, fmt.Errorf("第 %d 行: SEARCH 块缺少 >>>>>>> REPLACE", i+1)
+		}
+
+		h := patchHunk{search: true}
+		for _, l := range search {
+			h.ops = append(h.ops, diffOp{'-', l})
+		}
+		for _, l := range replace {
+			h.ops = append(h.ops, diffOp{'+', l})
+		}
+
+		idx, ok := index[lastPath]
+		if !ok {
+			patches = append(patches, filePatch{path: lastPath})
+			idx = len(patches) - 1
+			index[lastPath] = idx
+		}
+		h.header = fmt.Sprintf("SEARCH/REPLACE #%d", len(patches[idx].hunks)+1)
+		patches[idx].hunks = append(patches[idx].hunks, h)
+		i = k
+	}
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("未识别到 SEARCH/REPLACE 块")
+	}
+	return patches, nil
+}
+
+// applyPatches 在内存中应用全部补丁；有任何 hunk 被拒绝时调用方不应写入
+func applyPatches(patches []filePatch) ([]*patchedFile, []hunkReject) {
+	var files []*patchedFile
+	states := make(map[string]*patchedFile)
+	var rejects []hunkReject
+
+	for _, fp := range patches {
+		st, ok := states[fp.path]
+		if !ok {
+			st = loadPatchedFile(fp.path)
+			states[fp.path] = st
+			files = append(files, st)
+		}
+
+		rejectAll := func(reason string) {
+			if len(fp.hunks) == 0 {
+				rejects = append(rejects, hunkReject{path: fp.path, index: 1, header: "(整个文件)", reason: reason})
+			}
+			for i, h := range fp.hunks {
+				rejects = append(rejects, hunkReject{path: fp.path, index: i + 1, header: h.header, reason: reason, hunk: h})
+			}
+		}
+
+		switch {
+		case fp.isDelete:
+			if !st.existed || st.deleted {
+				rejectAll("要删除的文件不存在")
+				continue
+			}
+			st.deleted = true
+			st.lines = nil
+			continue
+		case fp.isNew:
+			if st.existed && !st.deleted && strings.TrimSpace(st.original) != "" {
+				rejectAll("要新建的文件已存在")
+				continue
+			}
+			st.created, st.deleted, st.eofNL = true, false, true
+			st.lines = nil
+		case !st.existed && !st.created:
+			if !hunksOnlyAdd(fp.hunks) {
+				rejectAll("文件不存在")
+				continue
+			}
+			st.created, st.eofNL = true, true
+		}
+
+		offset := 0
+		for i, h := range fp.hunks {
+			delta, note, reason := applyHunk(st, h, offset)
+			if reason != "" {
+				rejects = append(rejects, hunkReject{path: fp.path, index: i + 1, header: h.header, reason: reason, hunk: h})
+				continue
+			}
+			offset += delta
+			if note != "" {
+				st.notes = append(st.notes, fmt.Sprintf("%s %s", h.header, note))
+			}
+		}
+	}
+	return files, rejects
+}
+
+func loadPatchedFile(path string) *patchedFile {
+	st := &patchedFile{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return st
+	}
+	st.existed = true
+	st.original = string(data)
+	st.crlf = strings.Contains(st.original, "\r\n")
+	st.eofNL = strings.HasSuffix(st.original, "\n")
+	st.lines = splitDiffLines(st.original)
+	return st
+}
+
+func hunksOnlyAdd(hunks []patchHunk) bool {
+	for _, h := range hunks {
+		for _, op := range h.ops {
+			if op.kind != '+' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// 匹配宽松度：逐级放宽空白比较
+var hunkMatchLevels = []struct {
+	name      string
+	normalize func(string) string
+}{
+	{"", func(s string) string { return s }},
+	{"忽略行尾空白", func(s string) string { return strings.TrimRight(s, " \t") }},
+	{"忽略缩进与空白", func(s string) string { return strings.Join(strings.Fields(s), " ") }},
+}
+
+// applyHunk 将 hunk 应用到文件，返回行数变化、匹配说明和拒绝原因
+func applyHunk(st *patchedFile, h patchHunk, offset int) (int, string, string) {
+	hint := 0
+	if h.oldStart > 0 {
+		hint = h.oldStart - 1 + offset
+	}
+
+	// 纯新增：按 @@ 行号插入（-N,0 表示插在第 N 行之后）
+	if !hasOldSide(h.ops) {
+		pos := len(st.lines) // search/replace 空 SEARCH 追加到末尾
+		if !h.search {
+			pos = clamp(h.oldStart+offset, 0, len(st.lines))
+		}
+		added := newSide(h.ops)
+		st.lines = spliceLines(st.lines, pos, 0, added)
+		return len(added), "", ""
+	}
+
+	// unified diff 允许像 patch 一样丢弃首尾最多 2 行上下文（fuzz）
+	maxFuzz := 2
+	if h.search {
+		maxFuzz = 0
+	}
+	for fuzz := 0; fuzz <= maxFuzz; fuzz++ {
+		ops, trimmedHead, ok := trimContext(h.ops, fuzz)
+		if !ok {
+			break
+		}
+		old := oldSide(ops)
+		for _, level := range hunkMatchLevels {
+			positions := findLines(st.lines, old, level.normalize)
+			if len(positions) == 0 {
+				continue
+			}
+			if h.search && len(positions) > 1 {
+				return 0, "", fmt.Sprintf("SEARCH 内容匹配到 %d 处，请提供更多上下文以唯一定位", len(positions))
+			}
+			pos := closest(positions, hint+trimmedHead)
+
+			segment := make([]string, 0, len(ops))
+			k := 0
+			for _, op := range ops {
+				switch op.kind {
+				case ' ':
+					segment = append(segment, st.lines[pos+k]) // 上下文保留文件原文
+					k++
+				case '-':
+					k++
+				case '+':
+					segment = append(segment, op.text)
+				}
+			}
+			st.lines = spliceLines(st.lines, pos, len(old), segment)
+
+			var notes []string
+			if level.name != "" {
+				notes = append(notes, level.name)
+			}
+			if fuzz > 0 {
+				notes = append(notes, fmt.Sprintf("fuzz %d", fuzz))
+			}
+			if h.oldStart > 0 {
+				if shift := pos - trimmedHead - hint; shift != 0 {
+					notes = append(notes, fmt.Sprintf("偏移 %+d 行", shift))
+				}
+			}
+			note := ""
+			if len(notes) > 0 {
+				note = "（" + strings.Join(notes, "，") + "）"
+			}
+			return len(segment) - len(old), note, ""
+		}
+	}
+
+	// search/replace 最后尝试非整行的子串替换
+	if h.search {
+		content := strings.Join(st.lines, "\n")
+		search := strings.Join(oldSide(h.ops), "\n")
+		if n := strings.Count(content, search); n == 1 {
+			before := len(st.lines)
+			st.lines = strings.Split(strings.Replace(content, search, strings.Join(newSide(h.ops), "\n"), 1), "\n")
+			return len(st.lines) - before, "（子串匹配）", ""
+		} else if n > 1 {
+			return 0, "", fmt.Sprintf("SEARCH 内容匹配到 %d 处，请提供更多上下文以唯一定位", n)
+		}
+	}
+	return 0, "", "未找到匹配的上下文（请先 read_file 确认当前内容）"
+}
+
+// trimContext 去掉首尾各至多 fuzz 行上下文；上下文不足时返回 false
+func trimContext(ops []diffOp, fuzz int) ([]diffOp, int, bool) {
+	if fuzz == 0 {
+		return ops, 0, true
+	}
+	head, tail := 0, 0
+	for head < fuzz && head < len(ops) && ops[head].kind == ' ' {
+		head++
+	}
+	for tail < fuzz && tail < len(ops)-head && ops[len(ops)-1-tail].kind == ' ' {
+		tail++
+	}
+	if head < fuzz && tail < fuzz {
+		return nil, 0, false
+	}
+	trimmed := ops[head : len(ops)-tail]
+	if !hasOldSide(trimmed) {
+		return nil, 0, false
+	}
+	return trimmed, head, true
+}
+
+func hasOldSide(ops []diffOp) bool {
+	for _, op := range ops {
+		if op.kind != '+' {
+			return true
+		}
+	}
+	return false
+}
+
+func oldSide(ops []diffOp) []string {
+	var out []string
+	for _, op := range ops {
+		if op.kind != '+' {
+			out = append(out, op.text)
+		}
+	}
+	return out
+}
+
+func newSide(ops []diffOp) []string {
+	var out []string
+	for _, op := range ops {
+		if op.kind != '-' {
+			out = append(out, op.text)
+		}
+	}
+	return out
+}
+
+// findLines 返回 want 在 lines 中所有匹配的起始位置
+func findLines(lines, want []string, normalize func(string) string) []int {
+	if len(want) == 0 || len(want) > len(lines) {
+		return nil
+	}
+	normWant := make([]string, len(want))
+	for i, w := range want {
+		normWant[i] = normalize(w)
+	}
+	var positions []int
+	for i := 0; i+len(want) <= len(lines); i++ {
+		match := true
+		for j := range want {
+			if normalize(lines[i+j]) != normWant[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+func closest(positions []int, hint int) int {
+	best := positions[0]
+	for _, p := range positions[1:] {
+		if abs(p-hint) < abs(best-hint) {
+			best = p
+		}
+	}
+	return best
+}
+
+func spliceLines(lines []string, pos, remove int, insert []string) []string {
+	out := make([]string, 0, len(lines)-remove+len(insert))
+	out = append(out, lines[:pos]...)
+	out = append(out, insert...)
+	return append(out, lines[pos+remove:]...)
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// writePatchedFiles 写入全部文件；中途失败时回滚已写入的文件
+func writePatchedFiles(files []*patchedFile) error {
+	var done []*patchedFile
+	rollback := func() {
+		for _, f := range done {
+			if f.existed {
+				_ = os.WriteFile(f.writePath(), []byte(f.original), 0o644)
+			} else {
+				_ = os.Remove(f.writePath())
+			}
+		}
+	}
+
+	for _, f := range files {
+		var err error
+		switch {
+		case f.deleted:
+			if f.existed {
+				err = os.Remove(f.writePath())
+			}
+		default:
+			if dir := filepath.Dir(f.writePath()); dir != "" {
+				err = os.MkdirAll(dir, 0o755)
+			}
+			if err == nil {
+				mode := os.FileMode(0o644)
+				if info, statErr := os.Stat(f.writePath()); statErr == nil {
+					mode = info.Mode().Perm()
+				}
+				err = os.WriteFile(f.writePath(), []byte(f.content()), mode)
+			}
+		}
+		if err != nil {
+			rollback()
+			return fmt.Errorf("写入 %s 失败，已回滚全部修改: %w", f.path, err)
+		}
+		done = append(done, f)
+	}
+	return nil
+}
@@ -22,14 +22,16 @@ type ReadArgs struct {
 }
 
 // ReadTool 读取文件内容
-type ReadTool struct{}
+type ReadTool struct {
+	maxLines int
+}
 
-func NewReadTool() *ReadTool { return &ReadTool{} }
+func NewReadTool(opts Options) *ReadTool { return &ReadTool{maxLines: opts.normalize().ReadMaxLines} }
 
 func (t *ReadTool) Name() string { return "read_file" }
 
 func (t *ReadTool) Description() string {
-	return "读取文件内容。可以指定起始行和结束行（1-based）。最多读取 500 行，超出部分需要分段读取。"
+	return fmt.Sprintf("读取文件内容。可以指定起始行和结束行（1-based）。最多读取 %d 行，超出部分需要分段读取。", t.maxLines)
 }
 
 func (t *ReadTool) Schema() llm.ToolParameters {
@@ -46,14 +48,14 @@ func (t *ReadTool) Schema() llm.ToolParameters {
 			},
 			"end_line": {
 				Type:        "integer",
-				Description: "结束行号（1-based），默认读到文件末尾或最多 500 行",
+				Description: fmt.Sprintf("结束行号（1-based），默认读到文件末尾或最多 %d 行", t.maxLines),
 			},
 		},
 		Required: []string{"path"},
 	}
 }
 
-func (t *ReadTool) Execute(_ context.Context, args json.RawMessage) (string, error) {
+func (t *ReadTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
 	var a ReadArgs
 	if err := json.Unmarshal(args, &a); err != nil {
 		return "", fmt.Errorf("parse read_file args: %w", err)
@@ -62,8 +64,12 @@ func (t *ReadTool) Execute(_ context.Context, args json.RawMessage) (string, err
 	if a.Path == "" {
 		return "", fmt.Errorf("path cannot be empty")
 	}
+	target, err := pathPolicyFrom(ctx).checkFile(a.Path)
+	if err != nil {
+		return "", err
+	}
 
-	f, err := os.Open(a.Path)
+	f, err := os.Open(target)
 	if err != nil {
 		return "", fmt.Errorf("open file %q: %w", a.Path, err)
 	}
@@ -85,8 +91,8 @@ func (t *ReadTool) Execute(_ context.Context, args json.RawMessage) (string, err
 	}
 
 	endLine := a.EndLine
-	if endLine <= 0 || endLine-startLine+1 > FileReadMaxLines {
-		endLine = startLine + FileReadMaxLines - 1
+	if endLine <= 0 || endLine-startLine+1 > t.maxLines {
+		endLine = startLine + t.maxLines - 1
 	}
 
 	var sb strings.Builder
@@ -120,6 +126,8 @@ func (t *ReadTool) Execute(_ context.Context, args json.RawMessage) (string, err
 		return "", fmt.Errorf("read file: %w", err)
 	}
 
+	fileTrackerFrom(ctx).Record(a.Path)
+
 	result := sb.String()
 	if result == "" {
 		return fmt.Sprintf("文件 %q 为空或指定范围（%d-%d）无内容", a.Path, startLine, endLine), nil
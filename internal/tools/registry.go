@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"sync"
 
 	"github.com/yangruihan/go-pi/internal/llm"
@@ -17,6 +18,23 @@ type Tool interface {
 	Execute(ctx context.Context, args json.RawMessage) (string, error)
 }
 
+// ProgressFunc 接收工具执行过程中的实时输出片段
+type ProgressFunc func(chunk string)
+
+// StreamingTool 可在执行过程中实时回传输出的工具（可选实现）
+// 返回值与 Execute 一致，仍为截断后交给模型的最终结果
+type StreamingTool interface {
+	Tool
+	ExecuteStream(ctx context.Context, args json.RawMessage, onProgress ProgressFunc) (string, error)
+}
+
+// RawSchemaTool 直接提供完整 JSON Schema 的工具（可选实现，如 MCP 工具）
+// 转换为 LLM 工具定义时优先于 Schema()
+type RawSchemaTool interface {
+	Tool
+	RawSchema() json.RawMessage
+}
+
 // Registry 工具注册表
 type Registry struct {
 	mu    sync.RWMutex
@@ -63,6 +81,17 @@ func (r *Registry) ToLLMTools() ([]llm.Tool, error) {
 
 	out := make([]llm.Tool, 0, len(r.tools))
 	for _, t := range r.tools {
+		if rt, ok := t.(RawSchemaTool); ok && len(rt.RawSchema()) > 0 {
+			out = append(out, llm.Tool{
+				Type: "function",
+				Function: llm.ToolFunction{
+					Name:        t.Name(),
+					Description: t.Description(),
+					Parameters:  rt.RawSchema(),
+				},
+			})
+			continue
+		}
 		tool, err := llm.BuildTool(llm.ToolSchema{
 			Name:        t.Name(),
 			Description: t.Description(),
@@ -76,11 +105,61 @@ func (r *Registry) ToLLMTools() ([]llm.Tool, error) {
 	return out, nil
 }
 
+// Validate 检查工具是否存在并按其 schema 校验参数；权限层在请求审批前调用，
+// 避免把格式错误的调用交给用户确认
+func (r *Registry) Validate(name string, args json.RawMessage) error {
+	t, ok := r.Get(name)
+	if !ok {
+		return fmt.Errorf("tool %q not found", name)
+	}
+	return validateArgs(t, args)
+}
+
 // Execute 执行指定工具
 func (r *Registry) Execute(ctx context.Context, name string, args json.RawMessage) (string, error) {
 	t, ok := r.Get(name)
 	if !ok {
 		return "", fmt.Errorf("tool %q not found", name)
 	}
+	if err := validateArgs(t, args); err != nil {
+		return "", err
+	}
 	return t.Execute(ctx, args)
 }
+
+// ExecuteStream 执行指定工具，工具支持流式输出时通过 onProgress 回传实时片段
+func (r *Registry) ExecuteStream(ctx context.Context, name string, args json.RawMessage, onProgress func(chunk string)) (string, error) {
+	t, ok := r.Get(name)
+	if !ok {
+		return "", fmt.Errorf("tool %q not found", name)
+	}
+	if err := validateArgs(t, args); err != nil {
+		return "", err
+	}
+	if st, ok := t.(StreamingTool); ok && onProgress != nil {
+		return st.ExecuteStream(ctx, args, onProgress)
+	}
+	return t.Execute(ctx, args)
+}
+
+// schemaFallbackLogged 记录已提示过 schema 无法解析的工具名
+var schemaFallbackLogged sync.Map
+
+// validateArgs 执行前按工具 schema 校验参数，错误信息提示模型修正后重试
+func validateArgs(t Tool, args json.RawMessage) error {
+	params := t.Schema()
+	if rt, ok := t.(RawSchemaTool); ok && len(rt.RawSchema()) > 0 {
+		params = llm.ToolParameters{}
+		if err := json.Unmarshal(rt.RawSchema(), &params); err != nil {
+			// 无法解析的外部 schema 交由工具自行校验，每个工具只提示一次
+			if _, logged := schemaFallbackLogged.LoadOrStore(t.Name(), true); !logged {
+				log.Printf("警告: 工具 %s 的 schema 无法解析，跳过参数校验: %v", t.Name(), err)
+			}
+			return nil
+		}
+	}
+	if err := params.Validate(args); err != nil {
+		return fmt.Errorf("%s %w，请按工具定义修正参数后重试", t.Name(), err)
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	RepoMapDefaultTokens = 1024
+
+	repoMapMaxFiles     = 5000 // 超过该数量的文件不再继续遍历
+	repoMapMaxFileBytes = 512 * 1024
+	repoMapLineMax      = 120
+)
+
+// repoMapKeyFiles 优先在仓库概览中列出的文件
+var repoMapKeyFiles = map[string]bool{
+	"go.mod": true, "package.json": true, "Cargo.toml": true, "pyproject.toml": true, "requirements.txt": true,
+	"Makefile": true, "Dockerfile": true, "docker-compose.yml": true, "README.md": true, "AGENT.md": true,
+	"main.go": true, "CONTRIBUTING.md": true,
+}
+
+type repoMapSymbol struct {
+	path  string
+	line  string
+	name  string
+	score float64
+}
+
+// BuildRepoMap 生成项目概览：目录结构、关键文件与按引用次数排序的顶层符号，总长度受 maxTokens 限制
+func BuildRepoMap(ctx context.Context, root string, maxTokens int) (string, error) {
+	if maxTokens <= 0 {
+		maxTokens = RepoMapDefaultTokens
+	}
+
+	var files []string
+	dirFiles := map[string]int{}
+	err := walkFiles(ctx, root, walkOptions{recursive: true}, func(p string, _ os.FileInfo) bool {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return true
+		}
+		files = append(files, rel)
+		for d := filepath.Dir(rel); d != "."; d = filepath.Dir(d) {
+			dirFiles[d]++ // 目录下（含子目录）的文件总数
+		}
+		return len(files) < repoMapMaxFiles
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", nil
+	}
+
+	var b strings.Builder
+	budget := maxTokens * 3 // 按约 3 字符/token 估算（与会话 token 估算的兜底算法一致）
+
+	// 目录结构最多占预算的 30%
+	b.WriteString("目录结构（目录/ 含子目录的文件数）:\n")
+	dirs := make([]string, 0, len(dirFiles))
+	for d := range dirFiles {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+	treeBudget := budget * 3 / 10
+	for i, d := range dirs {
+		line := fmt.Sprintf("%s%s/ %d\n", strings.Repeat("  ", strings.Count(d, string(filepath.Separator))), filepath.Base(d), dirFiles[d])
+		if b.Len()+len(line) > treeBudget {
+			fmt.Fprintf(&b, "  ...（还有 %d 个目录）\n", len(dirs)-i)
+			break
+		}
+		b.WriteString(line)
+	}
+
+	var keys []string
+	for _, f := range files {
+		if repoMapKeyFiles[filepath.Base(f)] && strings.Count(f, string(filepath.Separator)) <= 2 {
+			keys = append(keys, f)
+		}
+	}
+	if len(keys) > 0 {
+		if line := "\n关键文件: " + strings.Join(keys, ", ") + "\n"; b.Len()+len(line) <= budget {
+			b.WriteString(line)
+		}
+	}
+
+	symbols := rankRepoSymbols(root, files)
+	if len(symbols) > 0 {
+		const header = "\n主要符号（按引用次数排序）:\n"
+		// 选出预算内的符号后按文件分组输出
+		var chosen []repoMapSymbol
+		seen := map[string]bool{}
+		used := b.Len() + len(header)
+		for _, sym := range symbols {
+			cost := len(sym.line) + 3
+			if !seen[sym.path] {
+				cost += len(sym.path) + 2
+			}
+			if used+cost > budget {
+				break
+			}
+			used += cost
+			seen[sym.path] = true
+			chosen = append(chosen, sym)
+		}
+		if len(chosen) > 0 {
+			b.WriteString(header)
+		}
+		sort.SliceStable(chosen, func(i, j int) bool { return chosen[i].path < chosen[j].path })
+		cur := ""
+		for _, s := range chosen {
+			if s.path != cur {
+				cur = s.path
+				b.WriteString(cur + ":\n")
+			}
+			b.WriteString("  " + s.line + "\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// rankRepoSymbols 解析有语言后端支持的文件，按名称在全部源码中的出现次数排序
+func rankRepoSymbols(root string, files []string) []repoMapSymbol {
+	var symbols []repoMapSymbol
+	sources := map[string][]byte{}
+	for _, rel := range files {
+		p := filepath.Join(root, rel)
+		backend := backendFor(p)
+		if backend == nil {
+			continue
+		}
+		if info, err := os.Stat(p); err != nil || info.Size() > repoMapMaxFileBytes {
+			continue
+		}
+		src, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		sources[rel] = src
+		if strings.HasSuffix(rel, "_test.go") {
+			continue // 测试文件只参与引用计数
+		}
+		decls, err := backend.Declarations(p, src)
+		if err != nil {
+			continue
+		}
+		lines := bytes.Split(src, []byte("\n"))
+		for _, d := range decls {
+			if d.Line-1 >= len(lines) {
+				continue
+			}
+			line := strings.TrimSpace(string(lines[d.Line-1]))
+			if i := strings.Index(line, " {"); i > 0 && strings.HasPrefix(line, "func ") {
+				line = line[:i] // 去掉单行函数体
+			}
+			line = strings.TrimSpace(strings.TrimSuffix(line, "{"))
+			if len(line) > repoMapLineMax {
+				line = line[:repoMapLineMax] + "…"
+			}
+			symbols = append(symbols, repoMapSymbol{path: rel, line: line, name: d.Name})
+		}
+	}
+
+	// 同名声明（如多个类型的 Name 方法）平分引用次数，避免常见方法名占满预算
+	counts := countIdentifiers(sources)
+	sameName := map[string]int{}
+	for _, s := range symbols {
+		sameName[s.name]++
+	}
+	for i := range symbols {
+		symbols[i].score = float64(counts[symbols[i].name]) / float64(sameName[symbols[i].name])
+	}
+	sort.SliceStable(symbols, func(i, j int) bool {
+		if symbols[i].score != symbols[j].score {
+			return symbols[i].score > symbols[j].score
+		}
+		if symbols[i].path != symbols[j].path {
+			return symbols[i].path < symbols[j].path
+		}
+		return symbols[i].name < symbols[j].name
+	})
+	return symbols
+}
+
+// countIdentifiers 统计所有源码中各标识符出现的次数
+func countIdentifiers(sources map[string][]byte) map[string]int {
+	counts := map[string]int{}
+	isIdent := func(c byte) bool {
+		return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+	}
+	for _, src := range sources {
+		for i := 0; i < len(src); {
+			if !isIdent(src[i]) {
+				i++
+				continue
+			}
+			j := i
+			for j < len(src) && isIdent(src[j]) {
+				j++
+			}
+			counts[string(src[i:j])]++
+			i = j
+		}
+	}
+	return counts
+}
+
+// repoMapCache 缓存文件内容
+type repoMapCache struct {
+	Key string `json:"key"`
+	Map string `json:"map"`
+}
+
+// LoadRepoMap 返回项目概览，结果按 git 提交（非 git 仓库按文件最新修改时间）缓存在 cacheDir 下
+func LoadRepoMap(ctx context.Context, root, cacheDir string, maxTokens int) (string, error) {
+	if maxTokens <= 0 {
+		maxTokens = RepoMapDefaultTokens
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	key := repoMapVersion(ctx, abs)
+	if key != "" {
+		key = fmt.Sprintf("%s|%d", key, maxTokens)
+	}
+
+	sum := sha1.Sum([]byte(abs))
+	cacheFile := ""
+	if cacheDir != "" {
+		cacheFile = filepath.Join(cacheDir, hex.EncodeToString(sum[:8])+".json")
+		if key != "" {
+			if data, err := os.ReadFile(cacheFile); err == nil {
+				var c repoMapCache
+				if json.Unmarshal(data, &c) == nil && c.Key == key {
+					return c.Map, nil
+				}
+			}
+		}
+	}
+
+	out, err := BuildRepoMap(ctx, abs, maxTokens)
+	if err != nil {
+		return "", err
+	}
+	if cacheFile != "" && key != "" {
+		if data, err := json.Marshal(repoMapCache{Key: key, Map: out}); err == nil {
+			if os.MkdirAll(cacheDir, 0o755) == nil {
+				_ = os.WriteFile(cacheFile, data, 0o644)
+			}
+		}
+	}
+	return out, nil
+}
+
+// repoMapVersion git 仓库返回 HEAD 提交；否则返回文件最新修改时间
+func repoMapVersion(ctx context.Context, root string) string {
+	if commit := gitHeadCommit(root); commit != "" {
+		return "git:" + commit
+	}
+	var latest time.Time
+	count := 0
+	_ = walkFiles(ctx, root, walkOptions{recursive: true, includeDirs: true}, func(_ string, info os.FileInfo) bool {
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		count++
+		return count < repoMapMaxFiles
+	})
+	if latest.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("mtime:%d:%d", latest.UnixNano(), count)
+}
+
+// gitHeadCommit 直接读取 .git 目录解析 HEAD 指向的提交，不依赖 git 命令
+func gitHeadCommit(root string) string {
+	gitDir := filepath.Join(root, ".git")
+	info, err := os.Stat(gitDir)
+	if err != nil {
+		return ""
+	}
+	if !info.IsDir() {
+		// worktree / submodule: ".git" 文件内容为 "gitdir: <path>"
+		data, err := os.ReadFile(gitDir)
+		if err != nil {
+			return ""
+		}
+		dir := strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(root, dir)
+		}
+		gitDir = dir
+	}
+	head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	ref := strings.TrimSpace(string(head))
+	if !strings.HasPrefix(ref, "ref:") {
+		return ref
+	}
+	ref = strings.TrimSpace(strings.TrimPrefix(ref, "ref:"))
+	if data, err := os.ReadFile(filepath.Join(gitDir, filepath.FromSlash(ref))); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	packed, err := os.ReadFile(filepath.Join(gitDir, "packed-refs"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(packed), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[1] == ref {
+			return fields[0]
+		}
+	}
+	return ""
+}
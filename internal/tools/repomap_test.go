@@ -0,0 +1,65 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildRepoMap(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"go.mod": "module example\n",
+		"server/server.go": `package server
+
+type Server struct{}
+
+func NewServer() *Server { return &Server{} }
+
+func (s *Server) Name() string { return "s" }
+
+func unused() {}
+`,
+		"cmd/app/main.go": `package main
+
+func main() {
+	a := server.NewServer()
+	b := server.NewServer()
+	_, _ = a, b
+}
+`,
+	})
+
+	out, err := BuildRepoMap(context.Background(), root, 1024)
+	require.NoError(t, err)
+	assert.Contains(t, out, "cmd/ 1\n  app/ 1")
+	assert.Contains(t, out, "关键文件: "+filepath.Join("cmd", "app", "main.go")+", go.mod")
+	assert.Contains(t, out, "  func NewServer() *Server")
+	assert.Less(t, strings.Index(out, "func NewServer"), strings.Index(out, "func unused"))
+
+	small, err := BuildRepoMap(context.Background(), root, 40)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(small), 40*3)
+	assert.NotContains(t, small, "func unused")
+
+	// 缓存命中时不重新生成
+	cacheDir := t.TempDir()
+	first, err := LoadRepoMap(context.Background(), root, cacheDir, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, out, first)
+	entries, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	cacheFile := filepath.Join(cacheDir, entries[0].Name())
+	data, err := os.ReadFile(cacheFile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(cacheFile, []byte(strings.Replace(string(data), "NewServer", "Cached", 1)), 0o644))
+	cached, err := LoadRepoMap(context.Background(), root, cacheDir, 1024)
+	require.NoError(t, err)
+	assert.Contains(t, cached, "Cached")
+}
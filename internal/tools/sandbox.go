@@ -0,0 +1,231 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/yangruihan/go-pi/internal/config"
+)
+
+// PathPolicy 限制文件工具只能访问工作区（会话工作目录 + 额外目录），
+// 路径在检查前会解析 .. 与符号链接
+type PathPolicy struct {
+	roots        []string
+	deny         []string // 绝对路径前缀
+	denyGlobs    []string // 含通配符的模式；不含路径分隔符时匹配文件名
+	maxFileBytes int64
+}
+
+// NewPathPolicy 根据配置构建路径策略；未启用时返回 nil（不做限制）
+func NewPathPolicy(cwd string, cfg config.SandboxConfig) *PathPolicy {
+	if !cfg.Enabled {
+		return nil
+	}
+	p := &PathPolicy{maxFileBytes: cfg.MaxFileBytes}
+	for _, root := range append([]string{cwd}, cfg.ExtraRoots...) {
+		if strings.TrimSpace(root) == "" {
+			continue
+		}
+		p.roots = append(p.roots, resolvePath(absFrom(cwd, root)))
+	}
+	for _, d := range cfg.DenyPaths {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		if strings.ContainsAny(d, "*?[") {
+			p.denyGlobs = append(p.denyGlobs, filepath.ToSlash(expandHome(d)))
+			continue
+		}
+		p.deny = append(p.deny, resolvePath(absFrom(cwd, d)))
+	}
+	return p
+}
+
+type pathPolicyKey struct{}
+
+// WithPathPolicy 返回携带路径策略的 context；未携带时文件工具不做路径限制
+func WithPathPolicy(ctx context.Context, p *PathPolicy) context.Context {
+	return context.WithValue(ctx, pathPolicyKey{}, p)
+}
+
+func pathPolicyFrom(ctx context.Context) *PathPolicy {
+	p, _ := ctx.Value(pathPolicyKey{}).(*PathPolicy)
+	return p
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
+
+func absFrom(cwd, path string) string {
+	path = expandHome(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cwd, path)
+	}
+	return filepath.Clean(path)
+}
+
+// resolvePath 解析符号链接；路径尚不存在时解析最深的已存在祖先目录
+func resolvePath(abs string) string {
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	dir, rest := filepath.Dir(abs), filepath.Base(abs)
+	if dir == abs {
+		return abs
+	}
+	return filepath.Join(resolvePath(dir), rest)
+}
+
+func withinDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Check 检查路径是否允许访问，返回解析后的绝对路径
+func (p *PathPolicy) Check(path string) (string, error) {
+	cwd, _ := os.Getwd()
+	resolved := resolvePath(absFrom(cwd, path))
+	if p == nil {
+		return resolved, nil
+	}
+	if p.denied(resolved) {
+		return "", fmt.Errorf("路径 %s 被 tools.sandbox.deny_paths 禁止访问", path)
+	}
+	for _, root := range p.roots {
+		if withinDir(resolved, root) {
+			return resolved, nil
+		}
+	}
+	msg := fmt.Sprintf("路径 %s 超出工作区（允许: %s）", path, strings.Join(p.roots, ", "))
+	if resolved != absFrom(cwd, path) {
+		msg += "，符号链接指向 " + resolved
+	}
+	return "", fmt.Errorf("%s；如确需访问，请让用户在 tools.sandbox.extra_roots 中添加该目录", msg)
+}
+
+func (p *PathPolicy) denied(resolved string) bool {
+	for _, d := range p.deny {
+		if withinDir(resolved, d) {
+			return true
+		}
+	}
+	slash := filepath.ToSlash(resolved)
+	for _, g := range p.denyGlobs {
+		target := slash
+		if !strings.Contains(g, "/") {
+			target = filepath.Base(resolved)
+		}
+		if ok, _ := filepath.Match(g, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// skipInWalk 遍历目录时判断条目是否应跳过：命中 deny_paths，或符号链接指向工作区之外
+func (p *PathPolicy) skipInWalk(path string, info os.FileInfo) bool {
+	if p == nil {
+		return false
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		_, err := p.Check(path)
+		return err != nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	return p.denied(abs)
+}
+
+// CheckSize 检查文件大小是否超过上限
+func (p *PathPolicy) CheckSize(path string, size int64) error {
+	if p == nil || p.maxFileBytes <= 0 || size <= p.maxFileBytes {
+		return nil
+	}
+	return fmt.Errorf("%s 大小 %d 字节，超过上限 %d 字节（tools.sandbox.max_file_bytes）", path, size, p.maxFileBytes)
+}
+
+// checkFile 检查路径并在文件存在时检查大小，返回解析后的路径；
+// 调用方应读写该路径，避免检查之后符号链接被替换而越出工作区
+func (p *PathPolicy) checkFile(path string) (string, error) {
+	resolved, err := p.Check(path)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(resolved); err == nil && !info.IsDir() {
+		return resolved, p.CheckSize(path, info.Size())
+	}
+	return resolved, nil
+}
+
+// restrictedEnvKeys 受限 shell 保留的环境变量，其余（令牌、代理、云凭据等）一律丢弃
+var restrictedEnvKeys = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_ALL", "LC_CTYPE", "TERM", "TMPDIR", "TZ"}
+
+func scrubbedEnv() []string {
+	env := make([]string, 0, len(restrictedEnvKeys))
+	for _, k := range restrictedEnvKeys {
+		if v, ok := os.LookupEnv(k); ok {
+			env = append(env, k+"="+v)
+		}
+	}
+	return env
+}
+
+var (
+	isolatorOnce sync.Once
+	isolator     []string
+)
+
+// networkIsolator 返回可用的断网包装命令（优先 bwrap，其次 unshare），均不可用时返回 nil
+func networkIsolator() []string {
+	isolatorOnce.Do(func() {
+		candidates := [][]string{
+			{"bwrap", "--dev-bind", "/", "/", "--unshare-net", "--die-with-parent"},
+			{"unshare", "--user", "--map-root-user", "--net"},
+		}
+		for _, c := range candidates {
+			if _, err := exec.LookPath(c[0]); err != nil {
+				continue
+			}
+			// 用户命名空间可能被系统禁用，实际运行一次确认可用
+			if err := exec.Command(c[0], append(c[1:], "true")...).Run(); err == nil {
+				isolator = c
+				return
+			}
+		}
+	})
+	return isolator
+}
+
+// shellCommand 创建 shell 命令；restricted 时使用精简环境变量，并在可用时断开网络
+func shellCommand(restricted bool, name string, args ...string) *exec.Cmd {
+	return shellCommandContext(context.Background(), restricted, name, args...)
+}
+
+// shellCommandContext 同 shellCommand，ctx 结束时终止进程
+func shellCommandContext(ctx context.Context, restricted bool, name string, args ...string) *exec.Cmd {
+	if !restricted || isWindows() {
+		return exec.CommandContext(ctx, name, args...)
+	}
+	var cmd *exec.Cmd
+	if wrap := networkIsolator(); wrap != nil {
+		cmd = exec.CommandContext(ctx, wrap[0], append(append(wrap[1:len(wrap):len(wrap)], name), args...)...)
+	} else {
+		cmd = exec.CommandContext(ctx, name, args...)
+	}
+	cmd.Env = scrubbedEnv()
+	return cmd
+}
@@ -0,0 +1,74 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yangruihan/go-pi/internal/config"
+)
+
+func TestPathPolicyRestrictsFileTools(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "ok.txt"), []byte("inside\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "secret.key"), []byte("inside secret\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("outside secret\n"), 0o644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "link")))
+
+	policy := NewPathPolicy(root, config.SandboxConfig{Enabled: true, DenyPaths: []string{"*.key"}, MaxFileBytes: 16})
+	ctx := WithPathPolicy(context.Background(), policy)
+	read := NewReadTool(DefaultOptions())
+
+	_, err := execTool(t, ctx, read, map[string]any{"path": filepath.Join(root, "ok.txt")})
+	require.NoError(t, err)
+
+	for _, p := range []string{
+		filepath.Join(outside, "secret.txt"),
+		filepath.Join(root, "..", filepath.Base(outside), "secret.txt"),
+		filepath.Join(root, "link", "secret.txt"),
+	} {
+		_, err = execTool(t, ctx, read, map[string]any{"path": p})
+		require.Error(t, err, p)
+		assert.Contains(t, err.Error(), "超出工作区")
+	}
+
+	_, err = execTool(t, ctx, read, map[string]any{"path": filepath.Join(root, "secret.key")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "deny_paths")
+
+	_, err = execTool(t, ctx, NewWriteTool(), map[string]any{"path": filepath.Join(root, "big.txt"), "content": strings.Repeat("x", 17)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "max_file_bytes")
+
+	// 目录遍历跳过被拒绝的文件与指向工作区外的符号链接
+	out, err := execTool(t, ctx, NewGrepTool(DefaultOptions()), map[string]any{"pattern": "secret", "path": root})
+	require.NoError(t, err)
+	assert.Equal(t, "未找到匹配项", out)
+	out, err = execTool(t, ctx, NewLSTool(), map[string]any{"path": root})
+	require.NoError(t, err)
+	assert.Equal(t, "ok.txt", out)
+
+	// 后台任务的工作目录同样受限
+	jobs := NewJobManager(DefaultOptions())
+	defer jobs.Close()
+	_, err = execTool(t, ctx, NewJobTools(jobs, DefaultOptions())[0], map[string]any{"command": "true", "workdir": outside})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "超出工作区")
+	assert.Empty(t, jobs.List())
+}
+
+func TestRestrictedShellScrubsEnv(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil || isWindows() {
+		t.Skip("bash not available")
+	}
+	t.Setenv("GOPI_TEST_SECRET", "leak")
+	out, err := shellCommand(true, "bash", "-c", `echo "[$GOPI_TEST_SECRET]"`).Output()
+	require.NoError(t, err)
+	assert.Equal(t, "[]\n", string(out))
+}
@@ -0,0 +1,293 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yangruihan/go-pi/internal/llm"
+)
+
+// Symbol 源码中的一个声明
+type Symbol struct {
+	Name      string
+	Kind      string // func / method / type / struct / interface / const / var 等，由语言后端决定
+	Container string // 所属类型（方法的接收者、接口名），无则为空
+	Path      string
+	Line      int
+}
+
+// QualifiedName 返回带所属类型的名称，如 Type.Method
+func (s Symbol) QualifiedName() string {
+	if s.Container == "" {
+		return s.Name
+	}
+	return s.Container + "." + s.Name
+}
+
+// LanguageBackend code_symbols 的语言后端，按文件路径选择
+type LanguageBackend interface {
+	Name() string
+	// Match 返回该后端是否处理此文件
+	Match(path string) bool
+	// Declarations 返回文件中的声明
+	Declarations(path string, src []byte) ([]Symbol, error)
+	// References 返回标识符 name 在文件中出现的行号（含定义处）
+	References(path string, src []byte, name string) ([]int, error)
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = []LanguageBackend{goBackend{}}
+)
+
+// RegisterLanguageBackend 注册语言后端；与已有后端同名时替换
+func RegisterLanguageBackend(b LanguageBackend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	for i, existing := range backends {
+		if existing.Name() == b.Name() {
+			backends[i] = b
+			return
+		}
+	}
+	backends = append(backends, b)
+}
+
+func backendFor(path string) LanguageBackend {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	for _, b := range backends {
+		if b.Match(path) {
+			return b
+		}
+	}
+	return nil
+}
+
+func backendNames() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	names := make([]string, 0, len(backends))
+	for _, b := range backends {
+		names = append(names, b.Name())
+	}
+	return names
+}
+
+// CodeSymbolsArgs code_symbols 参数
+type CodeSymbolsArgs struct {
+	Action string `json:"action"`
+	Path   string `json:"path,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// CodeSymbolsTool 基于语法树的符号导航：列出声明、跳转定义、查找引用
+type CodeSymbolsTool struct {
+	maxResults int
+}
+
+func NewCodeSymbolsTool(opts Options) *CodeSymbolsTool {
+	return &CodeSymbolsTool{maxResults: opts.normalize().GrepMaxMatches}
+}
+
+func (t *CodeSymbolsTool) Name() string { return "code_symbols" }
+
+func (t *CodeSymbolsTool) Description() string {
+	return fmt.Sprintf("基于语法树的代码导航（支持语言: %s）。list 列出文件或目录（单个包）中的声明；definition 查找符号定义；references 按标识符查找引用。输出格式与 grep_search 相同（path:line:text），最多返回 %d 条结果。", strings.Join(backendNames(), ", "), t.maxResults)
+}
+
+func (t *CodeSymbolsTool) Schema() llm.ToolParameters {
+	return llm.ToolParameters{
+		Type: "object",
+		Properties: map[string]llm.ToolProperty{
+			"action": {
+				Type:        "string",
+				Description: "list：列出声明；definition：查找定义；references：查找引用",
+				Enum:        []any{"list", "definition", "references"},
+			},
+			"path": {Type: "string", Description: "list 时为文件或目录；definition / references 时为搜索根目录，默认当前目录"},
+			"name": {Type: "string", Description: "符号名，方法可写作 Type.Method（definition / references 必填）"},
+		},
+		Required: []string{"action"},
+	}
+}
+
+// symbolHit 一条输出结果
+type symbolHit struct {
+	path string
+	line int
+}
+
+func (t *CodeSymbolsTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	var a CodeSymbolsArgs
+	if err := json.Unmarshal(args, &a); err != nil {
+		return "", fmt.Errorf("parse code_symbols args: %w", err)
+	}
+	if a.Path == "" {
+		a.Path = "."
+	}
+	policy := pathPolicyFrom(ctx)
+	if _, err := policy.Check(a.Path); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(a.Path)
+	if err != nil {
+		return "", fmt.Errorf("stat path: %w", err)
+	}
+
+	var hits []symbolHit
+	switch a.Action {
+	case "list":
+		files := []string{a.Path}
+		if info.IsDir() {
+			files, err = collectSourceFiles(ctx, a.Path, false, policy)
+			if err != nil {
+				return "", err
+			}
+		} else if backendFor(a.Path) == nil {
+			return "", fmt.Errorf("不支持的文件类型: %s（支持: %s）", a.Path, strings.Join(backendNames(), ", "))
+		}
+		for _, f := range files {
+			syms, err := fileDeclarations(f)
+			if err != nil {
+				return "", fmt.Errorf("parse %s: %w", f, err)
+			}
+			for _, s := range syms {
+				hits = append(hits, symbolHit{path: s.Path, line: s.Line})
+			}
+		}
+	case "definition", "references":
+		name := strings.TrimSpace(a.Name)
+		if name == "" {
+			return "", fmt.Errorf("name is required for %s", a.Action)
+		}
+		if !info.IsDir() {
+			return "", fmt.Errorf("%s 需要目录作为搜索根目录", a.Action)
+		}
+		files, err := collectSourceFiles(ctx, a.Path, true, policy)
+		if err != nil {
+			return "", err
+		}
+		if a.Action == "definition" {
+			hits = findDefinitions(files, name)
+		} else {
+			hits = findReferences(files, name)
+		}
+	default:
+		return "", fmt.Errorf("invalid action %q (list | definition | references)", a.Action)
+	}
+
+	if len(hits) == 0 {
+		return "未找到符号", nil
+	}
+	return formatSymbolHits(hits, t.maxResults), nil
+}
+
+// collectSourceFiles 收集有语言后端支持的文件（遵循 .gitignore）
+func collectSourceFiles(ctx context.Context, root string, recursive bool, policy *PathPolicy) ([]string, error) {
+	var files []string
+	err := walkFiles(ctx, root, walkOptions{recursive: recursive, policy: policy}, func(p string, _ os.FileInfo) bool {
+		if backendFor(p) != nil {
+			files = append(files, p)
+		}
+		return true
+	})
+	return files, err
+}
+
+func fileDeclarations(path string) ([]Symbol, error) {
+	b := backendFor(path)
+	if b == nil {
+		return nil, nil
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return b.Declarations(path, src)
+}
+
+func findDefinitions(files []string, name string) []symbolHit {
+	short := name[strings.LastIndex(name, ".")+1:]
+	var hits []symbolHit
+	for _, f := range files {
+		src, err := os.ReadFile(f)
+		if err != nil || !bytes.Contains(src, []byte(short)) {
+			continue
+		}
+		syms, err := backendFor(f).Declarations(f, src)
+		if err != nil {
+			continue
+		}
+		for _, s := range syms {
+			if s.Name == name || s.QualifiedName() == name {
+				hits = append(hits, symbolHit{path: s.Path, line: s.Line})
+			}
+		}
+	}
+	return hits
+}
+
+func findReferences(files []string, name string) []symbolHit {
+	ident := name[strings.LastIndex(name, ".")+1:]
+	var hits []symbolHit
+	for _, f := range files {
+		src, err := os.ReadFile(f)
+		if err != nil || !bytes.Contains(src, []byte(ident)) {
+			continue
+		}
+		lines, err := backendFor(f).References(f, src, ident)
+		if err != nil {
+			continue
+		}
+		for _, l := range lines {
+			hits = append(hits, symbolHit{path: f, line: l})
+		}
+	}
+	return hits
+}
+
+// formatSymbolHits 以 path:line:text 输出（同一行只输出一次）
+func formatSymbolHits(hits []symbolHit, limit int) string {
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].path != hits[j].path {
+			return hits[i].path < hits[j].path
+		}
+		return hits[i].line < hits[j].line
+	})
+	uniq := hits[:0]
+	for _, h := range hits {
+		if len(uniq) == 0 || h != uniq[len(uniq)-1] {
+			uniq = append(uniq, h)
+		}
+	}
+
+	var out []string
+	var curPath string
+	var curLines []string
+	for i, h := range uniq {
+		if i >= limit {
+			out = append(out, fmt.Sprintf("... 还有 %d 条结果未显示（共 %d 条）", len(uniq)-limit, len(uniq)))
+			break
+		}
+		if h.path != curPath {
+			curPath = h.path
+			curLines = nil
+			if data, err := os.ReadFile(h.path); err == nil {
+				curLines = strings.Split(string(data), "\n")
+			}
+		}
+		text := ""
+		if h.line-1 < len(curLines) {
+			text = strings.TrimSpace(curLines[h.line-1])
+		}
+		out = append(out, fmt.Sprintf("%s:%d:%s", h.path, h.line, text))
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,105 @@
+package tools
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+)
+
+// goBackend 基于 go/parser 与 go/ast 的 Go 语言后端（仅语法分析，不做类型检查）
+type goBackend struct{}
+
+func (goBackend) Name() string { return "go" }
+
+func (goBackend) Match(path string) bool { return filepath.Ext(path) == ".go" }
+
+func (goBackend) Declarations(path string, src []byte) ([]Symbol, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+	if err != nil && f == nil {
+		return nil, err
+	}
+
+	var out []Symbol
+	add := func(name, kind, container string, pos token.Pos) {
+		if name == "_" {
+			return
+		}
+		out = append(out, Symbol{Name: name, Kind: kind, Container: container, Path: path, Line: fset.Position(pos).Line})
+	}
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				add(d.Name.Name, "method", receiverTypeName(d.Recv.List[0].Type), d.Name.Pos())
+			} else {
+				add(d.Name.Name, "func", "", d.Name.Pos())
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					kind := "type"
+					switch t := s.Type.(type) {
+					case *ast.StructType:
+						kind = "struct"
+					case *ast.InterfaceType:
+						kind = "interface"
+						for _, m := range t.Methods.List {
+							for _, n := range m.Names {
+								add(n.Name, "method", s.Name.Name, n.Pos())
+							}
+						}
+					}
+					add(s.Name.Name, kind, "", s.Name.Pos())
+				case *ast.ValueSpec:
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, n := range s.Names {
+						add(n.Name, kind, "", n.Pos())
+					}
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+func (goBackend) References(path string, src []byte, name string) ([]int, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+	if err != nil && f == nil {
+		return nil, err
+	}
+	var lines []int
+	ast.Inspect(f, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == name {
+			lines = append(lines, fset.Position(id.Pos()).Line)
+		}
+		return true
+	})
+	return lines, nil
+}
+
+// receiverTypeName 提取方法接收者的类型名（去掉指针与类型参数）
+func receiverTypeName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodeSymbols(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a/a.go": `package a
+
+type Server struct{}
+
+func (s *Server) Start() error { return nil }
+
+const (
+	Mode = "x"
+)
+
+func NewServer() *Server { return &Server{} }
+`,
+		"b/b.go": `package b
+
+import "example/a"
+
+func run() {
+	s := a.NewServer()
+	_ = s.Start()
+}
+`,
+	})
+	tool := NewCodeSymbolsTool(DefaultOptions())
+	run := func(args map[string]any) string {
+		out, err := execTool(t, context.Background(), tool, args)
+		require.NoError(t, err)
+		return strings.ReplaceAll(out, root+string(filepath.Separator), "")
+	}
+	a := filepath.Join("a", "a.go")
+	b := filepath.Join("b", "b.go")
+
+	assert.Equal(t, strings.Join([]string{
+		a + ":3:type Server struct{}",
+		a + ":5:func (s *Server) Start() error { return nil }",
+		a + `:8:Mode = "x"`,
+		a + ":11:func NewServer() *Server { return &Server{} }",
+	}, "\n"), run(map[string]any{"action": "list", "path": filepath.Join(root, "a")}))
+
+	assert.Equal(t, a+":5:func (s *Server) Start() error { return nil }", run(map[string]any{"action": "definition", "name": "Server.Start", "path": root}))
+
+	assert.Equal(t, strings.Join([]string{
+		a + ":11:func NewServer() *Server { return &Server{} }",
+		b + ":6:s := a.NewServer()",
+	}, "\n"), run(map[string]any{"action": "references", "name": "NewServer", "path": root}))
+
+	_, err := execTool(t, context.Background(), tool, map[string]any{"action": "definition", "path": root})
+	assert.Error(t, err)
+}
@@ -15,6 +15,8 @@ type WriteArgs struct {
 	Path    string `json:"path"`
 	Content string `json:"content"`
 	Append  bool   `json:"append,omitempty"`
+	// Overwrite 明确覆盖本会话未读取过（或读取后已变化）的已有文件
+	Overwrite bool `json:"overwrite,omitempty"`
 }
 
 // WriteTool 写入文件（覆盖或追加）
@@ -25,7 +27,7 @@ func NewWriteTool() *WriteTool { return &WriteTool{} }
 func (t *WriteTool) Name() string { return "write_file" }
 
 func (t *WriteTool) Description() string {
-	return "写入文件内容。默认覆盖写入，可通过 append=true 追加写入。"
+	return "写入文件内容。默认覆盖写入，可通过 append=true 追加写入。覆盖已存在的文件前需先用 read_file 读取；确需直接覆盖时设置 overwrite=true。"
 }
 
 func (t *WriteTool) Schema() llm.ToolParameters {
@@ -35,12 +37,13 @@ func (t *WriteTool) Schema() llm.ToolParameters {
 			"path": {Type: "string", Description: "文件路径"},
 			"content": {Type: "string", Description: "写入内容"},
 			"append": {Type: "boolean", Description: "是否追加写入，默认 false（覆盖）"},
+			"overwrite": {Type: "boolean", Description: "覆盖未读取过或读取后已被修改的已有文件，默认 false"},
 		},
 		Required: []string{"path", "content"},
 	}
 }
 
-func (t *WriteTool) Execute(_ context.Context, args json.RawMessage) (string, error) {
+func (t *WriteTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
 	var a WriteArgs
 	if err := json.Unmarshal(args, &a); err != nil {
 		return "", fmt.Errorf("parse write_file args: %w", err)
@@ -49,7 +52,34 @@ func (t *WriteTool) Execute(_ context.Context, args json.RawMessage) (string, er
 		return "", fmt.Errorf("path cannot be empty")
 	}
 
-	if err := os.MkdirAll(filepath.Dir(a.Path), 0o755); err != nil {
+	policy := pathPolicyFrom(ctx)
+	// 之后的文件操作都使用检查时解析的路径，避免符号链接被替换而越出工作区
+	target, err := policy.Check(a.Path)
+	if err != nil {
+		return "", err
+	}
+	size := int64(len(a.Content))
+	if info, err := os.Stat(target); err == nil && a.Append {
+		size += info.Size()
+	}
+	if err := policy.CheckSize(a.Path, size); err != nil {
+		return "", err
+	}
+
+	tracker := fileTrackerFrom(ctx)
+	if tracker != nil && !a.Append && !a.Overwrite {
+		if _, err := os.Stat(target); err == nil {
+			if !tracker.Seen(a.Path) {
+				return "", fmt.Errorf("%s 已存在且本会话未读取过，请先 read_file 确认内容；确需整体覆盖请设置 overwrite=true", a.Path)
+			}
+			if err := tracker.CheckFresh(a.Path); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	recordChange(ctx, a.Path)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
 		return "", fmt.Errorf("create parent dir: %w", err)
 	}
 
@@ -60,7 +90,7 @@ func (t *WriteTool) Execute(_ context.Context, args json.RawMessage) (string, er
 		flag |= os.O_TRUNC
 	}
 
-	f, err := os.OpenFile(a.Path, flag, 0o644)
+	f, err := os.OpenFile(target, flag, 0o644)
 	if err != nil {
 		return "", fmt.Errorf("open file for write: %w", err)
 	}
@@ -70,6 +100,9 @@ func (t *WriteTool) Execute(_ context.Context, args json.RawMessage) (string, er
 	if err != nil {
 		return "", fmt.Errorf("write file: %w", err)
 	}
+	if !a.Append || tracker.Seen(a.Path) {
+		tracker.Record(a.Path)
+	}
 
 	mode := "覆盖"
 	if a.Append {
@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,8 +13,10 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/yangruihan/go-pi/internal/agent"
 	"github.com/yangruihan/go-pi/internal/config"
+	"github.com/yangruihan/go-pi/internal/permission"
 	"github.com/yangruihan/go-pi/internal/session"
 	"github.com/yangruihan/go-pi/internal/skills"
+	"github.com/yangruihan/go-pi/internal/tools"
 	"golang.org/x/term"
 )
 
@@ -30,12 +33,19 @@ type resizePollMsg struct {
 	height int
 }
 
+// approvalRequestMsg 工具调用审批请求，通过 reply 回传用户选择
+type approvalRequestMsg struct {
+	req   permission.Request
+	reply chan permission.Decision
+}
+
 type modalType int
 
 const (
 	modalNone modalType = iota
 	modalSession
 	modalModel
+	modalApproval
 )
 
 type AppModel struct {
@@ -51,9 +61,10 @@ type AppModel struct {
 	msgs    []chatMessage
 	tools   []toolItem
 	stream  bool
-	tokens  int
+	tokens  tokenStatus
 	scroll  int
 	expandTools bool
+	expandThinking bool
 	lastErr string
 	statusHint string
 	compacting bool
@@ -63,6 +74,7 @@ type AppModel struct {
 	pickerIndex int
 	sessionItems []session.SessionMeta
 	modelItems []string
+	approval *approvalRequestMsg
 
 	eventCh chan tea.Msg
 
@@ -84,14 +96,44 @@ func NewAppModel(sess session.Session, cfg config.Config) AppModel {
 		default:
 		}
 	})
+	sess.SetApprover(&tuiApprover{eventCh: m.eventCh})
 	for _, msg := range sess.Messages() {
-		m.msgs = append(m.msgs, chatMessage{Role: msg.Role, Content: msg.Content})
+		m.msgs = append(m.msgs, chatMessage{Role: msg.Role, Content: msg.Content, Thinking: msg.Thinking})
 	}
-	m.tokens = estimateTokenLike(m.msgs)
+	m.refreshTokens()
 	m.modelItems = buildModelItems(cfg, sess.Model())
 	return m
 }
 
+// refreshTokens 刷新状态栏的 token 估算与会话实际用量
+func (m *AppModel) refreshTokens() {
+	m.tokens = tokenStatus{
+		show:     m.cfg.TUI.ShowTokenCount,
+		estimate: estimateTokenLike(m.msgs),
+		usage:    m.sess.Usage(),
+	}
+}
+
+// tuiApprover 通过模态框向用户请求工具调用审批
+type tuiApprover struct {
+	eventCh chan tea.Msg
+}
+
+func (a *tuiApprover) Approve(ctx context.Context, req permission.Request) (permission.Decision, error) {
+	msg := approvalRequestMsg{req: req, reply: make(chan permission.Decision, 1)}
+	select {
+	case a.eventCh <- msg:
+	case <-ctx.Done():
+		return permission.DecisionDenyOnce, ctx.Err()
+	}
+	select {
+	case d := <-msg.reply:
+		return d, nil
+	case <-ctx.Done():
+		return permission.DecisionDenyOnce, ctx.Err()
+	}
+}
+
 func Run(sess session.Session, cfg config.Config) error {
 	m := NewAppModel(sess, cfg)
 	p := tea.NewProgram(m, tea.WithAltScreen())
@@ -160,29 +202,47 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.msgs = append(m.msgs, chatMessage{Role: "assistant", Content: ""})
 			}
 			m.msgs[len(m.msgs)-1].Content += ev.Delta
+		case agent.AgentEventThinking:
+			m.stream = true
+			if len(m.msgs) == 0 || m.msgs[len(m.msgs)-1].Role != "assistant" {
+				m.msgs = append(m.msgs, chatMessage{Role: "assistant", Content: ""})
+			}
+			m.msgs[len(m.msgs)-1].Thinking += ev.Delta
 		case agent.AgentEventToolCall:
 			if ev.ToolName == "context_compaction" {
 				m.compacting = true
 				m.statusHint = "[正在压缩上下文，请稍候...]"
 			} else {
-				m.tools = append(m.tools, toolItem{Name: ev.ToolName, Args: ev.ToolArgs})
+				m.tools = append(m.tools, toolItem{ID: ev.ToolCallID, Name: ev.ToolName, Args: ev.ToolArgs})
+			}
+		case agent.AgentEventToolProgress:
+			if t := m.findTool(ev.ToolCallID); t != nil {
+				t.appendLive(ev.Delta)
 			}
 		case agent.AgentEventToolResult:
 			if ev.ToolName == "context_compaction" {
 				m.compacting = false
 				m.statusHint = ev.ToolResult
-			} else if len(m.tools) > 0 {
-				m.tools[len(m.tools)-1].Output = ev.ToolResult
+			} else if t := m.findTool(ev.ToolCallID); t != nil {
+				t.Output = ev.ToolResult
 			}
 		case agent.AgentEventError:
 			if ev.Err != nil {
 				m.lastErr = ev.Err.Error()
 			}
 			m.compacting = false
+		case agent.AgentEventNotice, agent.AgentEventFallback:
+			m.statusHint = ev.Delta
 		case agent.AgentEventEnd:
 			m.stream = false
 		}
-		m.tokens = estimateTokenLike(m.msgs)
+		m.refreshTokens()
+		return m, waitForEvent(m.eventCh)
+
+	case approvalRequestMsg:
+		req := v
+		m.approval = &req
+		m.modal = modalApproval
 		return m, waitForEvent(m.eventCh)
 
 	case promptDoneMsg:
@@ -190,12 +250,40 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if v.err != nil && v.err.Error() != "context canceled" {
 			m.lastErr = v.err.Error()
 		}
-		m.tokens = estimateTokenLike(m.msgs)
+		m.refreshTokens()
 		return m, nil
 
 	case tea.KeyMsg:
 		s := v.String()
 
+		if m.modal == modalApproval {
+			if m.approval == nil {
+				m.modal = modalNone
+				return m, nil
+			}
+			var decision permission.Decision
+			switch s {
+			case "y":
+				decision = permission.DecisionAllowOnce
+			case "a":
+				decision = permission.DecisionAllowSession
+			case "n", "esc":
+				decision = permission.DecisionDenyOnce
+			case "d":
+				decision = permission.DecisionDenySession
+			case "ctrl+c":
+				decision = permission.DecisionDenyOnce
+				m.sess.Abort()
+			default:
+				return m, nil
+			}
+			m.approval.reply <- decision
+			m.statusHint = fmt.Sprintf("工具 %s: %s", m.approval.req.ToolName, decision)
+			m.approval = nil
+			m.modal = modalNone
+			return m, nil
+		}
+
 		if m.modal != modalNone {
 			switch s {
 			case "esc":
@@ -226,9 +314,9 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 						m.statusHint = "已切换会话: " + id
 						m.msgs = nil
 						for _, msg := range m.sess.Messages() {
-							m.msgs = append(m.msgs, chatMessage{Role: msg.Role, Content: msg.Content})
+							m.msgs = append(m.msgs, chatMessage{Role: msg.Role, Content: msg.Content, Thinking: msg.Thinking})
 						}
-						m.tokens = estimateTokenLike(m.msgs)
+						m.refreshTokens()
 					}
 				}
 				if m.modal == modalModel && len(m.modelItems) > 0 {
@@ -260,6 +348,9 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "ctrl+t":
 			m.expandTools = !m.expandTools
 			return m, nil
+		case "ctrl+o":
+			m.expandThinking = !m.expandThinking
+			return m, nil
 		case "ctrl+r":
 			items, err := m.sess.ListSessions()
 			if err != nil {
@@ -286,6 +377,26 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 			raw := strings.TrimSpace(m.input)
+			if fields := strings.Fields(raw); len(fields) > 0 && fields[0] == "/jobs" {
+				m.msgs = append(m.msgs, chatMessage{Role: "system", Content: tools.JobsCommand(m.sess.Jobs(), fields[1:])})
+				m.input = ""
+				return m, nil
+			}
+			if fields := strings.Fields(raw); len(fields) > 0 && (fields[0] == "/changes" || fields[0] == "/undo" || fields[0] == "/redo") {
+				m.msgs = append(m.msgs, chatMessage{Role: "system", Content: session.ChangeCommand(m.sess, fields[0], fields[1:])})
+				m.input = ""
+				return m, nil
+			}
+			if raw == "/usage" {
+				m.msgs = append(m.msgs, chatMessage{Role: "system", Content: session.UsageCommand(m.sess)})
+				m.input = ""
+				return m, nil
+			}
+			if fields := strings.Fields(raw); len(fields) > 0 && fields[0] == "/set" {
+				m.msgs = append(m.msgs, chatMessage{Role: "system", Content: session.SetCommand(m.sess, fields[1:])})
+				m.input = ""
+				return m, nil
+			}
 			if strings.HasPrefix(raw, "/skill:") {
 				name := strings.TrimPrefix(raw, "/skill:")
 				cwd, _ := os.Getwd()
@@ -408,7 +519,7 @@ func (m AppModel) View() string {
 	if msgH < 3 {
 		msgH = 3
 	}
-	msgView := renderMessages(m.msgs, innerWidth, m.scroll, msgH)
+	msgView := renderMessages(m.msgs, innerWidth, m.scroll, msgH, m.expandThinking, m.stream)
 
 	parts := []string{header, msgView}
 	if toolLines > 0 {
@@ -438,6 +549,11 @@ func (m AppModel) renderModal() string {
 		title = "模型选择器（Enter 切换, Esc 关闭）"
 		items = append(items, m.modelItems...)
 	}
+	if m.modal == modalApproval && m.approval != nil {
+		body := fmt.Sprintf("需要确认工具调用（%s）\n\n工具: %s\n参数: %s\n始终允许/拒绝的范围: %s\n\n[y] 本次允许  [a] 本会话始终允许  [n/Esc] 拒绝  [d] 本会话始终拒绝",
+			m.approval.req.Reason, m.approval.req.ToolName, trimText(m.approval.req.Args, 400), trimText(m.approval.req.Scope, 200))
+		return m.theme.Border.Width(min(80, m.width-4)).Render(body)
+	}
 	if len(items) == 0 {
 		items = []string{"(无可选项)"}
 	}
@@ -1,11 +1,34 @@
 package tui
 
-import "fmt"
+import (
+	"fmt"
 
-func renderFooter(model string, tokenCount int, streaming bool, sessionID string) string {
+	"github.com/yangruihan/go-pi/internal/session"
+)
+
+// tokenStatus 状态栏展示的 token 信息
+type tokenStatus struct {
+	show     bool               // 对应 tui.show_token_count
+	estimate int                // 本地估算值，后端尚未返回用量时使用
+	usage    session.UsageStats // 后端返回的实际用量
+}
+
+func renderFooter(model string, tokens tokenStatus, streaming bool, sessionID string) string {
 	state := "idle"
 	if streaming {
 		state = "streaming"
 	}
-	return fmt.Sprintf("model: %s | tokens~%d | state: %s | session: %s", model, tokenCount, state, sessionID)
+	out := "model: " + model
+	if tokens.show {
+		if tokens.usage.Requests > 0 {
+			// ctx 为最近一次请求的输入 token 数，in/out 为会话累计值
+			out += fmt.Sprintf(" | ctx %d | in %d / out %d", tokens.usage.LastPromptTokens, tokens.usage.PromptTokens, tokens.usage.CompletionTokens)
+			if tokens.usage.Cost > 0 {
+				out += fmt.Sprintf(" | cost %.4f", tokens.usage.Cost)
+			}
+		} else {
+			out += fmt.Sprintf(" | tokens~%d", tokens.estimate)
+		}
+	}
+	return out + fmt.Sprintf(" | state: %s | session: %s", state, sessionID)
 }
@@ -1,17 +1,40 @@
 package tui
 
 import (
+	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
 )
 
 type chatMessage struct {
-	Role    string
-	Content string
+	Role     string
+	Content  string
+	Thinking string // 推理内容，以暗色单独展示
 }
 
-func renderMessages(messages []chatMessage, width int, scrollOffset int, viewportHeight int) string {
+var thinkingStyle = lipgloss.NewStyle().Faint(true)
+
+// renderThinking 渲染推理内容：折叠时仅显示字数（仍在思考时附带最近几行），展开时显示全文
+func renderThinking(thinking string, thinkingNow, expand bool, width int) string {
+	thinking = strings.TrimSpace(thinking)
+	style := thinkingStyle.Width(max(width-6, 10))
+	if expand {
+		return style.Render("▾ 思考（ctrl+o 折叠）\n" + thinking)
+	}
+	if !thinkingNow {
+		return style.Render(fmt.Sprintf("▸ 已思考 %d 字（ctrl+o 展开）", utf8.RuneCountInString(thinking)))
+	}
+	lines := strings.Split(thinking, "\n")
+	if len(lines) > 3 {
+		lines = lines[len(lines)-3:]
+	}
+	return style.Render("▸ 思考中…\n" + strings.Join(lines, "\n"))
+}
+
+func renderMessages(messages []chatMessage, width int, scrollOffset int, viewportHeight int, expandThinking, streaming bool) string {
 	if len(messages) == 0 {
 		return "暂无消息，输入内容后按 Enter 发送。"
 	}
@@ -22,7 +45,7 @@ func renderMessages(messages []chatMessage, width int, scrollOffset int, viewpor
 	)
 
 	var blocks []string
-	for _, m := range messages {
+	for i, m := range messages {
 		prefix := "[assistant]"
 		if m.Role == "user" {
 			prefix = "[user]"
@@ -30,13 +53,21 @@ func renderMessages(messages []chatMessage, width int, scrollOffset int, viewpor
 			prefix = "[system]"
 		}
 		content := strings.TrimSpace(m.Content)
+		var thinking string
+		if strings.TrimSpace(m.Thinking) != "" {
+			thinkingNow := streaming && content == "" && i == len(messages)-1
+			thinking = renderThinking(m.Thinking, thinkingNow, expandThinking, width) + "\n"
+		}
 		if content == "" {
+			if thinking != "" {
+				blocks = append(blocks, prefix+"\n"+strings.TrimRight(thinking, "\n"))
+			}
 			continue
 		}
 		if out, err := renderer.Render(content); err == nil {
-			blocks = append(blocks, prefix+"\n"+strings.TrimRight(out, "\n"))
+			blocks = append(blocks, prefix+"\n"+thinking+strings.TrimRight(out, "\n"))
 		} else {
-			blocks = append(blocks, prefix+"\n"+content)
+			blocks = append(blocks, prefix+"\n"+thinking+content)
 		}
 	}
 
@@ -29,10 +29,10 @@ func MeasureFrameRenderTime(iterations, width, height int) (avg time.Duration, m
 	var total time.Duration
 	for i := 0; i < iterations; i++ {
 		start := time.Now()
-		_ = renderMessages(msgs, width-2, i%10, maxInt(1, height-14))
+		_ = renderMessages(msgs, width-2, i%10, maxInt(1, height-14), false, false)
 		_ = renderToolPanel(tools, true)
 		_ = renderEditor("正在输入一段较长的问题，观察布局与换行效果...", width-2)
-		_ = renderFooter("qwen3:8b", 1234+i, i%2 == 0, "bench-session")
+		_ = renderFooter("qwen3:8b", tokenStatus{show: true, estimate: 1234 + i}, i%2 == 0, "bench-session")
 		elapsed := time.Since(start)
 		total += elapsed
 		if elapsed > max {
@@ -6,9 +6,24 @@ import (
 )
 
 type toolItem struct {
+	ID     string
 	Name   string
 	Args   string
 	Output string
+	Live   string // 执行中的实时输出（仅保留末尾）
+}
+
+const (
+	toolLiveMaxBytes = 4096
+	toolLiveLines    = 4
+)
+
+// appendLive 追加实时输出，只保留末尾 toolLiveMaxBytes 字节
+func (t *toolItem) appendLive(chunk string) {
+	t.Live += chunk
+	if len(t.Live) > toolLiveMaxBytes {
+		t.Live = t.Live[len(t.Live)-toolLiveMaxBytes:]
+	}
 }
 
 func renderToolPanel(items []toolItem, expanded bool) string {
@@ -30,6 +45,14 @@ func renderToolPanel(items []toolItem, expanded bool) string {
 		}
 		if strings.TrimSpace(it.Output) != "" {
 			line += "\n  -> " + trimText(strings.ReplaceAll(it.Output, "\n", " | "), 120)
+		} else if live := strings.TrimRight(it.Live, "\n"); strings.TrimSpace(live) != "" {
+			liveLines := strings.Split(live, "\n")
+			if len(liveLines) > toolLiveLines {
+				liveLines = liveLines[len(liveLines)-toolLiveLines:]
+			}
+			for _, l := range liveLines {
+				line += "\n  | " + trimText(l, 120)
+			}
 		}
 		lines = append(lines, line)
 	}
@@ -42,3 +65,16 @@ func trimText(s string, n int) string {
 	}
 	return s[:n] + "..."
 }
+
+// findTool 按工具调用 ID 查找面板条目，找不到时返回最近一条
+func (m *AppModel) findTool(id string) *toolItem {
+	for i := len(m.tools) - 1; i >= 0; i-- {
+		if id != "" && m.tools[i].ID == id {
+			return &m.tools[i]
+		}
+	}
+	if len(m.tools) == 0 {
+		return nil
+	}
+	return &m.tools[len(m.tools)-1]
+}
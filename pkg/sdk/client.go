@@ -12,6 +12,7 @@ import (
 	"github.com/yangruihan/go-pi/internal/agent"
 	"github.com/yangruihan/go-pi/internal/config"
 	"github.com/yangruihan/go-pi/internal/llm"
+	"github.com/yangruihan/go-pi/internal/permission"
 	"github.com/yangruihan/go-pi/internal/prompt"
 	"github.com/yangruihan/go-pi/internal/session"
 	"github.com/yangruihan/go-pi/internal/skills"
@@ -29,13 +30,37 @@ type Options struct {
 	ContinueLatest    bool
 	SessionID         string
 	PreferConfigModel bool
+	// Approve 需要确认的工具调用（permissions 配置为 ask）的审批回调；
+	// 为 nil 时按 permissions.non_interactive 处理（默认拒绝）
+	Approve ApprovalFunc
+	// OnToolProgress 工具执行中的实时输出回调（如 bash 命令的逐行输出），可为 nil
+	OnToolProgress ToolProgressFunc
+	// Budget 会话用量预算；为 nil 时使用配置文件中的 budget
+	Budget *Budget
 }
 
+// Budget 会话用量预算，0 表示不限制；费用按 models.yaml 中的价格计算。
+// 达到上限后 Ask 返回错误，不再发起模型请求
+type Budget struct {
+	WarnTokens int
+	MaxTokens  int
+	WarnCost   float64
+	MaxCost    float64
+}
+
+// ApprovalFunc 工具调用审批回调，返回 true 表示允许本次调用
+type ApprovalFunc func(ctx context.Context, toolName, args string) (bool, error)
+
+// ToolProgressFunc 工具实时输出回调；chunk 为未截断的原始输出片段
+type ToolProgressFunc func(toolCallID, toolName, chunk string)
+
 type Client struct {
-	sess     session.Session
-	bashTool *tools.BashTool
-	info     RuntimeInfo
-	mu       sync.Mutex
+	sess       session.Session
+	bashTool   *tools.BashTool
+	mcp        *tools.MCPManager
+	info       RuntimeInfo
+	onProgress ToolProgressFunc
+	mu         sync.Mutex
 }
 
 type RuntimeInfo struct {
@@ -49,6 +74,8 @@ type RuntimeInfo struct {
 	CWD          string
 	SessionID    string
 	ConfigPaths  []string
+	// IgnoredConfig 项目配置中因放宽权限或沙箱而被忽略的设置
+	IgnoredConfig []string
 }
 
 type ToolTrace struct {
@@ -58,8 +85,26 @@ type ToolTrace struct {
 	ToolResult string
 }
 
+// Usage 后端返回的 token 用量
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	Requests         int     // 返回了用量的模型请求数
+	Cost             float64 // 按 models.yaml 价格计算的费用，未配置价格时为 0
+}
+
+func (u Usage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
 type AskMeta struct {
-	ToolTraces []ToolTrace
+	ToolTraces   []ToolTrace
+	Usage        Usage // 本次提问的累计用量（含工具调用后的多轮请求）
+	SessionUsage Usage // 会话累计用量
+	// FallbackModel 主模型故障时实际应答的回退模型，未发生回退时为空
+	FallbackModel string
+	// Thinking 推理模型本次输出的思考内容（不包含在回答文本中）
+	Thinking string
 }
 
 func (m AskMeta) ToolCallCount() int {
@@ -129,15 +174,19 @@ func New(opts Options) (*Client, error) {
 
 	registry := tools.NewRegistry()
 	var bashTool *tools.BashTool
+	var mcpManager *tools.MCPManager
 	if !opts.NoTools {
-		bashTool = tools.NewBashTool()
+		toolOpts := tools.OptionsFromConfig(cfg.Tools)
+		bashTool = tools.NewBashTool(toolOpts)
 		registry.Register(bashTool)
-		registry.Register(tools.NewReadTool())
+		registry.Register(tools.NewReadTool(toolOpts))
 		registry.Register(tools.NewWriteTool())
 		registry.Register(tools.NewEditTool())
-		registry.Register(tools.NewGrepTool())
-		registry.Register(tools.NewFindTool())
+		registry.Register(tools.NewApplyPatchTool())
+		registry.Register(tools.NewGrepTool(toolOpts))
+		registry.Register(tools.NewFindTool(toolOpts))
 		registry.Register(tools.NewLSTool())
+		registry.Register(tools.NewCodeSymbolsTool(toolOpts))
 
 		toolFiles := append([]string{}, cfg.Ext.ToolFiles...)
 		if len(toolFiles) == 0 {
@@ -149,7 +198,7 @@ func New(opts Options) (*Client, error) {
 			}
 		}
 		for _, tf := range toolFiles {
-			loadedTools, e := tools.LoadCustomToolsFromYAML(tf)
+			loadedTools, e := tools.LoadCustomToolsFromYAML(tf, toolOpts)
 			if e != nil {
 				continue
 			}
@@ -157,6 +206,15 @@ func New(opts Options) (*Client, error) {
 				registry.Register(tool)
 			}
 		}
+
+		if len(cfg.Ext.MCPServers) > 0 {
+			// 启动失败的服务器不注册工具，不影响客户端创建
+			mcpManager = tools.NewMCPManager(cfg.Ext.MCPServers)
+			mcpTools, _ := mcpManager.Start(context.Background())
+			for _, tool := range mcpTools {
+				registry.Register(tool)
+			}
+		}
 	}
 
 	sessionsRoot, err := session.DefaultSessionsRoot()
@@ -164,6 +222,7 @@ func New(opts Options) (*Client, error) {
 		if bashTool != nil {
 			bashTool.Close()
 		}
+		mcpManager.Close()
 		return nil, err
 	}
 	manager := session.NewSessionManager(sessionsRoot)
@@ -175,6 +234,7 @@ func New(opts Options) (*Client, error) {
 			if bashTool != nil {
 				bashTool.Close()
 			}
+			mcpManager.Close()
 			return nil, err
 		}
 	} else if opts.ContinueLatest {
@@ -183,6 +243,7 @@ func New(opts Options) (*Client, error) {
 			if bashTool != nil {
 				bashTool.Close()
 			}
+			mcpManager.Close()
 			return nil, err
 		}
 	}
@@ -201,9 +262,28 @@ func New(opts Options) (*Client, error) {
 		if bashTool != nil {
 			bashTool.Close()
 		}
+		mcpManager.Close()
 		return nil, err
 	}
 
+	// 模型价格用于费用统计与预算，fallback 用于故障回退
+	profiles, _, _ := config.LoadModelProfilesWithSources("", cwd)
+	sess.SetModelProfiles(profiles)
+	if b := opts.Budget; b != nil {
+		sess.SetBudget(config.BudgetConfig{WarnTokens: b.WarnTokens, MaxTokens: b.MaxTokens, WarnCost: b.WarnCost, MaxCost: b.MaxCost})
+	}
+
+	if opts.Approve != nil {
+		approve := opts.Approve
+		sess.SetApprover(permission.ApproverFunc(func(ctx context.Context, req permission.Request) (permission.Decision, error) {
+			ok, err := approve(ctx, req.ToolName, req.Args)
+			if err != nil || !ok {
+				return permission.DecisionDenyOnce, err
+			}
+			return permission.DecisionAllowOnce, nil
+		}))
+	}
+
 	if opts.PreferConfigModel {
 		want := strings.TrimSpace(cfg.Ollama.Model)
 		have := strings.TrimSpace(sess.Model())
@@ -213,19 +293,20 @@ func New(opts Options) (*Client, error) {
 	}
 
 	info := RuntimeInfo{
-		Mode:         "sdk",
-		Provider:     strings.TrimSpace(cfg.LLM.Provider),
-		ConfigModel:  strings.TrimSpace(cfg.Ollama.Model),
-		SessionModel: strings.TrimSpace(sess.Model()),
-		Model:        strings.TrimSpace(sess.Model()),
-		Host:         strings.TrimSpace(cfg.Ollama.Host),
-		APIBase:      strings.TrimSpace(cfg.LLM.BaseURL),
-		CWD:          cwd,
-		SessionID:    sess.SessionID(),
-		ConfigPaths:  append([]string(nil), sources.ConfigPaths...),
+		Mode:          "sdk",
+		Provider:      strings.TrimSpace(cfg.LLM.Provider),
+		ConfigModel:   strings.TrimSpace(cfg.Ollama.Model),
+		SessionModel:  strings.TrimSpace(sess.Model()),
+		Model:         strings.TrimSpace(sess.Model()),
+		Host:          strings.TrimSpace(cfg.Ollama.Host),
+		APIBase:       strings.TrimSpace(cfg.LLM.BaseURL),
+		CWD:           cwd,
+		SessionID:     sess.SessionID(),
+		ConfigPaths:   append([]string(nil), sources.ConfigPaths...),
+		IgnoredConfig: append([]string(nil), sources.Ignored...),
 	}
 
-	return &Client{sess: sess, bashTool: bashTool, info: info}, nil
+	return &Client{sess: sess, bashTool: bashTool, mcp: mcpManager, info: info, onProgress: opts.OnToolProgress}, nil
 }
 
 func (c *Client) Ask(ctx context.Context, promptText string) (string, error) {
@@ -249,6 +330,8 @@ func (c *Client) AskWithMeta(ctx context.Context, promptText string) (string, As
 		switch event.Type {
 		case agent.AgentEventDelta:
 			b.WriteString(event.Delta)
+		case agent.AgentEventThinking:
+			meta.Thinking += event.Delta
 		case agent.AgentEventToolCall:
 			trace := ToolTrace{
 				ToolCallID: strings.TrimSpace(event.ToolCallID),
@@ -259,6 +342,18 @@ func (c *Client) AskWithMeta(ctx context.Context, promptText string) (string, As
 			if trace.ToolCallID != "" {
 				traceIndex[trace.ToolCallID] = len(meta.ToolTraces) - 1
 			}
+		case agent.AgentEventFallback:
+			meta.FallbackModel = event.Model
+		case agent.AgentEventTurnEnd:
+			if event.Usage != nil {
+				meta.Usage.PromptTokens += event.Usage.PromptTokens
+				meta.Usage.CompletionTokens += event.Usage.CompletionTokens
+				meta.Usage.Requests++
+			}
+		case agent.AgentEventToolProgress:
+			if c.onProgress != nil {
+				c.onProgress(event.ToolCallID, event.ToolName, event.Delta)
+			}
 		case agent.AgentEventToolResult:
 			toolCallID := strings.TrimSpace(event.ToolCallID)
 			if idx, ok := traceIndex[toolCallID]; ok {
@@ -278,6 +373,7 @@ func (c *Client) AskWithMeta(ctx context.Context, promptText string) (string, As
 	})
 	defer unsubscribe()
 
+	costBefore := c.sess.Usage().Cost
 	done := make(chan error, 1)
 	go func() {
 		done <- c.sess.Prompt(promptText)
@@ -291,6 +387,8 @@ func (c *Client) AskWithMeta(ctx context.Context, promptText string) (string, As
 		if finalErr != nil {
 			return "", AskMeta{}, finalErr
 		}
+		meta.SessionUsage = c.Usage()
+		meta.Usage.Cost = meta.SessionUsage.Cost - costBefore
 		return strings.TrimSpace(b.String()), meta, nil
 	case <-ctx.Done():
 		c.sess.Abort()
@@ -303,15 +401,23 @@ func (c *Client) AskWithMeta(ctx context.Context, promptText string) (string, As
 	}
 }
 
+// Usage 返回会话累计用量（继续已有会话时包含历史记录）
+func (c *Client) Usage() Usage {
+	u := c.sess.Usage()
+	return Usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens, Requests: u.Requests, Cost: u.Cost}
+}
+
 func (c *Client) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.sess != nil {
 		_ = c.sess.Save()
+		c.sess.Close()
 	}
 	if c.bashTool != nil {
 		c.bashTool.Close()
 	}
+	c.mcp.Close()
 	return nil
 }
 
@@ -320,6 +426,7 @@ func (c *Client) Info() RuntimeInfo {
 	defer c.mu.Unlock()
 	out := c.info
 	out.ConfigPaths = append([]string(nil), c.info.ConfigPaths...)
+	out.IgnoredConfig = append([]string(nil), c.info.IgnoredConfig...)
 	return out
 }
 
@@ -327,7 +434,15 @@ func buildSystemMessage(cfg config.Config, runMode string) string {
 	cwd, _ := os.Getwd()
 	base := prompt.BuildBase(cwd, getOS(), cfg.LLM.Provider, runMode)
 	agentMD := strings.TrimSpace(skills.LoadAgentMarkdown(cwd))
-	return prompt.BuildWithTemplate(cfg.Prompt.TemplateFile, base, agentMD)
+	repoMap := ""
+	if cfg.Prompt.RepoMap.Enabled {
+		cacheDir := ""
+		if dir, err := config.ConfigDir(); err == nil {
+			cacheDir = filepath.Join(dir, "cache", "repomap")
+		}
+		repoMap, _ = tools.LoadRepoMap(context.Background(), cwd, cacheDir, cfg.Prompt.RepoMap.MaxTokens)
+	}
+	return prompt.BuildWithTemplate(cfg.Prompt.TemplateFile, base, agentMD, repoMap)
 }
 
 func getOS() string {